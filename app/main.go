@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
 	_ "github.com/17HIERARCH70/SocialManager/docs"
 	"github.com/17HIERARCH70/SocialManager/internal/api"
 	"github.com/17HIERARCH70/SocialManager/internal/config"
 	"github.com/17HIERARCH70/SocialManager/internal/logger"
+	"github.com/17HIERARCH70/SocialManager/internal/storage/blobstore"
 	"github.com/17HIERARCH70/SocialManager/internal/storage/postgresql"
+	"github.com/17HIERARCH70/SocialManager/internal/storage/redis"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout bounds the graceful shutdown after SIGINT or SIGTERM
+const shutdownTimeout = 30 * time.Second
+
 // @title SocialManager API
 // @version 1.0
 // @description API for managing social accounts and emails.
@@ -31,9 +40,33 @@ func main() {
 	}
 	defer psqlPool.Close()
 
+	// Initialize the Redis connection, token revocation falls back to Postgres while it is down
+	redisClient, err := redis.InitializeRedis(cfg)
+	if err != nil {
+		log.Error("Failed to connect to Redis", "error", err)
+	}
+	defer redisClient.Close()
+
+	// Initialize the attachment blob store
+	blobs, err := blobstore.InitializeBlobStore(cfg)
+	if err != nil {
+		log.Error("Failed to initialize blob store", "error", err)
+		os.Exit(-1)
+	}
+
 	// Initialize the application
-	app := api.NewApp(psqlPool, cfg, log)
+	app := api.NewApp(psqlPool, redisClient, blobs, cfg, log)
+
+	// Run the application until it fails or a termination signal arrives
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		app.Run()
+		stop()
+	}()
+	<-ctx.Done()
 
-	// Run the application
-	app.Run()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	app.Shutdown(shutdownCtx)
 }
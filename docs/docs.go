@@ -15,85 +15,113 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/auth/google_callback": {
+        "/accounts": {
             "get": {
-                "description": "Handle Google OAuth callback",
+                "description": "Retrieve the mailboxes linked to the caller. Emails carry the account_id of the mailbox they came from.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "accounts"
                 ],
-                "summary": "Google OAuth Callback",
+                "summary": "List Linked Accounts",
                 "responses": {
                     "200": {
-                        "description": "JWT Tokens",
+                        "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.LinkedAccount"
                             }
                         }
                     }
                 }
             }
         },
-        "/auth/google_login": {
-            "get": {
-                "description": "Initiate Google OAuth login",
+        "/accounts/imap": {
+            "post": {
+                "description": "Link an Outlook, Yandex or self-hosted mailbox over IMAP. The credentials are checked by logging in before the account is stored. Port defaults to 993 with TLS and 143 without.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "accounts"
+                ],
+                "summary": "Link IMAP Account",
+                "parameters": [
+                    {
+                        "description": "IMAP account",
+                        "name": "account",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/accountHandlers.IMAPAccountInput"
+                        }
+                    }
                 ],
-                "summary": "Google Login",
                 "responses": {
-                    "200": {
-                        "description": "URL for Google login",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.LinkedAccount"
                         }
                     }
                 }
             }
         },
-        "/emails": {
-            "get": {
-                "description": "Retrieve all emails",
+        "/accounts/link": {
+            "post": {
+                "description": "Start the Google authorization of another mailbox. Open the returned auth_url in a browser within ten minutes and confirm the account the mailbox is linked to, it can be used once; the callback links the mailbox to the caller and returns to redirect_url with linked_account set, or responds with the account.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "emails"
+                    "accounts"
+                ],
+                "summary": "Link Account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "URL to return to after the authorization",
+                        "name": "redirect_url",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Get All Emails",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.Email"
-                            }
+                            "$ref": "#/definitions/accountHandlers.LinkRequest"
                         }
                     }
                 }
             }
         },
-        "/emails/update": {
-            "put": {
-                "description": "Update all emails",
+        "/accounts/{account_id}": {
+            "delete": {
+                "description": "Disconnect a mailbox and delete the emails stored from it",
                 "produces": [
                     "text/plain"
                 ],
                 "tags": [
-                    "emails"
+                    "accounts"
+                ],
+                "summary": "Unlink Account",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Account ID",
+                        "name": "account_id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Update Emails",
                 "responses": {
                     "200": {
-                        "description": "Emails updated successfully",
+                        "description": "Account unlinked successfully",
                         "schema": {
                             "type": "string"
                         }
@@ -101,90 +129,265 @@ const docTemplate = `{
                 }
             }
         },
-        "/emails/user": {
+        "/attachments/{attachment_id}": {
             "get": {
-                "description": "Retrieve user ID by email",
+                "description": "Download the decoded content of an attachment with its MIME type and file name. Users may only download attachments of their own emails, admins any. Content not downloaded yet is fetched from the mailbox first. Range requests are supported to resume downloads and seek in media.",
                 "produces": [
-                    "application/json"
+                    "application/octet-stream"
                 ],
                 "tags": [
-                    "emails"
+                    "attachments"
                 ],
-                "summary": "Get User ID by Email",
+                "summary": "Download Attachment",
                 "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Attachment ID",
+                        "name": "attachment_id",
+                        "in": "path",
+                        "required": true
+                    },
                     {
                         "type": "string",
-                        "description": "Email",
+                        "description": "Byte range, e.g. bytes=0-1023",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Attachment content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Requested byte range",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "404": {
+                        "description": "Attachment not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "416": {
+                        "description": "Range not satisfiable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/attachments/{attachment_id}/inline": {
+            "get": {
+                "description": "Serve an image a body references by its Content-ID. The URLs replace the cid: sources in body and body_safe and are signed for a limited time, which lets img tags load them without an access token. Only raster images are served.",
+                "produces": [
+                    "image/png",
+                    "image/jpeg",
+                    "image/gif",
+                    "image/webp"
+                ],
+                "tags": [
+                    "attachments"
+                ],
+                "summary": "Inline Image",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Attachment ID",
+                        "name": "attachment_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID of the email the image belongs to",
                         "name": "email",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID of the user owning the email",
+                        "name": "user",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Expiry of the URL, in Unix seconds",
+                        "name": "expires",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Signature of the URL",
+                        "name": "sig",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "user_id",
+                        "description": "Image content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid or expired URL",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Attachment not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/exchange": {
+            "post": {
+                "description": "Exchange the one-time login_code of a redirected login for the JWT pair. Codes expire after two minutes.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Exchange Login Code",
+                "parameters": [
+                    {
+                        "description": "Login code",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/authHandlers.ExchangeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "JWT Tokens",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
-                                "type": "integer"
+                                "type": "string"
                             }
                         }
                     }
                 }
             }
         },
-        "/emails/user/{user_id}": {
+        "/auth/google_callback": {
             "get": {
-                "description": "Retrieve emails by user ID",
+                "description": "Handle Google OAuth callback. Returns the JWT pair, redirects to the redirect_url of the login with a login_code, or displays a short login code. When the authorization was started by /accounts/link, the mailbox is linked to the user instead and the account is returned, or its ID is passed to the redirect_url as linked_account.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "emails"
+                    "auth"
                 ],
-                "summary": "Get Emails by User ID",
+                "summary": "Google OAuth Callback",
+                "responses": {
+                    "200": {
+                        "description": "JWT Tokens",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "302": {
+                        "description": "Redirect with login_code",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/google_link": {
+            "get": {
+                "description": "Open a link ticket returned by /accounts/link in the browser: shows the account the mailbox will be linked to and asks to confirm before continuing to Google. Tickets expire with the authorization.",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Confirm Account Link",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "user_id",
-                        "in": "path",
+                        "type": "string",
+                        "description": "Link ticket",
+                        "name": "ticket",
+                        "in": "query",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Confirmation page",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.Email"
-                            }
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid or expired link",
+                        "schema": {
+                            "type": "string"
                         }
                     }
                 }
             },
-            "delete": {
-                "description": "Delete all emails by user ID",
-                "produces": [
-                    "text/plain"
+            "post": {
+                "description": "Submitted by the confirmation page of /auth/google_link: binds the authorization to the browser and redirects to Google. Tickets can be opened once and the form is only accepted from the page served to the same browser.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
                 ],
                 "tags": [
-                    "emails"
+                    "auth"
                 ],
-                "summary": "Delete All Emails by User ID",
+                "summary": "Open Account Link",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "user_id",
-                        "in": "path",
+                        "type": "string",
+                        "description": "Link ticket",
+                        "name": "ticket",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Confirmation token of the page",
+                        "name": "confirm",
+                        "in": "formData",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "All emails deleted successfully",
+                    "303": {
+                        "description": "Redirect to Google",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid or expired link",
                         "schema": {
                             "type": "string"
                         }
@@ -192,72 +395,1676 @@ const docTemplate = `{
                 }
             }
         },
-        "/emails/{email_id}": {
-            "delete": {
-                "description": "Delete an email by its ID",
+        "/auth/google_login": {
+            "get": {
+                "description": "Initiate Google OAuth login with a signed one-time state and PKCE. When redirect_url is set, the callback redirects there with a one-time login_code to exchange at /auth/exchange instead of returning the tokens. Loopback URLs and the configured auth.redirectURLs are allowed. With show_code=true the callback displays a short login code instead, for clients without a browser or a listener.",
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
-                    "emails"
+                    "auth"
                 ],
-                "summary": "Delete Email by ID",
+                "summary": "Google Login",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Email ID",
-                        "name": "email_id",
-                        "in": "path",
-                        "required": true
+                        "description": "URL to return to after the login",
+                        "name": "redirect_url",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Display a short login code after the login",
+                        "name": "show_code",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Email deleted successfully",
+                    "307": {
+                        "description": "Redirect to Google",
                         "schema": {
                             "type": "string"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "models.Attachment": {
-            "type": "object",
-            "properties": {
-                "body": {
-                    "type": "string"
-                },
-                "email_id": {
-                    "type": "integer"
-                },
-                "file": {
-                    "type": "string"
-                },
-                "filename": {
-                    "type": "string"
-                },
-                "id": {
-                    "type": "integer"
-                },
-                "mime_type": {
-                    "type": "string"
+        },
+        "/auth/logout": {
+            "post": {
+                "description": "Revoke the access and refresh tokens of the caller's session",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Logout",
+                "responses": {
+                    "200": {
+                        "description": "Logged out successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
                 }
             }
         },
-        "models.Email": {
-            "type": "object",
-            "properties": {
-                "attachment": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/models.Attachment"
-                    }
+        "/auth/logout_all": {
+            "post": {
+                "description": "Revoke the access and refresh tokens of all the caller's sessions",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Logout All Devices",
+                "responses": {
+                    "200": {
+                        "description": "Logged out from all devices successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/refresh": {
+            "post": {
+                "description": "Exchange a refresh token for a new access and refresh token pair. Every refresh token can be used once; presenting a spent token again revokes all tokens rotated from the same login.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Refresh Tokens",
+                "parameters": [
+                    {
+                        "description": "Refresh token",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/authHandlers.RefreshRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "JWT Tokens",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/discord/channels": {
+            "get": {
+                "description": "Retrieve the Discord channels receiving the caller's notifications",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "discord"
+                ],
+                "summary": "List Discord Channels",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.DiscordChannel"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Register a Discord webhook URL or, when the bot is configured, a channel ID. Only admins can register channel IDs, as the bot posts to any channel it can see. With all_emails every new email is posted, otherwise only emails matched by a filter with the notify action.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "discord"
+                ],
+                "summary": "Create Discord Channel",
+                "parameters": [
+                    {
+                        "description": "Channel",
+                        "name": "channel",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/discordHandlers.ChannelInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.DiscordChannel"
+                        }
+                    },
+                    "403": {
+                        "description": "Only admins can register bot channels",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/discord/channels/{channel_id}": {
+            "delete": {
+                "description": "Stop delivering notifications to a Discord channel",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "discord"
+                ],
+                "summary": "Delete Discord Channel",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Channel ID",
+                        "name": "channel_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Discord channel deleted successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/emails": {
+            "get": {
+                "description": "Retrieve one page of the emails of all users. Admin only. Accepts the same filters, sorting and pagination as the per-user listing.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "emails"
+                ],
+                "summary": "Get All Emails",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Only emails of one linked account",
+                        "name": "account_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sender substring",
+                        "name": "sender",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Subject substring",
+                        "name": "subject",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sent at or after (RFC 3339 or YYYY-MM-DD)",
+                        "name": "after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sent before (RFC 3339 or YYYY-MM-DD)",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only emails with (true) or without (false) attachments",
+                        "name": "has_attachment",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only read (true) or unread (false) emails",
+                        "name": "is_read",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "-sended_at",
+                        "description": "Sort field: sended_at, id, sender or subject, prefixed with - for descending order",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the page returned in X-Next-Cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Email"
+                            }
+                        },
+                        "headers": {
+                            "X-Next-Cursor": {
+                                "type": "string",
+                                "description": "Cursor of the next page"
+                            },
+                            "X-Total-Count": {
+                                "type": "integer",
+                                "description": "Total number of matching emails"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/emails/search": {
+            "get": {
+                "description": "Full-text search over subject, sender and body. Supports the Gmail-like operators from:, subject:, has:attachment, is:read, is:unread, before: and after: (YYYY/MM/DD). Free text accepts \"quoted phrases\", OR and -excluded words. The snippet is HTML-escaped text with the matches highlighted by \u003cmark\u003e. Users search their own mailbox, admins all mailboxes unless user_id is set.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "emails"
+                ],
+                "summary": "Search Emails",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Search query",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Restrict the search to one user's mailbox",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Restrict the search to one linked account",
+                        "name": "account_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Number of results to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.SearchResult"
+                            }
+                        },
+                        "headers": {
+                            "X-Total-Count": {
+                                "type": "integer",
+                                "description": "Total number of matching emails"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/emails/send": {
+            "post": {
+                "description": "Send an email from a linked Gmail account, the first one unless account_id is set, and record it locally. Attachment contents are base64-encoded. Accounts that did not grant the permission to send, including those linked before sending was supported, have to be linked again.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "emails"
+                ],
+                "summary": "Send Email",
+                "parameters": [
+                    {
+                        "description": "Email to send",
+                        "name": "email",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.OutgoingEmail"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Email"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid email",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Sending is not permitted for the account",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Account not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/emails/update": {
+            "put": {
+                "description": "Update the emails of all users. Admin only.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "emails"
+                ],
+                "summary": "Update Emails",
+                "responses": {
+                    "200": {
+                        "description": "Emails updated successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/emails/user": {
+            "get": {
+                "description": "Retrieve user ID by email. Users may only look up their own login or linked addresses, any other address is reported as not found; admins may look up any.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "emails"
+                ],
+                "summary": "Get User ID by Email",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Email",
+                        "name": "email",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "user_id",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/emails/user/{user_id}": {
+            "get": {
+                "description": "Retrieve one page of a user's emails. Users may only list their own mailbox, admins any. The total number of matching emails is returned in the X-Total-Count header and the cursor of the next page in the X-Next-Cursor and Link headers.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "emails"
+                ],
+                "summary": "Get Emails by User ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only emails of one linked account",
+                        "name": "account_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sender substring",
+                        "name": "sender",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Subject substring",
+                        "name": "subject",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sent at or after (RFC 3339 or YYYY-MM-DD)",
+                        "name": "after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sent before (RFC 3339 or YYYY-MM-DD)",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only emails with (true) or without (false) attachments",
+                        "name": "has_attachment",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only read (true) or unread (false) emails",
+                        "name": "is_read",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "-sended_at",
+                        "description": "Sort field: sended_at, id, sender or subject, prefixed with - for descending order",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor of the page returned in X-Next-Cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Email"
+                            }
+                        },
+                        "headers": {
+                            "X-Next-Cursor": {
+                                "type": "string",
+                                "description": "Cursor of the next page"
+                            },
+                            "X-Total-Count": {
+                                "type": "integer",
+                                "description": "Total number of matching emails"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete all emails by user ID. Users may only wipe their own mailbox, admins any.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "emails"
+                ],
+                "summary": "Delete All Emails by User ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "All emails deleted successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/emails/{email_id}": {
+            "delete": {
+                "description": "Delete an email by its Gmail ID. Users may only delete their own emails, admins any.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "emails"
+                ],
+                "summary": "Delete Email by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Email ID",
+                        "name": "email_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Email deleted successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/emails/{email_id}/attachments": {
+            "get": {
+                "description": "Retrieve the attachments of an email by its local ID. Users may only list their own emails, admins any. The content is downloaded from /attachments/{attachment_id}.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "attachments"
+                ],
+                "summary": "List Email Attachments",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Local email ID",
+                        "name": "email_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Attachment"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Email not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/emails/{email_id}/reply": {
+            "post": {
+                "description": "Reply to an email from the Gmail account it was received in, in the same thread. Without recipients the reply goes to the Reply-To or sender of the email, joined by its other recipients with reply_all; without a subject it is the original one prefixed with \"Re:\".",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "emails"
+                ],
+                "summary": "Reply to Email",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Email ID",
+                        "name": "email_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Reply",
+                        "name": "email",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.OutgoingEmail"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Email"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid email",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Sending is not permitted for the account",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Email not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/filters": {
+            "get": {
+                "description": "Retrieve the caller's filters in evaluation order",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "filters"
+                ],
+                "summary": "List Filters",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Filter"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a filter. Conditions test the sender, subject, body or attachment fields with the contains (any keyword, case-insensitive) or regex operators; actions are notify, tag or delete, which moves the email to the trash of its mailbox.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "filters"
+                ],
+                "summary": "Create Filter",
+                "parameters": [
+                    {
+                        "description": "Filter",
+                        "name": "filter",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/filterHandlers.FilterInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Filter"
+                        }
+                    }
+                }
+            }
+        },
+        "/filters/{filter_id}": {
+            "get": {
+                "description": "Retrieve a filter by its ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "filters"
+                ],
+                "summary": "Get Filter",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Filter ID",
+                        "name": "filter_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Filter"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Replace a filter by its ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "filters"
+                ],
+                "summary": "Update Filter",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Filter ID",
+                        "name": "filter_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Filter",
+                        "name": "filter",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/filterHandlers.FilterInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Filter"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete a filter by its ID",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "filters"
+                ],
+                "summary": "Delete Filter",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Filter ID",
+                        "name": "filter_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Filter deleted successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/images/proxy": {
+            "get": {
+                "description": "Fetch a remote image of an email on behalf of the client, so the sender never sees the reader's address. The URLs are generated by the sanitizer in body_safe and signed, which lets img tags load them without an access token. Only raster images below the configured size are served.",
+                "produces": [
+                    "image/png",
+                    "image/jpeg",
+                    "image/gif",
+                    "image/webp"
+                ],
+                "tags": [
+                    "emails"
+                ],
+                "summary": "Proxy Remote Image",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Remote image URL",
+                        "name": "url",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Signature of the URL",
+                        "name": "sig",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Image content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid signature",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Remote images are blocked",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "502": {
+                        "description": "Failed to fetch image",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/telegram/link": {
+            "post": {
+                "description": "Issue a one-time code. Sending \"/start \u003ccode\u003e\" to the bot links the chat to the caller.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "telegram"
+                ],
+                "summary": "Create Telegram Link Code",
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/telegramHandlers.LinkCode"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Stop delivering emails to the caller's Telegram chat",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "telegram"
+                ],
+                "summary": "Unlink Telegram",
+                "responses": {
+                    "200": {
+                        "description": "Telegram chat unlinked successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/threads": {
+            "get": {
+                "description": "Retrieve the email threads, the most recently active first, with their participants, message and unread counts. Users list their own threads, admins all threads unless user_id is set.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "threads"
+                ],
+                "summary": "List Threads",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Restrict the listing to one user's mailbox",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Restrict the listing to one linked account",
+                        "name": "account_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only threads with unread emails",
+                        "name": "unread",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Number of threads to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Thread"
+                            }
+                        },
+                        "headers": {
+                            "X-Total-Count": {
+                                "type": "integer",
+                                "description": "Total number of matching threads"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/threads/{thread_id}": {
+            "get": {
+                "description": "Retrieve a thread with its emails in the order they were sent, its participants and unread count. Users may only read their own threads, admins any.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "threads"
+                ],
+                "summary": "Get Thread",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Thread ID",
+                        "name": "thread_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Thread"
+                        }
+                    },
+                    "404": {
+                        "description": "Thread not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{user_id}/ingestion_policy": {
+            "get": {
+                "description": "Retrieve what happens to Gmail messages after they are stored (none, mark_read, archive, label). Users may only access their own policy, admins any.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Get Ingestion Policy",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/userHandlers.IngestionPolicy"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Change what happens to Gmail messages after they are stored (none, mark_read, archive, label). Users may only access their own policy, admins any.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Update Ingestion Policy",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Ingestion policy",
+                        "name": "policy",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/userHandlers.IngestionPolicy"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Ingestion policy updated successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/gmail": {
+            "post": {
+                "description": "Receive a Gmail users.watch notification pushed by Cloud Pub/Sub and queue an incremental sync of the mailbox. Requests are authenticated by the OIDC token of the push subscription or by the configured token query parameter. Any 2xx response acknowledges the message, so notifications for unknown mailboxes are acknowledged too.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Gmail Push Notification",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Shared push token",
+                        "name": "token",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Notification accepted"
+                    },
+                    "400": {
+                        "description": "Invalid notification",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Push notifications are not configured",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "accountHandlers.IMAPAccountInput": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "host": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                },
+                "port": {
+                    "type": "integer"
+                },
+                "tls": {
+                    "type": "boolean"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "accountHandlers.LinkRequest": {
+            "type": "object",
+            "properties": {
+                "auth_url": {
+                    "type": "string"
+                }
+            }
+        },
+        "authHandlers.ExchangeRequest": {
+            "type": "object",
+            "properties": {
+                "login_code": {
+                    "type": "string"
+                }
+            }
+        },
+        "authHandlers.RefreshRequest": {
+            "type": "object",
+            "properties": {
+                "refresh_token": {
+                    "type": "string"
+                }
+            }
+        },
+        "discordHandlers.ChannelInput": {
+            "type": "object",
+            "properties": {
+                "all_emails": {
+                    "type": "boolean"
+                },
+                "channel_id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "webhook_url": {
+                    "type": "string"
+                }
+            }
+        },
+        "filterHandlers.FilterInput": {
+            "type": "object",
+            "properties": {
+                "actions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.FilterAction"
+                    }
+                },
+                "conditions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.FilterCondition"
+                    }
+                },
+                "enabled": {
+                    "type": "boolean"
+                },
+                "match_all": {
+                    "type": "boolean"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "priority": {
+                    "type": "integer"
+                },
+                "stop_processing": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "models.Attachment": {
+            "type": "object",
+            "properties": {
+                "content_id": {
+                    "description": "ContentID is referenced by cid: URLs in the body of the email.",
+                    "type": "string"
+                },
+                "email_id": {
+                    "type": "integer"
+                },
+                "file": {
+                    "type": "string"
+                },
+                "filename": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "inline": {
+                    "type": "boolean"
+                },
+                "mime_type": {
+                    "type": "string"
+                },
+                "sha256": {
+                    "description": "SHA256 is the blob store key of the content, which is not kept in the database.",
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.DiscordChannel": {
+            "type": "object",
+            "properties": {
+                "all_emails": {
+                    "type": "boolean"
+                },
+                "channel_id": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                },
+                "webhook_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Email": {
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "integer"
+                },
+                "attachment": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Attachment"
+                    }
+                },
+                "body": {
+                    "type": "string"
+                },
+                "body_plain": {
+                    "type": "string"
+                },
+                "body_safe": {
+                    "description": "BodySafe is the sanitized HTML clients render instead of Body.",
+                    "type": "string"
+                },
+                "cc": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "email_id": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "in_reply_to": {
+                    "type": "string"
+                },
+                "is_read": {
+                    "type": "boolean"
+                },
+                "message_id": {
+                    "type": "string"
+                },
+                "references": {
+                    "description": "References lists the message IDs of the conversation, oldest first.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "reply_to": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "sended_at": {
+                    "type": "string"
+                },
+                "sender": {
+                    "type": "string"
+                },
+                "snippet": {
+                    "type": "string"
+                },
+                "structure": {
+                    "$ref": "#/definitions/models.MIMEPart"
+                },
+                "subject": {
+                    "type": "string"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "thread_id": {
+                    "type": "integer"
+                },
+                "to": {
+                    "description": "To, Cc and ReplyTo hold \"Name \u003caddress\u003e\" entries.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "models.Filter": {
+            "type": "object",
+            "properties": {
+                "actions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.FilterAction"
+                    }
+                },
+                "conditions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.FilterCondition"
+                    }
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "enabled": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "match_all": {
+                    "type": "boolean"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "priority": {
+                    "type": "integer"
+                },
+                "stop_processing": {
+                    "type": "boolean"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.FilterAction": {
+            "type": "object",
+            "properties": {
+                "channel": {
+                    "type": "string"
+                },
+                "tag": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.FilterCondition": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "keywords": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "negate": {
+                    "type": "boolean"
+                },
+                "operator": {
+                    "type": "string"
+                },
+                "pattern": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.LinkedAccount": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "external_id": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "imap_host": {
+                    "type": "string"
+                },
+                "imap_port": {
+                    "type": "integer"
+                },
+                "imap_tls": {
+                    "type": "boolean"
+                },
+                "imap_username": {
+                    "type": "string"
+                },
+                "provider": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.MIMEPart": {
+            "type": "object",
+            "properties": {
+                "charset": {
+                    "type": "string"
+                },
+                "content_id": {
+                    "type": "string"
+                },
+                "disposition": {
+                    "type": "string"
+                },
+                "filename": {
+                    "type": "string"
+                },
+                "mime_type": {
+                    "type": "string"
+                },
+                "part_id": {
+                    "type": "string"
+                },
+                "parts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.MIMEPart"
+                    }
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.OutgoingAttachment": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "filename": {
+                    "type": "string"
+                },
+                "mime_type": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.OutgoingEmail": {
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "integer"
+                },
+                "attachments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.OutgoingAttachment"
+                    }
+                },
+                "bcc": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "body": {
+                    "type": "string"
+                },
+                "cc": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "html": {
+                    "type": "string"
+                },
+                "reply_all": {
+                    "type": "boolean"
+                },
+                "subject": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "models.SearchResult": {
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "integer"
+                },
+                "attachment": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Attachment"
+                    }
                 },
                 "body": {
                     "type": "string"
                 },
+                "body_plain": {
+                    "type": "string"
+                },
+                "body_safe": {
+                    "description": "BodySafe is the sanitized HTML clients render instead of Body.",
+                    "type": "string"
+                },
+                "cc": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "created_at": {
                     "type": "string"
                 },
@@ -267,11 +2074,124 @@ const docTemplate = `{
                 "id": {
                     "type": "integer"
                 },
+                "in_reply_to": {
+                    "type": "string"
+                },
+                "is_read": {
+                    "type": "boolean"
+                },
+                "message_id": {
+                    "type": "string"
+                },
+                "rank": {
+                    "type": "number"
+                },
+                "references": {
+                    "description": "References lists the message IDs of the conversation, oldest first.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "reply_to": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "sended_at": {
+                    "type": "string"
+                },
                 "sender": {
                     "type": "string"
                 },
+                "snippet": {
+                    "type": "string"
+                },
+                "structure": {
+                    "$ref": "#/definitions/models.MIMEPart"
+                },
+                "subject": {
+                    "type": "string"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "thread_id": {
+                    "type": "integer"
+                },
+                "to": {
+                    "description": "To, Cc and ReplyTo hold \"Name \u003caddress\u003e\" entries.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "models.Thread": {
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_message_at": {
+                    "type": "string"
+                },
+                "message_count": {
+                    "type": "integer"
+                },
+                "messages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Email"
+                    }
+                },
+                "participants": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "snippet": {
+                    "type": "string"
+                },
                 "subject": {
                     "type": "string"
+                },
+                "unread_count": {
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "telegramHandlers.LinkCode": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "command": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "userHandlers.IngestionPolicy": {
+            "type": "object",
+            "properties": {
+                "policy": {
+                    "type": "string"
                 }
             }
         }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	apiBaseURL = "http://localhost:8080/api"
+	// loginTimeout is how long the loopback listener waits for the browser
+	loginTimeout = 5 * time.Minute
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Login with Google and get tokens",
+	Long: "Opens the Google login in the browser and receives the tokens on a local loopback listener.\n" +
+		"With --no-browser, or when no listener can be started, the login URL is printed and the\n" +
+		"short code displayed after the login is read from the terminal.",
+	Run: func(cmd *cobra.Command, args []string) {
+		noBrowser, _ := cmd.Flags().GetBool("no-browser")
+
+		var code string
+		var err error
+		if !noBrowser {
+			code, err = loopbackLogin()
+			if err != nil {
+				fmt.Println("Loopback login failed:", err)
+			}
+		}
+		if code == "" {
+			code, err = manualLogin()
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+		}
+
+		tokens, err := exchangeLoginCode(code)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if err := saveTokens(tokens); err != nil {
+			fmt.Println("Error saving tokens:", err)
+			return
+		}
+		fmt.Println("Tokens saved successfully")
+	},
+}
+
+var linkAccountCmd = &cobra.Command{
+	Use:   "link-account",
+	Short: "Link another Gmail mailbox to your user",
+	Long: "Opens the Google authorization of another mailbox in the browser and waits for it on a\n" +
+		"local loopback listener. Log in first; the mailbox is linked to the logged in user.",
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := getAccessToken()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+
+		redirectURL, results, stop, err := listenLoopback("linked_account")
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		defer stop()
+
+		req, err := http.NewRequest("POST", apiBaseURL+"/accounts/link?"+url.Values{"redirect_url": {redirectURL}}.Encode(), nil)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			fmt.Println("Error:", strings.TrimSpace(string(body)))
+			return
+		}
+		var link struct {
+			AuthURL string `json:"auth_url"`
+		}
+		if err := json.Unmarshal(body, &link); err != nil {
+			fmt.Println("Error parsing response:", err)
+			return
+		}
+
+		fmt.Println("Opening browser, please confirm your account and authorize the mailbox to link.")
+		fmt.Println("If the browser does not open, visit:", link.AuthURL)
+		openBrowser(link.AuthURL)
+
+		select {
+		case id := <-results:
+			fmt.Println("Mailbox linked as account", id)
+		case <-time.After(loginTimeout):
+			fmt.Printf("Error: no authorization received within %s\n", loginTimeout)
+		}
+	},
+}
+
+// loopbackLogin listens on a random loopback port, passes it to the server as the
+// redirect URL of the login and waits for the login code
+func loopbackLogin() (string, error) {
+	redirectURL, codes, stop, err := listenLoopback("login_code")
+	if err != nil {
+		return "", err
+	}
+	defer stop()
+
+	loginURL := apiBaseURL + "/auth/google_login?" + url.Values{"redirect_url": {redirectURL}}.Encode()
+	fmt.Println("Opening browser for login, please complete the login process.")
+	fmt.Println("If the browser does not open, visit:", loginURL)
+	openBrowser(loginURL)
+
+	select {
+	case code := <-codes:
+		return code, nil
+	case <-time.After(loginTimeout):
+		return "", fmt.Errorf("no login received within %s", loginTimeout)
+	}
+}
+
+// listenLoopback serves the redirect URL a browser returns to at the end of a
+// Google authorization on a random loopback port, and delivers the value of
+// the query parameter param. stop shuts the listener down.
+func listenLoopback(param string) (string, <-chan string, func(), error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	redirectURL := fmt.Sprintf("http://%s/callback", listener.Addr().String())
+	values := make(chan string, 1)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			value := r.URL.Query().Get(param)
+			if r.URL.Path != "/callback" || value == "" {
+				http.Error(w, "Missing "+param, http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintln(w, "Done, you can close this window and return to the terminal.")
+			select {
+			case values <- value:
+			default:
+			}
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go server.Serve(listener)
+	return redirectURL, values, func() { server.Shutdown(context.Background()) }, nil
+}
+
+// manualLogin prints the login URL and reads the short code displayed after the login
+func manualLogin() (string, error) {
+	loginURL := apiBaseURL + "/auth/google_login?show_code=true"
+	fmt.Println("Open this URL in a browser and complete the login:")
+	fmt.Println(" ", loginURL)
+	fmt.Print("Enter the code shown after the login: ")
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	code := strings.TrimSpace(line)
+	if code == "" {
+		return "", fmt.Errorf("no code entered")
+	}
+	return code, nil
+}
+
+// exchangeLoginCode trades a login code for the JWT pair
+func exchangeLoginCode(code string) (map[string]string, error) {
+	body, err := json.Marshal(map[string]string{"login_code": code})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.Post(apiBaseURL+"/auth/exchange", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", strings.TrimSpace(string(respBody)))
+	}
+
+	var tokens map[string]string
+	if err := json.Unmarshal(respBody, &tokens); err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
+	}
+	return tokens, nil
+}
+
+// saveTokens writes the JWT pair to the token file, readable only by the user
+func saveTokens(tokens map[string]string) error {
+	file, err := os.OpenFile(tokenFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(tokens)
+}
@@ -1,17 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/spf13/cobra"
+	"html"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
-	"sync"
+	"strings"
 )
 
 var tokenFile = "tokens.json"
@@ -30,6 +33,7 @@ func main() {
 
 func init() {
 	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(linkAccountCmd)
 	rootCmd.AddCommand(getEmailsCmd)
 	rootCmd.AddCommand(getEmailByIDCmd)
 	rootCmd.AddCommand(deleteEmailByIDCmd)
@@ -37,42 +41,46 @@ func init() {
 	rootCmd.AddCommand(updateEmailsForUserCmd)
 	rootCmd.AddCommand(getAllUsersCmd)
 	rootCmd.AddCommand(deleteUserCmd)
+	rootCmd.AddCommand(searchCmd)
+	rootCmd.AddCommand(downloadAttachmentsCmd)
+	rootCmd.AddCommand(sendCmd)
+	rootCmd.AddCommand(replyCmd)
+
+	getEmailsCmd.Flags().Int("limit", 50, "Number of emails per page")
+	getEmailsCmd.Flags().String("cursor", "", "Cursor of the page to fetch, printed by the previous call")
+	getEmailsCmd.Flags().String("sender", "", "Only emails whose sender contains this text")
+	getEmailsCmd.Flags().String("subject", "", "Only emails whose subject contains this text")
+	getEmailsCmd.Flags().String("after", "", "Only emails sent at or after this date (YYYY-MM-DD)")
+	getEmailsCmd.Flags().String("before", "", "Only emails sent before this date (YYYY-MM-DD)")
+	getEmailsCmd.Flags().Bool("unread", false, "Only unread emails")
+	getEmailsCmd.Flags().String("sort", "", "Sort field (sended_at, id, sender, subject), prefix with - for descending")
+
+	searchCmd.Flags().String("user", "", "Restrict the search to this user ID")
+	searchCmd.Flags().Int("limit", 20, "Number of results")
+	searchCmd.Flags().Int("offset", 0, "Number of results to skip")
+
+	downloadAttachmentsCmd.Flags().String("dir", "attachments", "Directory the attachments are saved to")
+
+	sendCmd.Flags().StringSlice("to", nil, "Recipient addresses")
+	sendCmd.Flags().StringSlice("cc", nil, "Carbon copy addresses")
+	sendCmd.Flags().StringSlice("bcc", nil, "Blind carbon copy addresses")
+	sendCmd.Flags().String("subject", "", "Subject")
+	sendCmd.Flags().String("body", "-", "Text of the email, - reads it from stdin")
+	sendCmd.Flags().StringSlice("attach", nil, "Files to attach")
+	sendCmd.Flags().Int("account", 0, "Linked account to send from, the first Gmail account by default")
+
+	replyCmd.Flags().String("body", "-", "Text of the reply, - reads it from stdin")
+	replyCmd.Flags().Bool("all", false, "Reply to all recipients")
+	replyCmd.Flags().StringSlice("attach", nil, "Files to attach")
+
+	loginCmd.Flags().Bool("no-browser", false, "Do not start a local listener, print the login URL and ask for the code shown after the login")
 }
 
-var loginCmd = &cobra.Command{
-	Use:   "login",
-	Short: "Login with Google and get tokens",
-	Run: func(cmd *cobra.Command, args []string) {
-		var wg sync.WaitGroup
-		wg.Add(1)
-
-		// Открытие браузера для логина
-		url := "http://localhost:8080/api/auth/google_login"
-		fmt.Println("Opening browser for login, please complete the login process.")
-		openBrowser(url)
-
-		// Считывание токенов из консоли
-		fmt.Println("Please enter the tokens in JSON format:")
-		tokens := make(map[string]string)
-		var input string
-		fmt.Scanln(&input)
-		if err := json.Unmarshal([]byte(input), &tokens); err != nil {
-			fmt.Println("Error decoding input:", err)
-			return
-		}
-
-		file, err := os.Create(tokenFile)
-		if err != nil {
-			fmt.Println("Error creating token file:", err)
-			return
-		}
-		defer file.Close()
-
-		json.NewEncoder(file).Encode(tokens)
-		fmt.Println("Tokens saved successfully")
-		wg.Done()
-		wg.Wait()
-	},
+// safeHTML returns the sanitized body of an email as a page whose relative
+// links, such as proxied images, point at the API server
+func safeHTML(email map[string]interface{}) string {
+	body, _ := email["body_safe"].(string)
+	return `<!DOCTYPE html><meta charset="utf-8"><base href="http://localhost:8080/">` + body
 }
 
 func openBrowser(url string) {
@@ -126,7 +134,19 @@ var getEmailsCmd = &cobra.Command{
 			return
 		}
 
-		req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:8080/api/emails/user/%s", userID), nil)
+		query := url.Values{}
+		limit, _ := cmd.Flags().GetInt("limit")
+		query.Set("limit", fmt.Sprint(limit))
+		for _, name := range []string{"cursor", "sender", "subject", "after", "before", "sort"} {
+			if value, _ := cmd.Flags().GetString(name); value != "" {
+				query.Set(name, value)
+			}
+		}
+		if unread, _ := cmd.Flags().GetBool("unread"); unread {
+			query.Set("is_read", "false")
+		}
+
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:8080/api/emails/user/%s?%s", userID, query.Encode()), nil)
 		if err != nil {
 			fmt.Println("Error:", err)
 			return
@@ -142,12 +162,21 @@ var getEmailsCmd = &cobra.Command{
 		defer resp.Body.Close()
 
 		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			fmt.Println("Error:", strings.TrimSpace(string(body)))
+			return
+		}
 		var emails []map[string]interface{}
 		if err := json.Unmarshal(body, &emails); err != nil {
 			fmt.Println("Error parsing response:", err)
 			return
 		}
 
+		fmt.Printf("Showing %d of %s emails\n", len(emails), resp.Header.Get("X-Total-Count"))
+		if next := resp.Header.Get("X-Next-Cursor"); next != "" {
+			fmt.Println("Next page: --cursor", next)
+		}
+
 		// Создаем папку htmls, если она не существует
 		if err := os.MkdirAll("htmls", os.ModePerm); err != nil {
 			fmt.Println("Error creating directory:", err)
@@ -156,16 +185,16 @@ var getEmailsCmd = &cobra.Command{
 
 		for i, email := range emails {
 			subject := email["subject"].(string)
-			body := email["body"].(string)
 			filename := filepath.Join("htmls", fmt.Sprintf("%d.html", i+1))
-			if err := ioutil.WriteFile(filename, []byte(body), 0644); err != nil {
+			if err := ioutil.WriteFile(filename, []byte(safeHTML(email)), 0644); err != nil {
 				fmt.Println("Error writing file:", err)
 				return
 			}
 
 			// Сохраняем метаинформацию о письме
 			metaFile := filepath.Join("htmls", fmt.Sprintf("%d.json", i+1))
-			metaInfo := map[string]string{"subject": subject}
+			snippet, _ := email["snippet"].(string)
+			metaInfo := map[string]string{"subject": subject, "snippet": snippet}
 			if metaData, err := json.Marshal(metaInfo); err == nil {
 				if err := ioutil.WriteFile(metaFile, metaData, 0644); err != nil {
 					fmt.Println("Error writing meta file:", err)
@@ -222,14 +251,15 @@ var getEmailByIDCmd = &cobra.Command{
 		}
 
 		filename := filepath.Join("htmls", fmt.Sprintf("%s.html", emailID))
-		if err := ioutil.WriteFile(filename, []byte(email["body"].(string)), 0644); err != nil {
+		if err := ioutil.WriteFile(filename, []byte(safeHTML(email)), 0644); err != nil {
 			fmt.Println("Error writing file:", err)
 			return
 		}
 
 		// Сохраняем метаинформацию о письме
 		metaFile := filepath.Join("htmls", fmt.Sprintf("%s.json", emailID))
-		metaInfo := map[string]string{"subject": email["subject"].(string)}
+		snippet, _ := email["snippet"].(string)
+		metaInfo := map[string]string{"subject": email["subject"].(string), "snippet": snippet}
 		if metaData, err := json.Marshal(metaInfo); err == nil {
 			if err := ioutil.WriteFile(metaFile, metaData, 0644); err != nil {
 				fmt.Println("Error writing meta file:", err)
@@ -397,3 +427,275 @@ var deleteUserCmd = &cobra.Command{
 		fmt.Println("User deleted successfully")
 	},
 }
+
+var searchCmd = &cobra.Command{
+	Use:   "search [query]",
+	Short: "Search emails, e.g. search 'from:alice has:attachment after:2024/01/01 report'",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := getAccessToken()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+
+		query := url.Values{}
+		query.Set("q", strings.Join(args, " "))
+		if userID, _ := cmd.Flags().GetString("user"); userID != "" {
+			query.Set("user_id", userID)
+		}
+		limit, _ := cmd.Flags().GetInt("limit")
+		offset, _ := cmd.Flags().GetInt("offset")
+		query.Set("limit", fmt.Sprint(limit))
+		query.Set("offset", fmt.Sprint(offset))
+
+		req, err := http.NewRequest("GET", "http://localhost:8080/api/emails/search?"+query.Encode(), nil)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		client := &http.Client{}
+		resp, err := client.Do(req)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			fmt.Println("Error:", strings.TrimSpace(string(body)))
+			return
+		}
+		var results []map[string]interface{}
+		if err := json.Unmarshal(body, &results); err != nil {
+			fmt.Println("Error parsing response:", err)
+			return
+		}
+
+		// Подсвечиваем совпадения жирным шрифтом в терминале
+		highlight := strings.NewReplacer("<mark>", "\033[1m", "</mark>", "\033[0m")
+		fmt.Printf("Found %s emails\n\n", resp.Header.Get("X-Total-Count"))
+		for _, r := range results {
+			fmt.Printf("[%v] %v\n  From: %v\n  Date: %v\n", r["email_id"], r["subject"], r["sender"], r["sended_at"])
+			if snippet, _ := r["snippet"].(string); snippet != "" {
+				fmt.Printf("  %s\n", html.UnescapeString(highlight.Replace(strings.ReplaceAll(snippet, "\n", " "))))
+			}
+			fmt.Println()
+		}
+	},
+}
+
+var downloadAttachmentsCmd = &cobra.Command{
+	Use:   "download-attachments [emailID]",
+	Short: "Download the attachments of an email by its local ID",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		emailID := args[0]
+		token, err := getAccessToken()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:8080/api/emails/%s/attachments", emailID), nil)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		client := &http.Client{}
+		resp, err := client.Do(req)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			fmt.Println("Error:", strings.TrimSpace(string(body)))
+			return
+		}
+		var attachments []struct {
+			ID       int    `json:"id"`
+			Filename string `json:"filename"`
+			Size     int64  `json:"size"`
+		}
+		if err := json.Unmarshal(body, &attachments); err != nil {
+			fmt.Println("Error parsing response:", err)
+			return
+		}
+		if len(attachments) == 0 {
+			fmt.Println("The email has no attachments")
+			return
+		}
+
+		dir, _ := cmd.Flags().GetString("dir")
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			fmt.Println("Error creating directory:", err)
+			return
+		}
+
+		used := map[string]bool{}
+		for _, a := range attachments {
+			filename := attachmentFilename(a.Filename, a.ID, used)
+			if err := downloadAttachment(client, token, a.ID, filepath.Join(dir, filename)); err != nil {
+				fmt.Printf("Error downloading %s: %v\n", filename, err)
+				continue
+			}
+			fmt.Printf("Saved %s (%d bytes)\n", filepath.Join(dir, filename), a.Size)
+		}
+	},
+}
+
+// attachmentFilename returns a safe, unique file name for an attachment
+func attachmentFilename(name string, id int, used map[string]bool) string {
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == "/" || name == "." {
+		name = fmt.Sprintf("attachment-%d", id)
+	}
+	if used[name] {
+		ext := filepath.Ext(name)
+		name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), id, ext)
+	}
+	used[name] = true
+	return name
+}
+
+// downloadAttachment streams an attachment to a file
+func downloadAttachment(client *http.Client, token string, id int, path string) error {
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:8080/api/attachments/%d", id), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s", strings.TrimSpace(string(body)))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+var sendCmd = &cobra.Command{
+	Use:   "send",
+	Short: "Send an email from a linked Gmail account",
+	Run: func(cmd *cobra.Command, args []string) {
+		out, err := outgoingEmail(cmd)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		out["to"], _ = cmd.Flags().GetStringSlice("to")
+		out["cc"], _ = cmd.Flags().GetStringSlice("cc")
+		out["bcc"], _ = cmd.Flags().GetStringSlice("bcc")
+		out["subject"], _ = cmd.Flags().GetString("subject")
+		out["account_id"], _ = cmd.Flags().GetInt("account")
+
+		postEmail("http://localhost:8080/api/emails/send", out)
+	},
+}
+
+var replyCmd = &cobra.Command{
+	Use:   "reply [emailID]",
+	Short: "Reply to an email by its local ID",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		out, err := outgoingEmail(cmd)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		out["reply_all"], _ = cmd.Flags().GetBool("all")
+
+		postEmail(fmt.Sprintf("http://localhost:8080/api/emails/%s/reply", args[0]), out)
+	},
+}
+
+// outgoingEmail reads the body and attachments given by the flags of cmd
+func outgoingEmail(cmd *cobra.Command) (map[string]interface{}, error) {
+	body, _ := cmd.Flags().GetString("body")
+	if body == "-" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		body = string(b)
+	}
+
+	type attachment struct {
+		Filename string `json:"filename"`
+		Content  []byte `json:"content"`
+	}
+	var attachments []attachment
+	paths, _ := cmd.Flags().GetStringSlice("attach")
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment{Filename: filepath.Base(path), Content: content})
+	}
+
+	return map[string]interface{}{"body": body, "attachments": attachments}, nil
+}
+
+// postEmail sends an outgoing email request and prints the stored email
+func postEmail(endpoint string, out map[string]interface{}) {
+	token, err := getAccessToken()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	payload, err := json.Marshal(out)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(payload))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		fmt.Println("Error:", strings.TrimSpace(string(body)))
+		return
+	}
+	var email map[string]interface{}
+	if err := json.Unmarshal(body, &email); err != nil {
+		fmt.Println("Error parsing response:", err)
+		return
+	}
+	fmt.Printf("Sent [%v] %v\n  To: %v\n", email["id"], email["subject"], email["to"])
+}
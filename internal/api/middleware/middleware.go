@@ -5,39 +5,75 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
 	jwtService "github.com/17HIERARCH70/SocialManager/internal/lib/jwt"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// RevocationChecker reports whether an access token was revoked before it expired
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
 // JWTAuthMiddleware is a middleware for JWT authentication
-func JWTAuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Missing Authorization Header", http.StatusUnauthorized)
-			return
-		}
-
-		tokenString := strings.TrimSpace(strings.Replace(authHeader, "Bearer", "", 1))
-		token, err := jwtService.VerifyAccessToken(tokenString)
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid Token", http.StatusUnauthorized)
-			return
-		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || !token.Valid {
-			http.Error(w, "Invalid Token Claims", http.StatusUnauthorized)
-			return
-		}
-
-		userID, ok := claims["user_id"].(float64)
-		if !ok {
-			http.Error(w, "Invalid User ID in Token Claims", http.StatusUnauthorized)
-			return
-		}
-
-		ctx := context.WithValue(r.Context(), "user", uint64(userID))
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+func JWTAuthMiddleware(revocations RevocationChecker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				http.Error(w, "Missing Authorization Header", http.StatusUnauthorized)
+				return
+			}
+
+			tokenString := strings.TrimSpace(strings.Replace(authHeader, "Bearer", "", 1))
+			token, err := jwtService.VerifyAccessToken(tokenString)
+			if err != nil || !token.Valid {
+				http.Error(w, "Invalid Token", http.StatusUnauthorized)
+				return
+			}
+
+			claims, ok := token.Claims.(jwt.MapClaims)
+			if !ok || !token.Valid {
+				http.Error(w, "Invalid Token Claims", http.StatusUnauthorized)
+				return
+			}
+
+			userID, ok := claims["user_id"].(float64)
+			if !ok {
+				http.Error(w, "Invalid User ID in Token Claims", http.StatusUnauthorized)
+				return
+			}
+
+			// Tokens without an ID cannot be revoked and are no longer accepted
+			jti, _ := claims["jti"].(string)
+			if jti == "" {
+				http.Error(w, "Invalid Token", http.StatusUnauthorized)
+				return
+			}
+			revoked, err := revocations.IsRevoked(r.Context(), jti)
+			if err != nil {
+				http.Error(w, "Failed to verify token", http.StatusInternalServerError)
+				return
+			}
+			if revoked {
+				http.Error(w, "Token revoked", http.StatusUnauthorized)
+				return
+			}
+
+			// Tokens without a role claim get the least privileged role
+			role, _ := claims["role"].(string)
+			if role == "" {
+				role = models.RoleUser
+			}
+			sessionID, _ := claims["fid"].(string)
+
+			ctx := WithPrincipal(r.Context(), Principal{
+				UserID:    int(userID),
+				Role:      role,
+				TokenID:   jti,
+				SessionID: sessionID,
+			})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
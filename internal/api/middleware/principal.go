@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+)
+
+// contextKey is the type of the keys stored in the request context by this package
+type contextKey string
+
+// principalKey is the context key of the authenticated Principal
+const principalKey contextKey = "principal"
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	UserID int
+	Role   string
+	// TokenID is the jti of the access token, SessionID the refresh token family it was issued in
+	TokenID   string
+	SessionID string
+}
+
+// IsAdmin reports whether the caller has the admin role
+func (p Principal) IsAdmin() bool {
+	return p.Role == models.RoleAdmin
+}
+
+// CanAccess reports whether the caller may access the data of the user
+func (p Principal) CanAccess(userID int) bool {
+	return p.IsAdmin() || p.UserID == userID
+}
+
+// WithPrincipal returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// PrincipalFromContext returns the principal stored by JWTAuthMiddleware
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey).(Principal)
+	return p, ok
+}
@@ -3,24 +3,39 @@ package api
 import (
 	_ "github.com/17HIERARCH70/SocialManager/docs"
 	"github.com/17HIERARCH70/SocialManager/internal/api/middleware"
+	"github.com/17HIERARCH70/SocialManager/internal/handlers/accountHandlers"
 	"github.com/17HIERARCH70/SocialManager/internal/handlers/authHandlers"
+	"github.com/17HIERARCH70/SocialManager/internal/handlers/discordHandlers"
 	"github.com/17HIERARCH70/SocialManager/internal/handlers/emailHandlers"
-	authService2 "github.com/17HIERARCH70/SocialManager/internal/services/authService"
-	emailService2 "github.com/17HIERARCH70/SocialManager/internal/services/emailService"
+	"github.com/17HIERARCH70/SocialManager/internal/handlers/filterHandlers"
+	"github.com/17HIERARCH70/SocialManager/internal/handlers/telegramHandlers"
+	"github.com/17HIERARCH70/SocialManager/internal/handlers/userHandlers"
+	"github.com/17HIERARCH70/SocialManager/internal/handlers/webhookHandlers"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/gmailpush"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/imageproxy"
+	userService2 "github.com/17HIERARCH70/SocialManager/internal/services/userService"
 	"github.com/gorilla/mux"
 	httpSwagger "github.com/swaggo/http-swagger"
 	_ "github.com/swaggo/swag"
+	"net/http"
 )
 
 // SetupRoutes sets up the application's routes
 func (a *App) SetupRoutes() {
 	router := mux.NewRouter()
 
-	authService, _ := authService2.NewAuthService(a.psql, a.cfg, a.log)
-	authHandler := authHandlers.NewAuthHandler(authService)
+	authHandler := authHandlers.NewAuthHandler(a.authSvc)
+	accountHandler := accountHandlers.NewAccountHandler(a.authSvc, a.emailSvc, a.log)
+	emailHandler := emailHandlers.NewEmailHandler(a.emailSvc, a.log)
+	filterHandler := filterHandlers.NewFilterHandler(a.filterSvc, a.log)
+	telegramHandler := telegramHandlers.NewTelegramHandler(a.tgSvc, a.log)
+	discordHandler := discordHandlers.NewDiscordHandler(a.discordSvc, a.log)
 
-	emailService, _ := emailService2.NewEmailService(a.psql, a.cfg, authService, a.log)
-	emailHandler := emailHandlers.NewEmailHandler(emailService, a.log)
+	pushVerifier := gmailpush.NewVerifier(a.cfg.Gmail.PushToken, a.cfg.Gmail.PushAudience, a.cfg.Gmail.PushServiceAccount, nil)
+	webhookHandler := webhookHandlers.NewWebhookHandler(a.emailSvc, pushVerifier, a.log)
+
+	userService := userService2.NewUserService(a.psql, a.log)
+	userHandler := userHandlers.NewUserHandler(userService, a.log)
 
 	// Swagger route
 	router.PathPrefix("/api/swagger/").Handler(httpSwagger.WrapHandler)
@@ -29,16 +44,69 @@ func (a *App) SetupRoutes() {
 	authRouter := router.PathPrefix("/api/auth").Subrouter()
 	authRouter.HandleFunc("/google_login", authHandler.GoogleLoginHandler).Methods("GET")
 	authRouter.HandleFunc("/google_callback", authHandler.GoogleCallbackHandler).Methods("GET")
+	authRouter.HandleFunc("/google_link", authHandler.GoogleLinkHandler).Methods("GET")
+	authRouter.HandleFunc("/google_link", authHandler.GoogleLinkConfirmHandler).Methods("POST")
+	authRouter.HandleFunc("/exchange", authHandler.ExchangeHandler).Methods("POST")
+	authRouter.HandleFunc("/refresh", authHandler.RefreshHandler).Methods("POST")
+
+	authMiddleware := middleware.JWTAuthMiddleware(a.authSvc)
+	authRouter.Handle("/logout", authMiddleware(http.HandlerFunc(authHandler.LogoutHandler))).Methods("POST")
+	authRouter.Handle("/logout_all", authMiddleware(http.HandlerFunc(authHandler.LogoutAllHandler))).Methods("POST")
+
+	// Webhook routes authenticate the pushing service instead of a user
+	webhookRouter := router.PathPrefix("/api/webhooks").Subrouter()
+	webhookRouter.HandleFunc("/gmail", webhookHandler.GmailWebhookHandler).Methods("POST")
+
+	// Proxied and inline images are loaded by img tags without a token, their URLs are signed instead
+	router.HandleFunc(imageproxy.Path, emailHandler.ProxyImageHandler).Methods("GET")
+	router.HandleFunc("/api/attachments/{attachment_id:[0-9]+}/inline", emailHandler.InlineAttachmentHandler).Methods("GET")
 
 	protectedRouter := router.PathPrefix("/api").Subrouter()
-	protectedRouter.Use(middleware.JWTAuthMiddleware)
+	protectedRouter.Use(authMiddleware)
 
 	// Email routes
 	protectedRouter.HandleFunc("/emails/user/{user_id:[0-9]+}", emailHandler.GetEmailsByUserIDHandler).Methods("GET")
 	protectedRouter.HandleFunc("/emails", emailHandler.GetAllEmailsHandler).Methods("GET")
+	protectedRouter.HandleFunc("/emails/search", emailHandler.SearchEmailsHandler).Methods("GET")
 	protectedRouter.HandleFunc("/emails/user", emailHandler.GetUserIDByEmailHandler).Methods("GET")
+	protectedRouter.HandleFunc("/emails/send", emailHandler.SendEmailHandler).Methods("POST")
+	protectedRouter.HandleFunc("/emails/{email_id:[0-9]+}/reply", emailHandler.ReplyEmailHandler).Methods("POST")
 	protectedRouter.HandleFunc("/emails/{email_id}", emailHandler.DeleteEmailByIDHandler).Methods("DELETE")
 	protectedRouter.HandleFunc("/emails/user/{user_id:[0-9]+}", emailHandler.DeleteAllEmailsByUserIDHandler).Methods("DELETE")
 
+	// Attachment routes
+	protectedRouter.HandleFunc("/emails/{email_id:[0-9]+}/attachments", emailHandler.ListAttachmentsHandler).Methods("GET")
+	protectedRouter.HandleFunc("/attachments/{attachment_id:[0-9]+}", emailHandler.DownloadAttachmentHandler).Methods("GET")
+
+	// Thread routes
+	protectedRouter.HandleFunc("/threads", emailHandler.ListThreadsHandler).Methods("GET")
+	protectedRouter.HandleFunc("/threads/{thread_id:[0-9]+}", emailHandler.GetThreadHandler).Methods("GET")
+
+	// Linked account routes
+	protectedRouter.HandleFunc("/accounts", accountHandler.ListAccountsHandler).Methods("GET")
+	protectedRouter.HandleFunc("/accounts/link", accountHandler.LinkAccountHandler).Methods("POST")
+	protectedRouter.HandleFunc("/accounts/imap", accountHandler.LinkIMAPAccountHandler).Methods("POST")
+	protectedRouter.HandleFunc("/accounts/{account_id:[0-9]+}", accountHandler.UnlinkAccountHandler).Methods("DELETE")
+
+	// User routes
+	protectedRouter.HandleFunc("/users/{user_id:[0-9]+}/ingestion_policy", userHandler.GetIngestionPolicyHandler).Methods("GET")
+	protectedRouter.HandleFunc("/users/{user_id:[0-9]+}/ingestion_policy", userHandler.UpdateIngestionPolicyHandler).Methods("PUT")
+
+	// Filter routes
+	protectedRouter.HandleFunc("/filters", filterHandler.ListFiltersHandler).Methods("GET")
+	protectedRouter.HandleFunc("/filters", filterHandler.CreateFilterHandler).Methods("POST")
+	protectedRouter.HandleFunc("/filters/{filter_id:[0-9]+}", filterHandler.GetFilterHandler).Methods("GET")
+	protectedRouter.HandleFunc("/filters/{filter_id:[0-9]+}", filterHandler.UpdateFilterHandler).Methods("PUT")
+	protectedRouter.HandleFunc("/filters/{filter_id:[0-9]+}", filterHandler.DeleteFilterHandler).Methods("DELETE")
+
+	// Telegram routes
+	protectedRouter.HandleFunc("/telegram/link", telegramHandler.CreateLinkCodeHandler).Methods("POST")
+	protectedRouter.HandleFunc("/telegram/link", telegramHandler.UnlinkHandler).Methods("DELETE")
+
+	// Discord routes
+	protectedRouter.HandleFunc("/discord/channels", discordHandler.ListChannelsHandler).Methods("GET")
+	protectedRouter.HandleFunc("/discord/channels", discordHandler.CreateChannelHandler).Methods("POST")
+	protectedRouter.HandleFunc("/discord/channels/{channel_id:[0-9]+}", discordHandler.DeleteChannelHandler).Methods("DELETE")
+
 	a.router = router
 }
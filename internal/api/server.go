@@ -6,40 +6,82 @@ import (
 	_ "github.com/17HIERARCH70/SocialManager/docs"
 	"github.com/17HIERARCH70/SocialManager/internal/config"
 	"github.com/17HIERARCH70/SocialManager/internal/services/authService"
+	"github.com/17HIERARCH70/SocialManager/internal/services/discordService"
 	emailService2 "github.com/17HIERARCH70/SocialManager/internal/services/emailService"
+	"github.com/17HIERARCH70/SocialManager/internal/services/filterService"
+	"github.com/17HIERARCH70/SocialManager/internal/services/telegramService"
+	"github.com/17HIERARCH70/SocialManager/internal/storage/blobstore"
+	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v4/pgxpool"
 	_ "github.com/swaggo/swag"
 	"golang.org/x/exp/slog"
 	"net/http"
+	"sync"
 )
 
 // App represents the application with all its dependencies
 type App struct {
 	psql       *pgxpool.Pool
+	redis      *redis.Client
 	cfg        *config.Config
 	log        *slog.Logger
 	router     *mux.Router
 	httpServer *http.Server
+	authSvc    *authService.AuthService
 	emailSvc   *emailService2.EmailService
+	filterSvc  *filterService.FilterService
+	tgSvc      *telegramService.TelegramService
+	discordSvc *discordService.DiscordService
+
+	// ctx is cancelled by Shutdown to stop the background workers tracked by wg
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
 // NewApp initializes the application with the given dependencies
-func NewApp(psql *pgxpool.Pool, cfg *config.Config, log *slog.Logger) *App {
+func NewApp(psql *pgxpool.Pool, rdb *redis.Client, blobs blobstore.Store, cfg *config.Config, log *slog.Logger) *App {
 	// Create a new router
 	router := mux.NewRouter()
 
 	// Initialize email service
-	authServices, _ := authService.NewAuthService(psql, cfg, log)
-	emailService, _ := emailService2.NewEmailService(psql, cfg, authServices, log)
+	authServices, _ := authService.NewAuthService(psql, rdb, cfg, log)
+	emailService, _ := emailService2.NewEmailService(psql, blobs, cfg, authServices, log)
+
+	// Run the user filters on every newly stored email
+	filterServices := filterService.NewFilterService(psql, emailService, log)
+	emailService.OnNewEmails(filterServices.ProcessNewEmails)
+
+	// Deliver filter notifications through the Telegram bot
+	tgService, err := telegramService.NewTelegramService(psql, cfg, emailService, log)
+	if err != nil {
+		log.Error("Failed to initialize Telegram bot", "error", err)
+	}
+	filterServices.AddNotifier(tgService)
+
+	// Post new emails and filter notifications to Discord
+	discordSvc, err := discordService.NewDiscordService(psql, cfg, log)
+	if err != nil {
+		log.Error("Failed to initialize Discord bot", "error", err)
+	}
+	emailService.OnNewEmails(discordSvc.ProcessNewEmails)
+	filterServices.AddNotifier(discordSvc)
 
 	// Create the App instance
+	ctx, cancel := context.WithCancel(context.Background())
 	app := &App{
-		psql:     psql,
-		cfg:      cfg,
-		log:      log,
-		router:   router,
-		emailSvc: emailService,
+		psql:       psql,
+		cfg:        cfg,
+		log:        log,
+		router:     router,
+		authSvc:    authServices,
+		emailSvc:   emailService,
+		filterSvc:  filterServices,
+		tgSvc:      tgService,
+		discordSvc: discordSvc,
+		ctx:        ctx,
+		cancel:     cancel,
 	}
 
 	app.SetupRoutes()
@@ -49,20 +91,44 @@ func NewApp(psql *pgxpool.Pool, cfg *config.Config, log *slog.Logger) *App {
 
 // Run starts the HTTP server and the email polling service
 func (a *App) Run() {
-	go a.emailSvc.StartEmailPolling()
+	if err := a.authSvc.RestoreDenylist(context.Background()); err != nil {
+		a.log.Error("Failed to restore the token denylist", "error", err)
+	}
+	a.background(a.authSvc.EncryptIMAPPasswords)
+	a.background(a.emailSvc.StartEmailPolling)
+	a.background(a.emailSvc.StartWatchRenewal)
+	a.background(a.emailSvc.BackfillAttachmentBlobs)
+	a.background(a.emailSvc.BackfillSafeBodies)
+	a.background(a.emailSvc.BackfillDecodedHeaders)
+	a.background(a.emailSvc.BackfillThreads)
+	a.background(a.emailSvc.StartAttachmentPrefetch)
+	a.background(a.tgSvc.Start)
+	a.background(a.discordSvc.Start)
 
 	a.httpServer = &http.Server{
 		Addr:    fmt.Sprintf("%s:%d", a.cfg.Server.Host, a.cfg.Server.Port),
 		Handler: a.router,
 	}
 	a.log.Info("Starting server", "port", a.cfg.Server.Port)
-	if err := http.ListenAndServe(fmt.Sprintf("%s:%d", a.cfg.Server.Host, a.cfg.Server.Port), a.router); err != nil {
+	if err := a.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		a.log.Error("Failed to start server", "error", err)
 	}
 }
 
-// Shutdown gracefully shuts down the HTTP server and closes the database connection
+// background runs a worker until Shutdown cancels the application context
+func (a *App) background(run func(ctx context.Context)) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		run(a.ctx)
+	}()
+}
+
+// Shutdown stops the background workers, gracefully shuts down the HTTP server
+// and closes the database connection
 func (a *App) Shutdown(ctx context.Context) interface{} {
+	a.cancel()
+
 	if a.httpServer != nil {
 		if err := a.httpServer.Shutdown(ctx); err != nil {
 			a.log.Error("Failed to shutdown the server properly", "error", err)
@@ -70,6 +136,20 @@ func (a *App) Shutdown(ctx context.Context) interface{} {
 		}
 		a.log.Info("HTTP server stopped")
 	}
+
+	// Let the running syncs finish their current step before the pool is closed
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		a.log.Info("Background workers stopped")
+	case <-ctx.Done():
+		a.log.Warn("Background workers did not stop in time", "error", ctx.Err())
+	}
+
 	if a.psql != nil {
 		a.psql.Close()
 		a.log.Info("Database connection closed")
@@ -11,9 +11,17 @@ type Config struct {
 	LogLevel string         `yaml:"log_level" env-default:"INFO"`
 	Server   ServerConfig   `yaml:"server"`
 	Postgres PostgresConfig `yaml:"postgres"`
+	Redis    RedisConfig    `yaml:"redis"`
 	Gmail    GmailConfig    `yaml:"gmail"`
-	Secrets  SecretsConfig  `yaml:"secrets"`
+	Telegram TelegramConfig `yaml:"telegram"`
+	Discord  DiscordConfig  `yaml:"discord"`
+	Auth     AuthConfig     `yaml:"auth"`
 	OAuth2   OAuth2Config   `yaml:"oauth2"`
+	Blobs    BlobConfig     `yaml:"blobs"`
+	// Attachments configures when attachment contents are downloaded
+	Attachments AttachmentConfig `yaml:"attachments"`
+	// Images configures how remote images of email bodies are loaded
+	Images ImagesConfig `yaml:"images"`
 }
 
 type ServerConfig struct {
@@ -30,18 +38,104 @@ type PostgresConfig struct {
 	SSLMode  string `yaml:"SSLMode" env-default:"disable"`
 }
 
+type RedisConfig struct {
+	Host     string `yaml:"host" env-default:"localhost"`
+	Port     int    `yaml:"port" env-default:"6379"`
+	Password string `yaml:"password,omitempty"`
+	Database int    `yaml:"database" env-default:"0"`
+}
+
 type GmailConfig struct {
-	RefreshTime string `yaml:"refreshTime" env-default:"5m"`
+	RefreshTime   string `yaml:"refreshTime" env-default:"5m"`
+	FullSyncLimit int    `yaml:"fullSyncLimit" env-default:"500"`
+	// Workers is the number of mailboxes synced at the same time
+	Workers int `yaml:"workers" env-default:"4"`
+	// Jitter is the maximum random delay before each sync, spreading the load of a polling round
+	Jitter string `yaml:"jitter" env-default:"10s"`
+	// MaxBackoff caps the delay before retrying a mailbox whose syncs keep failing
+	MaxBackoff string `yaml:"maxBackoff" env-default:"1h"`
+	// QuotaUnits is the number of Gmail API quota units a mailbox may use per second
+	QuotaUnits int `yaml:"quotaUnits" env-default:"250"`
+	// PubSubTopic enables push notifications through users.watch, e.g. projects/my-project/topics/gmail
+	PubSubTopic string `yaml:"pubsubTopic"`
+	// PushToken authenticates push requests carrying it in the token query parameter
+	PushToken string `yaml:"pushToken" env:"GMAIL_PUSH_TOKEN"`
+	// PushAudience authenticates push requests by the OIDC token Pub/Sub signs for this audience
+	PushAudience string `yaml:"pushAudience"`
+	// PushServiceAccount is the service account the OIDC token must be issued to
+	PushServiceAccount string `yaml:"pushServiceAccount"`
+}
+
+type TelegramConfig struct {
+	SecretPath  string `yaml:"secretPath"`
+	RefreshTime string `yaml:"refreshTime" env-default:"30s"`
+	BaseURL     string `yaml:"baseURL" env-default:"https://api.telegram.org"`
+	MaxRetries  int    `yaml:"maxRetries" env-default:"3"`
+}
+
+type DiscordConfig struct {
+	SecretPath   string `yaml:"secretPath"`
+	BaseURL      string `yaml:"baseURL" env-default:"https://discord.com/api/v10"`
+	RateInterval string `yaml:"rateInterval" env-default:"2s"`
+	RateBurst    int    `yaml:"rateBurst" env-default:"5"`
+	MaxRetries   int    `yaml:"maxRetries" env-default:"3"`
+}
+
+type BlobConfig struct {
+	// Backend is "fs" for the local filesystem or "s3" for an S3-compatible bucket
+	Backend string `yaml:"backend" env-default:"fs"`
+	// Path is the root directory of the filesystem backend
+	Path string       `yaml:"path" env-default:"data/blobs"`
+	S3   S3BlobConfig `yaml:"s3"`
+}
+
+type AttachmentConfig struct {
+	// PrefetchInterval is how often attachments not downloaded yet are prefetched, 0 disables prefetching
+	PrefetchInterval string `yaml:"prefetchInterval" env-default:"1m"`
+	// PrefetchMaxSize is the size in bytes above which attachments are only downloaded on request
+	PrefetchMaxSize int64 `yaml:"prefetchMaxSize" env-default:"5242880"`
+	// PrefetchTypes limits prefetching to these MIME types, a trailing / matches a whole family
+	// such as image/; empty prefetches every type
+	PrefetchTypes []string `yaml:"prefetchTypes" env-separator:","`
+}
+
+type ImagesConfig struct {
+	// Remote is "proxy" to load remote images through the server or "block" to remove them
+	Remote string `yaml:"remote" env-default:"proxy"`
+	// ProxyKey is the server secret signing proxied and inline image URLs, at least minKeyLength bytes
+	ProxyKey string `yaml:"proxyKey" env:"IMAGE_PROXY_KEY" env-required:"true"`
+	// MaxSize is the size in bytes above which remote images are refused
+	MaxSize int64  `yaml:"maxSize" env-default:"5242880"`
+	Timeout string `yaml:"timeout" env-default:"10s"`
+}
+
+type S3BlobConfig struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region" env-default:"us-east-1"`
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"`
+	AccessKey string `yaml:"accessKey" env:"S3_ACCESS_KEY"`
+	SecretKey string `yaml:"secretKey" env:"S3_SECRET_KEY"`
+	// PathStyle addresses the bucket in the URL path, as MinIO expects
+	PathStyle bool `yaml:"pathStyle" env-default:"true"`
 }
 
 type OAuth2Config struct {
 	CredentialPath string `yaml:"credentialPath" env-default:"config/secretGmail.json"`
 }
 
-type SecretsConfig struct {
-	JWTSecret string `yaml:"jwtSecret" env-default:"SECRET_KEY"`
+type AuthConfig struct {
+	// Admins are the emails granted the admin role when they log in
+	Admins []string `yaml:"admins" env:"ADMIN_EMAILS" env-separator:","`
+	// RedirectURLs are the URL prefixes a login may return to; loopback URLs are always allowed
+	RedirectURLs []string `yaml:"redirectURLs" env:"AUTH_REDIRECT_URLS" env-separator:","`
+	// CredentialKey is the server secret encrypting the IMAP passwords of linked accounts, at least minKeyLength bytes
+	CredentialKey string `yaml:"credentialKey" env:"CREDENTIAL_KEY" env-required:"true"`
 }
 
+// minKeyLength is the minimum length of the server secrets
+const minKeyLength = 32
+
 func MustLoad() *Config {
 	configPath := fetchConfigPath()
 	if configPath == "" {
@@ -58,6 +152,13 @@ func MustLoad() *Config {
 		panic("config path is empty " + err.Error())
 	}
 
+	if len(cfg.Images.ProxyKey) < minKeyLength {
+		panic("IMAGE_PROXY_KEY must be a random secret of at least 32 bytes")
+	}
+	if len(cfg.Auth.CredentialKey) < minKeyLength {
+		panic("CREDENTIAL_KEY must be a random secret of at least 32 bytes")
+	}
+
 	return &cfg
 }
 
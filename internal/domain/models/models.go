@@ -1,75 +1,262 @@
 package models
 
-import (
-	"time"
+import "time"
+
+// Ingestion policies decide what happens to a Gmail message once it is stored.
+const (
+	IngestionPolicyNone     = "none"
+	IngestionPolicyMarkRead = "mark_read"
+	IngestionPolicyArchive  = "archive"
+	IngestionPolicyLabel    = "label"
+)
+
+// IngestedLabelName is the Gmail label applied by IngestionPolicyLabel.
+const IngestedLabelName = "SocialManager/ingested"
+
+// Roles decide which mailboxes a user may access.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
 )
 
 // User represents a user in the system.
 type User struct {
-	ID         int    `json:"id"`
-	GoogleID   string `json:"google_id"`
-	TelegramID string `json:"telegram_id"`
-	Email      string `json:"email"`
+	ID              int    `json:"id"`
+	GoogleID        string `json:"google_id"`
+	TelegramID      string `json:"telegram_id"`
+	Email           string `json:"email"`
+	Role            string `json:"role"`
+	IngestionPolicy string `json:"ingestion_policy"`
+}
+
+// Mail providers of linked accounts.
+const (
+	ProviderGmail = "gmail"
+	ProviderIMAP  = "imap"
+)
+
+// LinkedAccount is a mailbox connected to a user. A user logs in with one Google
+// account and may link further Gmail or IMAP mailboxes; the OAuth tokens and the
+// IMAP password are never serialized.
+type LinkedAccount struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"user_id"`
+	Provider     string    `json:"provider"`
+	ExternalID   string    `json:"external_id"`
+	Address      string    `json:"address"`
+	AccessToken  string    `json:"-"`
+	RefreshToken string    `json:"-"`
+	ExpiresAt    time.Time `json:"-"`
+	IMAPHost     string    `json:"imap_host,omitempty"`
+	IMAPPort     int       `json:"imap_port,omitempty"`
+	IMAPTLS      bool      `json:"imap_tls,omitempty"`
+	IMAPUsername string    `json:"imap_username,omitempty"`
+	IMAPPassword string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ValidIngestionPolicy reports whether policy is a known ingestion policy.
+func ValidIngestionPolicy(policy string) bool {
+	switch policy {
+	case IngestionPolicyNone, IngestionPolicyMarkRead, IngestionPolicyArchive, IngestionPolicyLabel:
+		return true
+	}
+	return false
 }
 
 // Email represents an email fetched from Gmail.
 type Email struct {
-	ID         int          `json:"id"`
-	EmailID    string       `json:"email_id"`
-	Subject    string       `json:"subject"`
-	Body       string       `json:"body"`
-	Sender     string       `json:"sender"`
+	ID        int    `json:"id"`
+	AccountID int    `json:"account_id"`
+	ThreadID  int    `json:"thread_id"`
+	EmailID   string `json:"email_id"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+	BodyPlain string `json:"body_plain"`
+	BodyText  string `json:"-"`
+	// BodySafe is the sanitized HTML clients render instead of Body.
+	BodySafe string `json:"body_safe"`
+	Snippet  string `json:"snippet"`
+	Sender   string `json:"sender"`
+	// To, Cc and ReplyTo hold "Name <address>" entries.
+	To        []string `json:"to"`
+	Cc        []string `json:"cc"`
+	ReplyTo   []string `json:"reply_to"`
+	MessageID string   `json:"message_id"`
+	InReplyTo string   `json:"in_reply_to"`
+	// References lists the message IDs of the conversation, oldest first.
+	References []string     `json:"references"`
+	IsRead     bool         `json:"is_read"`
+	Tags       []string     `json:"tags"`
 	Attachment []Attachment `json:"attachment"`
+	Structure  *MIMEPart    `json:"structure,omitempty"`
+	SendedAt   time.Time    `json:"sended_at"`
 	CreatedAt  time.Time    `json:"created_at"`
 }
 
+// MIMEPart is a node of the MIME structure of an email. Parts are numbered
+// like IMAP body sections, the root having an empty ID.
+type MIMEPart struct {
+	PartID      string     `json:"part_id"`
+	MimeType    string     `json:"mime_type"`
+	Charset     string     `json:"charset,omitempty"`
+	Filename    string     `json:"filename,omitempty"`
+	ContentID   string     `json:"content_id,omitempty"`
+	Disposition string     `json:"disposition,omitempty"`
+	Size        int64      `json:"size"`
+	Parts       []MIMEPart `json:"parts,omitempty"`
+}
+
+// OutgoingEmail is an email sent from a linked Gmail account. Body is the plain
+// text and HTML an optional alternative. For replies the recipients default to
+// the sender of the original email, joined by its other recipients with
+// ReplyAll, and the subject to the original one.
+type OutgoingEmail struct {
+	AccountID   int                  `json:"account_id,omitempty"`
+	To          []string             `json:"to"`
+	Cc          []string             `json:"cc,omitempty"`
+	Bcc         []string             `json:"bcc,omitempty"`
+	Subject     string               `json:"subject"`
+	Body        string               `json:"body"`
+	HTML        string               `json:"html,omitempty"`
+	ReplyAll    bool                 `json:"reply_all,omitempty"`
+	Attachments []OutgoingAttachment `json:"attachments,omitempty"`
+}
+
+// OutgoingAttachment is a file attached to an outgoing email, its content
+// base64-encoded in JSON.
+type OutgoingAttachment struct {
+	Filename string `json:"filename"`
+	MimeType string `json:"mime_type,omitempty"`
+	Content  []byte `json:"content"`
+}
+
+// Thread is a conversation of emails. Participants lists the senders and
+// recipients once per address; Messages is only filled for a single thread.
+type Thread struct {
+	ID            int       `json:"id"`
+	UserID        int       `json:"user_id"`
+	AccountID     int       `json:"account_id"`
+	Subject       string    `json:"subject"`
+	Snippet       string    `json:"snippet"`
+	Participants  []string  `json:"participants"`
+	MessageCount  int       `json:"message_count"`
+	UnreadCount   int       `json:"unread_count"`
+	LastMessageAt time.Time `json:"last_message_at"`
+	Messages      []Email   `json:"messages,omitempty"`
+}
+
+// SearchResult is an email matched by a full-text search. Snippet is
+// HTML-escaped text in which only the matches are wrapped in <mark> tags.
+type SearchResult struct {
+	Email
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// EmailQuery describes the filters, ordering and page of an email listing.
+// Nil pointers and empty strings leave the corresponding filter unset.
+type EmailQuery struct {
+	UserID        *int
+	AccountID     *int
+	Sender        string
+	Subject       string
+	SendedAfter   *time.Time
+	SendedBefore  *time.Time
+	HasAttachment *bool
+	IsRead        *bool
+	Sort          string
+	Cursor        string
+	Limit         int
+}
+
+// EmailPage is one page of an email listing.
+type EmailPage struct {
+	Emails     []Email
+	Total      int
+	NextCursor string
+}
+
+// Filter condition fields.
+const (
+	FilterFieldSender     = "sender"
+	FilterFieldSubject    = "subject"
+	FilterFieldBody       = "body"
+	FilterFieldAttachment = "attachment"
+)
+
+// Filter condition operators.
+const (
+	// FilterOperatorContains matches when the field contains any of the keywords, ignoring case.
+	FilterOperatorContains = "contains"
+	// FilterOperatorRegex matches when the field matches the regular expression.
+	FilterOperatorRegex = "regex"
+)
+
+// Filter action types.
+const (
+	FilterActionNotify = "notify"
+	FilterActionTag    = "tag"
+	FilterActionDelete = "delete"
+)
+
+// FilterCondition is a single test applied to an incoming email. Attachment
+// conditions are matched against the file names and MIME types of the attachments.
+type FilterCondition struct {
+	Field    string   `json:"field"`
+	Operator string   `json:"operator"`
+	Keywords []string `json:"keywords,omitempty"`
+	Pattern  string   `json:"pattern,omitempty"`
+	Negate   bool     `json:"negate,omitempty"`
+}
+
+// FilterAction is performed on an email that matched a filter. Channel limits
+// a notify action to one notifier, such as "telegram"; empty means all of them.
+type FilterAction struct {
+	Type    string `json:"type"`
+	Tag     string `json:"tag,omitempty"`
+	Channel string `json:"channel,omitempty"`
+}
+
+// Filter is a user rule deciding what happens to new emails.
+type Filter struct {
+	ID             int               `json:"id"`
+	UserID         int               `json:"user_id"`
+	Name           string            `json:"name"`
+	Enabled        bool              `json:"enabled"`
+	Priority       int               `json:"priority"`
+	MatchAll       bool              `json:"match_all"`
+	StopProcessing bool              `json:"stop_processing"`
+	Conditions     []FilterCondition `json:"conditions"`
+	Actions        []FilterAction    `json:"actions"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// DiscordChannel is a Discord destination for email notifications, either a
+// webhook or a channel the bot posts to. The webhook token is never serialized.
+type DiscordChannel struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"user_id"`
+	Name         string    `json:"name"`
+	WebhookID    string    `json:"webhook_id,omitempty"`
+	WebhookToken string    `json:"-"`
+	ChannelID    string    `json:"channel_id,omitempty"`
+	AllEmails    bool      `json:"all_emails"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
 // Attachment represents an attachment in an email.
 type Attachment struct {
-	ID       int    `json:"id"`
-	EmailID  int    `json:"email_id"`
-	Body     string `json:"body"`
-	File     string `json:"file"`
+	ID      int    `json:"id"`
+	EmailID int    `json:"email_id"`
+	File    string `json:"file"`
+	// SHA256 is the blob store key of the content, which is not kept in the database.
+	SHA256   string `json:"sha256"`
+	Size     int64  `json:"size"`
 	MimeType string `json:"mime_type"`
 	Filename string `json:"filename"`
+	// ContentID is referenced by cid: URLs in the body of the email.
+	ContentID string `json:"content_id,omitempty"`
+	Inline    bool   `json:"inline"`
 }
-
-//// HTML will return the value that can be used to put in a HTML attribute.
-//func (a Attachment) HTML() string {
-//	data, _ := base64.URLEncoding.DecodeString(a.Body)
-//	html := base64.StdEncoding.EncodeToString(data)
-//	return fmt.Sprintf("data:%s;base64,%s", a.MimeType, html)
-//}
-//
-//// Placeholder will return the placeholder that is used in an email to identify
-//// the attachment.
-//func (a Attachment) Placeholder() string {
-//	return fmt.Sprintf("cid:%s", a.Filename)
-//}
-//
-//// HTML the decoded email body as HTML contents and an error if decoding failed.
-//func (e Email) HTML() (html string, err error) {
-//	data, err := base64.URLEncoding.DecodeString(e.Body)
-//
-//	if err == nil {
-//		html = string(data)
-//
-//		if len(e.Attachments) > 0 {
-//			html = replaceAttachments(html, e.Attachments)
-//		}
-//	}
-//
-//	return html, err
-//}
-//
-//func replaceAttachments(html string, attachments []Attachment) string {
-//	for _, attachment := range attachments {
-//		html = strings.Replace(
-//			html,
-//			attachment.Placeholder(),
-//			attachment.HTML(),
-//			-1,
-//		)
-//	}
-//
-//	return html
-//}
@@ -0,0 +1,216 @@
+package accountHandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/17HIERARCH70/SocialManager/internal/api/middleware"
+	"github.com/17HIERARCH70/SocialManager/internal/handlers/authHandlers"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/mailsource"
+	"github.com/17HIERARCH70/SocialManager/internal/services/authService"
+	"github.com/17HIERARCH70/SocialManager/internal/services/emailService"
+	"github.com/gorilla/mux"
+	"golang.org/x/exp/slog"
+)
+
+// AccountHandler handles linked mailbox requests
+type AccountHandler struct {
+	authService  *authService.AuthService
+	emailService *emailService.EmailService
+	log          *slog.Logger
+}
+
+// NewAccountHandler creates a new AccountHandler
+func NewAccountHandler(authService *authService.AuthService, emailService *emailService.EmailService, log *slog.Logger) *AccountHandler {
+	return &AccountHandler{
+		authService:  authService,
+		emailService: emailService,
+		log:          log,
+	}
+}
+
+// LinkRequest is the response of the link account endpoint
+type LinkRequest struct {
+	AuthURL string `json:"auth_url"`
+}
+
+// IMAPAccountInput is the body of the link IMAP account endpoint
+type IMAPAccountInput struct {
+	Address  string `json:"address"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	TLS      bool   `json:"tls"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// callerID returns the ID of the authenticated user
+func callerID(r *http.Request) (int, bool) {
+	p, ok := middleware.PrincipalFromContext(r.Context())
+	return p.UserID, ok
+}
+
+// ListAccountsHandler retrieves the caller's linked mailboxes
+// @Summary List Linked Accounts
+// @Description Retrieve the mailboxes linked to the caller. Emails carry the account_id of the mailbox they came from.
+// @Tags accounts
+// @Produce json
+// @Success 200 {array} models.LinkedAccount
+// @Router /accounts [get]
+func (h *AccountHandler) ListAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	accounts, err := h.authService.ListAccounts(userID)
+	if err != nil {
+		h.log.Error("Failed to list accounts", "error", err)
+		http.Error(w, "Failed to list accounts", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, accounts)
+}
+
+// LinkAccountHandler starts linking another Google mailbox to the caller
+// @Summary Link Account
+// @Description Start the Google authorization of another mailbox. Open the returned auth_url in a browser within ten minutes and confirm the account the mailbox is linked to, it can be used once; the callback links the mailbox to the caller and returns to redirect_url with linked_account set, or responds with the account.
+// @Tags accounts
+// @Produce json
+// @Param redirect_url query string false "URL to return to after the authorization"
+// @Success 200 {object} LinkRequest
+// @Router /accounts/link [post]
+func (h *AccountHandler) LinkAccountHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ticket, err := h.authService.BeginLink(r.Context(), userID, r.URL.Query().Get("redirect_url"))
+	if errors.Is(err, authService.ErrInvalidRedirectURL) {
+		http.Error(w, "Invalid redirect URL", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to start account link", "error", err)
+		http.Error(w, "Failed to start account link", http.StatusInternalServerError)
+		return
+	}
+
+	// The browser opening the link is not the API client, it gets the state cookie from this server
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	authURL := url.URL{Scheme: scheme, Host: r.Host, Path: authHandlers.LinkPath, RawQuery: url.Values{"ticket": {ticket}}.Encode()}
+	h.writeJSON(w, http.StatusOK, LinkRequest{AuthURL: authURL.String()})
+}
+
+// LinkIMAPAccountHandler links an IMAP mailbox to the caller
+// @Summary Link IMAP Account
+// @Description Link an Outlook, Yandex or self-hosted mailbox over IMAP. The credentials are checked by logging in before the account is stored. Port defaults to 993 with TLS and 143 without.
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param account body IMAPAccountInput true "IMAP account"
+// @Success 201 {object} models.LinkedAccount
+// @Router /accounts/imap [post]
+func (h *AccountHandler) LinkIMAPAccountHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var in IMAPAccountInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if in.Host == "" || in.Username == "" || in.Password == "" {
+		http.Error(w, "host, username and password are required", http.StatusBadRequest)
+		return
+	}
+	if in.Port == 0 {
+		in.Port = 143
+		if in.TLS {
+			in.Port = 993
+		}
+	}
+
+	account, err := h.authService.LinkIMAPAccount(r.Context(), userID, in.Address, mailsource.IMAPConfig{
+		Host:     in.Host,
+		Port:     in.Port,
+		TLS:      in.TLS,
+		Username: in.Username,
+		Password: in.Password,
+	})
+	if errors.Is(err, authService.ErrIMAPLogin) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, authService.ErrAccountLinkedElsewhere) {
+		http.Error(w, "Mailbox is linked to another user", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to link IMAP account", "error", err)
+		http.Error(w, "Failed to link IMAP account", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, account)
+}
+
+// UnlinkAccountHandler disconnects one of the caller's mailboxes
+// @Summary Unlink Account
+// @Description Disconnect a mailbox and delete the emails stored from it
+// @Tags accounts
+// @Produce plain
+// @Param account_id path int true "Account ID"
+// @Success 200 {string} string "Account unlinked successfully"
+// @Router /accounts/{account_id} [delete]
+func (h *AccountHandler) UnlinkAccountHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	accountID, err := strconv.Atoi(mux.Vars(r)["account_id"])
+	if err != nil {
+		http.Error(w, "Invalid account ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.emailService.UnlinkAccount(userID, accountID)
+	if errors.Is(err, authService.ErrAccountNotFound) {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to unlink account", "error", err)
+		http.Error(w, "Failed to unlink account", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write([]byte("Account unlinked successfully"))
+	if err != nil {
+		return
+	}
+}
+
+// writeJSON encodes v as the JSON response body
+func (h *AccountHandler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Error("Failed to encode response", "error", err)
+	}
+}
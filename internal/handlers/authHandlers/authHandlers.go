@@ -1,10 +1,19 @@
 package authHandlers
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
 	"net/http"
-	"time"
+	"net/url"
+	"strconv"
 
+	"github.com/17HIERARCH70/SocialManager/internal/api/middleware"
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
 	"github.com/17HIERARCH70/SocialManager/internal/lib/jwt"
 	"github.com/17HIERARCH70/SocialManager/internal/services/authService"
 	"golang.org/x/oauth2"
@@ -20,34 +29,184 @@ func NewAuthHandler(authService *authService.AuthService) *AuthHandler {
 	return &AuthHandler{authService: authService}
 }
 
+// stateCookie is the cookie binding the OAuth state to the browser that started the login
+const stateCookie = "oauth_state"
+
 // GoogleLoginHandler initiates Google OAuth login
 // @Summary Google Login
-// @Description Initiate Google OAuth login
+// @Description Initiate Google OAuth login with a signed one-time state and PKCE. When redirect_url is set, the callback redirects there with a one-time login_code to exchange at /auth/exchange instead of returning the tokens. Loopback URLs and the configured auth.redirectURLs are allowed. With show_code=true the callback displays a short login code instead, for clients without a browser or a listener.
 // @Tags auth
 // @Produce json
-// @Success 200 {string} string "URL for Google login"
+// @Param redirect_url query string false "URL to return to after the login"
+// @Param show_code query bool false "Display a short login code after the login"
+// @Success 307 {string} string "Redirect to Google"
 // @Router /auth/google_login [get]
 func (h *AuthHandler) GoogleLoginHandler(w http.ResponseWriter, r *http.Request) {
-	url := h.authService.OAuthConfig().AuthCodeURL("state-token", oauth2.AccessTypeOffline, oauth2.ApprovalForce)
-	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+	showCode := r.URL.Query().Get("show_code") == "true"
+	login, err := h.authService.BeginLogin(r.Context(), r.URL.Query().Get("redirect_url"), showCode)
+	if errors.Is(err, authService.ErrInvalidRedirectURL) {
+		http.Error(w, "Invalid redirect URL", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.authService.Log.Error("Failed to start login", "error", err)
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	setStateCookie(w, r, login.Nonce)
+	http.Redirect(w, r, login.AuthURL, http.StatusTemporaryRedirect)
+}
+
+// LinkPath is the browser-facing endpoint opening the link tickets of /accounts/link
+const LinkPath = "/api/auth/google_link"
+
+// linkConfirmCookie carries the token of the link confirmation form. It is
+// SameSite=Strict, so that only the confirmation page served to this browser
+// can continue a link.
+const linkConfirmCookie = "link_confirm"
+
+// linkConfirmPage names the user a mailbox is linked to, so that nobody links
+// their mailbox to an account they were lured into by a foreign link ticket
+var linkConfirmPage = template.Must(template.New("link").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Link a mailbox</title></head>
+<body>
+<p>You are about to link a Google mailbox to the SocialManager account <b>{{.User}}</b>.</p>
+<p>Only continue if you started this link from that account: its owner will be able to read and delete the mail of the mailbox.</p>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="ticket" value="{{.Ticket}}">
+<input type="hidden" name="confirm" value="{{.Confirm}}">
+<button type="submit">Continue to Google</button>
+</form>
+</body>
+</html>
+`))
+
+// GoogleLinkHandler asks the browser to confirm the linking of a mailbox
+// @Summary Confirm Account Link
+// @Description Open a link ticket returned by /accounts/link in the browser: shows the account the mailbox will be linked to and asks to confirm before continuing to Google. Tickets expire with the authorization.
+// @Tags auth
+// @Produce html
+// @Param ticket query string true "Link ticket"
+// @Success 200 {string} string "Confirmation page"
+// @Failure 400 {string} string "Invalid or expired link"
+// @Router /auth/google_link [get]
+func (h *AuthHandler) GoogleLinkHandler(w http.ResponseWriter, r *http.Request) {
+	ticket := r.URL.Query().Get("ticket")
+	user, err := h.authService.LinkTarget(r.Context(), ticket)
+	if errors.Is(err, authService.ErrInvalidLinkTicket) {
+		http.Error(w, "Invalid or expired link", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.authService.Log.Error("Failed to open account link", "error", err)
+		http.Error(w, "Failed to open account link", http.StatusInternalServerError)
+		return
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		h.authService.Log.Error("Failed to create link confirmation", "error", err)
+		http.Error(w, "Failed to open account link", http.StatusInternalServerError)
+		return
+	}
+	confirm := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     linkConfirmCookie,
+		Value:    confirm,
+		Path:     LinkPath,
+		MaxAge:   int(jwt.StateTokenDuration.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	err = linkConfirmPage.Execute(w, map[string]string{"User": user, "Action": LinkPath, "Ticket": ticket, "Confirm": confirm})
+	if err != nil {
+		h.authService.Log.Error("Failed to render link confirmation", "error", err)
+	}
+}
+
+// GoogleLinkConfirmHandler continues a confirmed mailbox link to Google
+// @Summary Open Account Link
+// @Description Submitted by the confirmation page of /auth/google_link: binds the authorization to the browser and redirects to Google. Tickets can be opened once and the form is only accepted from the page served to the same browser.
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Param ticket formData string true "Link ticket"
+// @Param confirm formData string true "Confirmation token of the page"
+// @Success 303 {string} string "Redirect to Google"
+// @Failure 400 {string} string "Invalid or expired link"
+// @Router /auth/google_link [post]
+func (h *AuthHandler) GoogleLinkConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(linkConfirmCookie)
+	if err != nil || cookie.Value == "" ||
+		subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.PostFormValue("confirm"))) != 1 {
+		http.Error(w, "Invalid or expired link", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: linkConfirmCookie, Path: LinkPath, MaxAge: -1})
+
+	link, err := h.authService.OpenLink(r.Context(), r.PostFormValue("ticket"))
+	if errors.Is(err, authService.ErrInvalidLinkTicket) {
+		http.Error(w, "Invalid or expired link", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.authService.Log.Error("Failed to open account link", "error", err)
+		http.Error(w, "Failed to open account link", http.StatusInternalServerError)
+		return
+	}
+
+	setStateCookie(w, r, link.Nonce)
+	http.Redirect(w, r, link.AuthURL, http.StatusSeeOther)
+}
+
+// setStateCookie binds a pending Google authorization to the browser, the callback
+// only accepts a state whose nonce matches the cookie
+func setStateCookie(w http.ResponseWriter, r *http.Request, nonce string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    nonce,
+		Path:     "/api/auth",
+		MaxAge:   int(jwt.StateTokenDuration.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
 }
 
 // GoogleCallbackHandler handles Google OAuth callback
 // @Summary Google OAuth Callback
-// @Description Handle Google OAuth callback
+// @Description Handle Google OAuth callback. Returns the JWT pair, redirects to the redirect_url of the login with a login_code, or displays a short login code. When the authorization was started by /accounts/link, the mailbox is linked to the user instead and the account is returned, or its ID is passed to the redirect_url as linked_account.
 // @Tags auth
 // @Produce json
 // @Success 200 {object} map[string]string "JWT Tokens"
+// @Success 302 {string} string "Redirect with login_code"
 // @Router /auth/google_callback [get]
 func (h *AuthHandler) GoogleCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	state := r.URL.Query().Get("state")
-	if state != "state-token" {
+	var nonce string
+	if cookie, err := r.Cookie(stateCookie); err == nil {
+		nonce = cookie.Value
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/api/auth", MaxAge: -1})
+
+	login, err := h.authService.CompleteLogin(r.Context(), r.URL.Query().Get("state"), nonce)
+	if errors.Is(err, authService.ErrInvalidState) || errors.Is(err, authService.ErrInvalidRedirectURL) {
 		http.Error(w, "State parameter doesn't match", http.StatusBadRequest)
 		return
 	}
+	if err != nil {
+		h.authService.Log.Error("Failed to complete login", "error", err)
+		http.Error(w, "Failed to complete login", http.StatusInternalServerError)
+		return
+	}
 
 	code := r.URL.Query().Get("code")
-	token, err := h.authService.ExchangeToken(code)
+	token, err := h.authService.ExchangeToken(code, login.Verifier)
 	if err != nil {
 		h.authService.Log.Error("Failed to exchange token", "error", err)
 		http.Error(w, "Failed to exchange token", http.StatusInternalServerError)
@@ -61,40 +220,196 @@ func (h *AuthHandler) GoogleCallbackHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	userID, err := h.authService.SaveUserToDB(userInfo)
+	if login.LinkUserID != 0 {
+		h.completeLink(w, r, login, userInfo, token)
+		return
+	}
+
+	userID, role, err := h.authService.SaveUserToDB(userInfo)
 	if err != nil {
 		h.authService.Log.Error("Failed to save user to DB", "error", err)
 		http.Error(w, "Failed to save user to DB", http.StatusInternalServerError)
 		return
 	}
 
-	err = h.authService.SaveGoogleTokensToDB(userID, token)
+	email, _ := userInfo["email"].(string)
+	_, err = h.authService.LinkAccount(userID, models.ProviderGmail, userInfo["sub"].(string), email, token)
 	if err != nil {
 		h.authService.Log.Error("Failed to save Google tokens to DB", "error", err)
 		http.Error(w, "Failed to save Google tokens to DB", http.StatusInternalServerError)
 		return
 	}
 
-	authDetails := jwt.AuthDetails{
-		AuthUuid: userInfo["sub"].(string),
-		UserId:   uint64(userID),
+	jwtTokens, err := h.authService.IssueTokens(userID, userInfo["sub"].(string), role)
+	if err != nil {
+		h.authService.Log.Error("Failed to issue JWT tokens", "error", err)
+		http.Error(w, "Failed to issue JWT tokens", http.StatusInternalServerError)
+		return
 	}
 
-	jwtTokens, err := jwt.CreateTokenPair(authDetails)
+	switch {
+	case login.RedirectURL != "":
+		h.redirectWithLoginCode(w, r, login.RedirectURL, jwtTokens)
+		return
+	case login.ShowCode:
+		h.showLoginCode(w, r, jwtTokens)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(jwtTokens)
 	if err != nil {
-		h.authService.Log.Error("Failed to create JWT tokens", "error", err)
-		http.Error(w, "Failed to create JWT tokens", http.StatusInternalServerError)
+		h.authService.Log.Error("Failed to encode response", "error", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
 	}
+}
 
-	accessToken := jwtTokens["access_token"]
-	refreshToken := jwtTokens["refresh_token"]
-	expiresAt := time.Now().Add(15 * time.Minute)
+// completeLink links the authorized mailbox to the user who started the authorization
+func (h *AuthHandler) completeLink(w http.ResponseWriter, r *http.Request, login authService.LoginState, userInfo map[string]interface{}, token *oauth2.Token) {
+	email, _ := userInfo["email"].(string)
+	sub, _ := userInfo["sub"].(string)
+	account, err := h.authService.LinkAccount(login.LinkUserID, models.ProviderGmail, sub, email, token)
+	if errors.Is(err, authService.ErrAccountLinkedElsewhere) {
+		http.Error(w, "Mailbox is linked to another user", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.authService.Log.Error("Failed to link account", "error", err)
+		http.Error(w, "Failed to link account", http.StatusInternalServerError)
+		return
+	}
+
+	if login.RedirectURL != "" {
+		target, err := url.Parse(login.RedirectURL)
+		if err != nil {
+			http.Error(w, "Invalid redirect URL", http.StatusBadRequest)
+			return
+		}
+		values := target.Query()
+		values.Set("linked_account", strconv.Itoa(account.ID))
+		target.RawQuery = values.Encode()
+		http.Redirect(w, r, target.String(), http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(account)
+	if err != nil {
+		h.authService.Log.Error("Failed to encode response", "error", err)
+		return
+	}
+}
 
-	err = h.authService.SaveTokensToDB(userID, accessToken, refreshToken, expiresAt)
+// redirectWithLoginCode sends the browser back to the client with a one-time code for the JWT pair
+func (h *AuthHandler) redirectWithLoginCode(w http.ResponseWriter, r *http.Request, redirectURL string, jwtTokens map[string]string) {
+	code, err := h.authService.CreateLoginCode(r.Context(), jwtTokens)
 	if err != nil {
-		h.authService.Log.Error("Failed to save JWT tokens to DB", "error", err)
-		http.Error(w, "Failed to save JWT tokens to DB", http.StatusInternalServerError)
+		h.authService.Log.Error("Failed to create login code", "error", err)
+		http.Error(w, "Failed to create login code", http.StatusInternalServerError)
+		return
+	}
+
+	target, err := url.Parse(redirectURL)
+	if err != nil {
+		http.Error(w, "Invalid redirect URL", http.StatusBadRequest)
+		return
+	}
+	values := target.Query()
+	values.Set("login_code", code)
+	target.RawQuery = values.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// showLoginCode displays a short one-time code for the JWT pair to be typed into the client
+func (h *AuthHandler) showLoginCode(w http.ResponseWriter, r *http.Request, jwtTokens map[string]string) {
+	code, err := h.authService.CreateShortLoginCode(r.Context(), jwtTokens)
+	if err != nil {
+		h.authService.Log.Error("Failed to create login code", "error", err)
+		http.Error(w, "Failed to create login code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, err = fmt.Fprintf(w, "Login successful. Enter this code in the application: %s\nThe code expires in 2 minutes.\n", code)
+	if err != nil {
+		return
+	}
+}
+
+// ExchangeRequest is the body of the login code exchange endpoint
+type ExchangeRequest struct {
+	LoginCode string `json:"login_code"`
+}
+
+// ExchangeHandler returns the JWT pair of a login that redirected with a login code
+// @Summary Exchange Login Code
+// @Description Exchange the one-time login_code of a redirected login for the JWT pair. Codes expire after two minutes.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body ExchangeRequest true "Login code"
+// @Success 200 {object} map[string]string "JWT Tokens"
+// @Router /auth/exchange [post]
+func (h *AuthHandler) ExchangeHandler(w http.ResponseWriter, r *http.Request) {
+	var body ExchangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.LoginCode == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	jwtTokens, err := h.authService.ExchangeLoginCode(r.Context(), body.LoginCode)
+	if errors.Is(err, authService.ErrInvalidLoginCode) {
+		http.Error(w, "Invalid login code", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		h.authService.Log.Error("Failed to exchange login code", "error", err)
+		http.Error(w, "Failed to exchange login code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(jwtTokens)
+	if err != nil {
+		h.authService.Log.Error("Failed to encode response", "error", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// RefreshRequest is the body of the refresh endpoint
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshHandler exchanges a refresh token for a new JWT pair
+// @Summary Refresh Tokens
+// @Description Exchange a refresh token for a new access and refresh token pair. Every refresh token can be used once; presenting a spent token again revokes all tokens rotated from the same login.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body RefreshRequest true "Refresh token"
+// @Success 200 {object} map[string]string "JWT Tokens"
+// @Router /auth/refresh [post]
+func (h *AuthHandler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var body RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RefreshToken == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	jwtTokens, err := h.authService.RefreshTokens(body.RefreshToken)
+	if errors.Is(err, jwt.ErrInvalidRefreshToken) || errors.Is(err, authService.ErrRefreshTokenReused) {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		h.authService.Log.Error("Failed to refresh tokens", "error", err)
+		http.Error(w, "Failed to refresh tokens", http.StatusInternalServerError)
 		return
 	}
 
@@ -106,3 +421,59 @@ func (h *AuthHandler) GoogleCallbackHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 }
+
+// LogoutHandler revokes the caller's session
+// @Summary Logout
+// @Description Revoke the access and refresh tokens of the caller's session
+// @Tags auth
+// @Produce plain
+// @Success 200 {string} string "Logged out successfully"
+// @Router /auth/logout [post]
+func (h *AuthHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok || p.SessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := h.authService.Logout(p.UserID, p.SessionID)
+	if err != nil {
+		h.authService.Log.Error("Failed to logout", "error", err)
+		http.Error(w, "Failed to logout", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write([]byte("Logged out successfully"))
+	if err != nil {
+		return
+	}
+}
+
+// LogoutAllHandler revokes every session of the caller
+// @Summary Logout All Devices
+// @Description Revoke the access and refresh tokens of all the caller's sessions
+// @Tags auth
+// @Produce plain
+// @Success 200 {string} string "Logged out from all devices successfully"
+// @Router /auth/logout_all [post]
+func (h *AuthHandler) LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := h.authService.LogoutAll(p.UserID)
+	if err != nil {
+		h.authService.Log.Error("Failed to logout from all devices", "error", err)
+		http.Error(w, "Failed to logout from all devices", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write([]byte("Logged out from all devices successfully"))
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,153 @@
+package discordHandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/17HIERARCH70/SocialManager/internal/api/middleware"
+	"github.com/17HIERARCH70/SocialManager/internal/services/discordService"
+	"github.com/gorilla/mux"
+	"golang.org/x/exp/slog"
+)
+
+// DiscordHandler handles Discord channel requests
+type DiscordHandler struct {
+	discordService *discordService.DiscordService
+	log            *slog.Logger
+}
+
+// NewDiscordHandler creates a new DiscordHandler
+func NewDiscordHandler(discordService *discordService.DiscordService, log *slog.Logger) *DiscordHandler {
+	return &DiscordHandler{
+		discordService: discordService,
+		log:            log,
+	}
+}
+
+// ChannelInput is the body of the create channel endpoint
+type ChannelInput struct {
+	Name       string `json:"name"`
+	WebhookURL string `json:"webhook_url"`
+	ChannelID  string `json:"channel_id"`
+	AllEmails  bool   `json:"all_emails"`
+}
+
+// callerID returns the ID of the authenticated user
+func callerID(r *http.Request) (int, bool) {
+	p, ok := middleware.PrincipalFromContext(r.Context())
+	return p.UserID, ok
+}
+
+// ListChannelsHandler retrieves the caller's Discord channels
+// @Summary List Discord Channels
+// @Description Retrieve the Discord channels receiving the caller's notifications
+// @Tags discord
+// @Produce json
+// @Success 200 {array} models.DiscordChannel
+// @Router /discord/channels [get]
+func (h *DiscordHandler) ListChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	channels, err := h.discordService.ListChannels(userID)
+	if err != nil {
+		h.log.Error("Failed to list Discord channels", "error", err)
+		http.Error(w, "Failed to list Discord channels", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, channels)
+}
+
+// CreateChannelHandler registers a Discord channel for the caller
+// @Summary Create Discord Channel
+// @Description Register a Discord webhook URL or, when the bot is configured, a channel ID. Only admins can register channel IDs, as the bot posts to any channel it can see. With all_emails every new email is posted, otherwise only emails matched by a filter with the notify action.
+// @Tags discord
+// @Accept json
+// @Produce json
+// @Param channel body ChannelInput true "Channel"
+// @Success 201 {object} models.DiscordChannel
+// @Failure 403 {string} string "Only admins can register bot channels"
+// @Router /discord/channels [post]
+func (h *DiscordHandler) CreateChannelHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var in ChannelInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	channel, err := h.discordService.CreateChannel(p.UserID, p.IsAdmin(), in.Name, in.WebhookURL, in.ChannelID, in.AllEmails)
+	if errors.Is(err, discordService.ErrInvalidChannel) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, discordService.ErrBotChannelForbidden) {
+		http.Error(w, "Only admins can register bot channels", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to create Discord channel", "error", err)
+		http.Error(w, "Failed to create Discord channel", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, channel)
+}
+
+// DeleteChannelHandler removes one of the caller's Discord channels
+// @Summary Delete Discord Channel
+// @Description Stop delivering notifications to a Discord channel
+// @Tags discord
+// @Produce plain
+// @Param channel_id path int true "Channel ID"
+// @Success 200 {string} string "Discord channel deleted successfully"
+// @Router /discord/channels/{channel_id} [delete]
+func (h *DiscordHandler) DeleteChannelHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	channelID, err := strconv.Atoi(mux.Vars(r)["channel_id"])
+	if err != nil {
+		http.Error(w, "Invalid channel ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.discordService.DeleteChannel(userID, channelID)
+	if errors.Is(err, discordService.ErrChannelNotFound) {
+		http.Error(w, "Discord channel not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to delete Discord channel", "error", err)
+		http.Error(w, "Failed to delete Discord channel", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write([]byte("Discord channel deleted successfully"))
+	if err != nil {
+		return
+	}
+}
+
+// writeJSON encodes v as the JSON response body
+func (h *DiscordHandler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Error("Failed to encode response", "error", err)
+	}
+}
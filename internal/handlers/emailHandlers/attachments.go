@@ -0,0 +1,158 @@
+package emailHandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/services/emailService"
+	"github.com/gorilla/mux"
+)
+
+// ListAttachmentsHandler retrieves the attachment metadata of an email
+// @Summary List Email Attachments
+// @Description Retrieve the attachments of an email by its local ID. Users may only list their own emails, admins any. The content is downloaded from /attachments/{attachment_id}.
+// @Tags attachments
+// @Produce json
+// @Param email_id path int true "Local email ID"
+// @Success 200 {array} models.Attachment
+// @Failure 404 {string} string "Email not found"
+// @Router /emails/{email_id}/attachments [get]
+func (h *EmailHandler) ListAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	emailID, err := strconv.Atoi(mux.Vars(r)["email_id"])
+	if err != nil {
+		http.Error(w, "Invalid email ID", http.StatusBadRequest)
+		return
+	}
+
+	var owner *int
+	if !p.IsAdmin() {
+		owner = &p.UserID
+	}
+	attachments, err := h.emailService.ListAttachments(owner, emailID)
+	if errors.Is(err, emailService.ErrEmailNotFound) {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to list attachments", "error", err)
+		http.Error(w, "Failed to list attachments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(attachments)
+	if err != nil {
+		h.log.Error("Failed to encode response", "error", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// DownloadAttachmentHandler streams the content of an attachment
+// @Summary Download Attachment
+// @Description Download the decoded content of an attachment with its MIME type and file name. Users may only download attachments of their own emails, admins any. Content not downloaded yet is fetched from the mailbox first. Range requests are supported to resume downloads and seek in media.
+// @Tags attachments
+// @Produce octet-stream
+// @Param attachment_id path int true "Attachment ID"
+// @Param Range header string false "Byte range, e.g. bytes=0-1023"
+// @Success 200 {file} file "Attachment content"
+// @Success 206 {file} file "Requested byte range"
+// @Failure 404 {string} string "Attachment not found"
+// @Failure 416 {string} string "Range not satisfiable"
+// @Router /attachments/{attachment_id} [get]
+func (h *EmailHandler) DownloadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["attachment_id"])
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+
+	var owner *int
+	if !p.IsAdmin() {
+		owner = &p.UserID
+	}
+	attachment, content, err := h.emailService.OpenAttachment(r.Context(), owner, id)
+	if errors.Is(err, emailService.ErrAttachmentNotFound) {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to open attachment", "error", err)
+		http.Error(w, "Failed to open attachment", http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	contentType := attachment.MimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	// The content is immutable, its hash is a strong validator
+	w.Header().Set("ETag", strconv.Quote(attachment.SHA256))
+	// Never let browsers render attachments as pages of this origin
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+
+	http.ServeContent(w, r, attachment.Filename, time.Time{}, content)
+}
+
+// InlineAttachmentHandler serves an inline image of an email body
+// @Summary Inline Image
+// @Description Serve an image a body references by its Content-ID. The URLs replace the cid: sources in body and body_safe and are signed for a limited time, which lets img tags load them without an access token. Only raster images are served.
+// @Tags attachments
+// @Produce image/png,image/jpeg,image/gif,image/webp
+// @Param attachment_id path int true "Attachment ID"
+// @Param email query int true "ID of the email the image belongs to"
+// @Param user query int true "ID of the user owning the email"
+// @Param expires query int true "Expiry of the URL, in Unix seconds"
+// @Param sig query string true "Signature of the URL"
+// @Success 200 {file} file "Image content"
+// @Failure 403 {string} string "Invalid or expired URL"
+// @Failure 404 {string} string "Attachment not found"
+// @Router /attachments/{attachment_id}/inline [get]
+func (h *EmailHandler) InlineAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["attachment_id"])
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	attachment, content, err := h.emailService.OpenInlineAttachment(r.Context(), id, query.Get("email"), query.Get("user"), query.Get("expires"), query.Get("sig"))
+	switch {
+	case errors.Is(err, emailService.ErrInvalidInlineURL):
+		http.Error(w, "Invalid or expired URL", http.StatusForbidden)
+		return
+	case errors.Is(err, emailService.ErrAttachmentNotFound):
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	case err != nil:
+		h.log.Error("Failed to open inline attachment", "error", err)
+		http.Error(w, "Failed to open attachment", http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", attachment.MimeType)
+	w.Header().Set("Content-Disposition", "inline")
+	w.Header().Set("ETag", strconv.Quote(attachment.SHA256))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+
+	http.ServeContent(w, r, "", time.Time{}, content)
+}
@@ -2,11 +2,17 @@ package emailHandlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
 	"golang.org/x/exp/slog"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/17HIERARCH70/SocialManager/internal/api/middleware"
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/searchquery"
 	"github.com/17HIERARCH70/SocialManager/internal/services/emailService"
 )
 
@@ -24,15 +30,33 @@ func NewEmailHandler(emailService *emailService.EmailService, log *slog.Logger)
 	}
 }
 
+// principal returns the authenticated caller and answers 401 when there is none
+func principal(w http.ResponseWriter, r *http.Request) (middleware.Principal, bool) {
+	p, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}
+	return p, ok
+}
+
 // UpdateEmailsHandler updates all emails
 // @Summary Update Emails
-// @Description Update all emails
+// @Description Update the emails of all users. Admin only.
 // @Tags emails
 // @Produce plain
 // @Success 200 {string} string "Emails updated successfully"
 // @Router /emails/update [put]
 func (h *EmailHandler) UpdateEmailsHandler(w http.ResponseWriter, r *http.Request) {
-	err := h.emailService.UpdateAllEmails()
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	if !p.IsAdmin() {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	err := h.emailService.UpdateAllEmails(r.Context())
 	if err != nil {
 		h.log.Error("Failed to update all emails", "error", err)
 		http.Error(w, "Failed to update emails", http.StatusInternalServerError)
@@ -47,53 +71,168 @@ func (h *EmailHandler) UpdateEmailsHandler(w http.ResponseWriter, r *http.Reques
 
 // GetEmailsByUserIDHandler retrieves emails by user ID
 // @Summary Get Emails by User ID
-// @Description Retrieve emails by user ID
+// @Description Retrieve one page of a user's emails. Users may only list their own mailbox, admins any. The total number of matching emails is returned in the X-Total-Count header and the cursor of the next page in the X-Next-Cursor and Link headers.
 // @Tags emails
 // @Produce json
 // @Param user_id path int true "User ID"
+// @Param account_id query int false "Only emails of one linked account"
+// @Param sender query string false "Sender substring"
+// @Param subject query string false "Subject substring"
+// @Param after query string false "Sent at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param before query string false "Sent before (RFC 3339 or YYYY-MM-DD)"
+// @Param has_attachment query bool false "Only emails with (true) or without (false) attachments"
+// @Param is_read query bool false "Only read (true) or unread (false) emails"
+// @Param sort query string false "Sort field: sended_at, id, sender or subject, prefixed with - for descending order" default(-sended_at)
+// @Param cursor query string false "Cursor of the page returned in X-Next-Cursor"
+// @Param limit query int false "Page size (max 500)" default(50)
 // @Success 200 {array} models.Email
+// @Header 200 {integer} X-Total-Count "Total number of matching emails"
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page"
 // @Router /emails/user/{user_id} [get]
 func (h *EmailHandler) GetEmailsByUserIDHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
 	userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
 	if err != nil {
 		h.log.Error("Invalid user ID", "error", err)
 		http.Error(w, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
-
-	emails, err := h.emailService.GetEmailsByUserID(userID)
-	if err != nil {
-		h.log.Error("Failed to get emails", "error", err)
-		http.Error(w, "Failed to get emails", http.StatusInternalServerError)
+	if !p.CanAccess(userID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(emails)
+	query, err := parseEmailQuery(r)
 	if err != nil {
-		h.log.Error("Failed to encode response", "error", err)
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	query.UserID = &userID
+
+	h.writeEmailPage(w, r, query)
 }
 
 // GetAllEmailsHandler retrieves all emails
 // @Summary Get All Emails
-// @Description Retrieve all emails
+// @Description Retrieve one page of the emails of all users. Admin only. Accepts the same filters, sorting and pagination as the per-user listing.
 // @Tags emails
 // @Produce json
+// @Param account_id query int false "Only emails of one linked account"
+// @Param sender query string false "Sender substring"
+// @Param subject query string false "Subject substring"
+// @Param after query string false "Sent at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param before query string false "Sent before (RFC 3339 or YYYY-MM-DD)"
+// @Param has_attachment query bool false "Only emails with (true) or without (false) attachments"
+// @Param is_read query bool false "Only read (true) or unread (false) emails"
+// @Param sort query string false "Sort field: sended_at, id, sender or subject, prefixed with - for descending order" default(-sended_at)
+// @Param cursor query string false "Cursor of the page returned in X-Next-Cursor"
+// @Param limit query int false "Page size (max 500)" default(50)
 // @Success 200 {array} models.Email
+// @Header 200 {integer} X-Total-Count "Total number of matching emails"
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page"
 // @Router /emails [get]
 func (h *EmailHandler) GetAllEmailsHandler(w http.ResponseWriter, r *http.Request) {
-	emails, err := h.emailService.GetAllEmails()
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	if !p.IsAdmin() {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	query, err := parseEmailQuery(r)
 	if err != nil {
-		h.log.Error("Failed to get all emails", "error", err)
-		http.Error(w, "Failed to get all emails", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.writeEmailPage(w, r, query)
+}
+
+// SearchEmailsHandler runs a full-text search over the stored emails
+// @Summary Search Emails
+// @Description Full-text search over subject, sender and body. Supports the Gmail-like operators from:, subject:, has:attachment, is:read, is:unread, before: and after: (YYYY/MM/DD). Free text accepts "quoted phrases", OR and -excluded words. The snippet is HTML-escaped text with the matches highlighted by <mark>. Users search their own mailbox, admins all mailboxes unless user_id is set.
+// @Tags emails
+// @Produce json
+// @Param q query string true "Search query"
+// @Param user_id query int false "Restrict the search to one user's mailbox"
+// @Param account_id query int false "Restrict the search to one linked account"
+// @Param limit query int false "Page size (max 500)" default(50)
+// @Param offset query int false "Number of results to skip" default(0)
+// @Success 200 {array} models.SearchResult
+// @Header 200 {integer} X-Total-Count "Total number of matching emails"
+// @Router /emails/search [get]
+func (h *EmailHandler) SearchEmailsHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	values := r.URL.Query()
+
+	query, err := searchquery.Parse(values.Get("q"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.IsEmpty() {
+		http.Error(w, "Search query is required", http.StatusBadRequest)
+		return
+	}
+
+	var userID *int
+	if v := values.Get("user_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		if !p.CanAccess(id) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		userID = &id
+	} else if !p.IsAdmin() {
+		userID = &p.UserID
+	}
+
+	var accountID *int
+	if v := values.Get("account_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid account ID", http.StatusBadRequest)
+			return
+		}
+		accountID = &id
+	}
+
+	var limit, offset int
+	if v := values.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := values.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	results, total, err := h.emailService.SearchEmails(userID, accountID, query, limit, offset)
+	if err != nil {
+		h.log.Error("Failed to search emails", "error", err)
+		http.Error(w, "Failed to search emails", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(emails)
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	err = json.NewEncoder(w).Encode(results)
 	if err != nil {
 		h.log.Error("Failed to encode response", "error", err)
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
@@ -101,22 +240,143 @@ func (h *EmailHandler) GetAllEmailsHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// writeEmailPage runs the listing query and writes the page with its pagination headers
+func (h *EmailHandler) writeEmailPage(w http.ResponseWriter, r *http.Request, query models.EmailQuery) {
+	page, err := h.emailService.ListEmails(query)
+	if errors.Is(err, emailService.ErrInvalidSort) || errors.Is(err, emailService.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to get emails", "error", err)
+		http.Error(w, "Failed to get emails", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		next := *r.URL
+		values := next.Query()
+		values.Set("cursor", page.NextCursor)
+		next.RawQuery = values.Encode()
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+
+	err = json.NewEncoder(w).Encode(page.Emails)
+	if err != nil {
+		h.log.Error("Failed to encode response", "error", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseEmailQuery reads the listing filters, sorting and pagination from the query string
+func parseEmailQuery(r *http.Request) (models.EmailQuery, error) {
+	values := r.URL.Query()
+	query := models.EmailQuery{
+		Sender:  values.Get("sender"),
+		Subject: values.Get("subject"),
+		Sort:    values.Get("sort"),
+		Cursor:  values.Get("cursor"),
+	}
+
+	var err error
+	if v := values.Get("account_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return query, fmt.Errorf("invalid account_id: %s", v)
+		}
+		query.AccountID = &id
+	}
+	if v := values.Get("after"); v != "" {
+		if query.SendedAfter, err = parseDate(v); err != nil {
+			return query, fmt.Errorf("invalid after date: %s", v)
+		}
+	}
+	if v := values.Get("before"); v != "" {
+		if query.SendedBefore, err = parseDate(v); err != nil {
+			return query, fmt.Errorf("invalid before date: %s", v)
+		}
+	}
+	if v := values.Get("has_attachment"); v != "" {
+		if query.HasAttachment, err = parseBool(v); err != nil {
+			return query, fmt.Errorf("invalid has_attachment value: %s", v)
+		}
+	}
+	if v := values.Get("is_read"); v != "" {
+		if query.IsRead, err = parseBool(v); err != nil {
+			return query, fmt.Errorf("invalid is_read value: %s", v)
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		query.Limit, err = strconv.Atoi(v)
+		if err != nil || query.Limit <= 0 {
+			return query, fmt.Errorf("invalid limit: %s", v)
+		}
+	}
+	return query, nil
+}
+
+// parseDate accepts either an RFC 3339 timestamp or a YYYY-MM-DD date and returns it in UTC
+func parseDate(v string) (*time.Time, error) {
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+// parseBool parses an optional boolean query parameter
+func parseBool(v string) (*bool, error) {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
 // GetUserIDByEmailHandler retrieves user ID by email
 // @Summary Get User ID by Email
-// @Description Retrieve user ID by email
+// @Description Retrieve user ID by email. Users may only look up their own login or linked addresses, any other address is reported as not found; admins may look up any.
 // @Tags emails
 // @Produce json
 // @Param email query string true "Email"
 // @Success 200 {object} map[string]int "user_id"
+// @Failure 404 {string} string "User not found"
 // @Router /emails/user [get]
 func (h *EmailHandler) GetUserIDByEmailHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
 	email := r.URL.Query().Get("email")
 	if email == "" {
 		http.Error(w, "Email is required", http.StatusBadRequest)
 		return
 	}
 
-	userID, err := h.emailService.GetUserIDByEmail(email)
+	// Users never learn whether someone else's address is registered
+	userID := p.UserID
+	var err error
+	if p.IsAdmin() {
+		userID, err = h.emailService.GetUserIDByEmail(email)
+	} else {
+		var owned bool
+		owned, err = h.emailService.OwnsAddress(p.UserID, email)
+		if err == nil && !owned {
+			err = emailService.ErrUserNotFound
+		}
+	}
+	if errors.Is(err, emailService.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		h.log.Error("Failed to get user ID", "error", err)
 		http.Error(w, "Failed to get user ID", http.StatusInternalServerError)
@@ -134,20 +394,32 @@ func (h *EmailHandler) GetUserIDByEmailHandler(w http.ResponseWriter, r *http.Re
 
 // DeleteEmailByIDHandler deletes an email by ID
 // @Summary Delete Email by ID
-// @Description Delete an email by its ID
+// @Description Delete an email by its Gmail ID. Users may only delete their own emails, admins any.
 // @Tags emails
 // @Produce plain
 // @Param email_id path string true "Email ID"
 // @Success 200 {string} string "Email deleted successfully"
 // @Router /emails/{email_id} [delete]
 func (h *EmailHandler) DeleteEmailByIDHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
 	emailID := mux.Vars(r)["email_id"]
 	if emailID == "" {
 		http.Error(w, "Email ID is required", http.StatusBadRequest)
 		return
 	}
 
-	err := h.emailService.DeleteEmailByID(emailID)
+	var owner *int
+	if !p.IsAdmin() {
+		owner = &p.UserID
+	}
+	err := h.emailService.DeleteEmailByID(owner, emailID)
+	if errors.Is(err, emailService.ErrEmailNotFound) {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		h.log.Error("Failed to delete email", "error", err)
 		http.Error(w, "Failed to delete email", http.StatusInternalServerError)
@@ -163,19 +435,27 @@ func (h *EmailHandler) DeleteEmailByIDHandler(w http.ResponseWriter, r *http.Req
 
 // DeleteAllEmailsByUserIDHandler deletes all emails by user ID
 // @Summary Delete All Emails by User ID
-// @Description Delete all emails by user ID
+// @Description Delete all emails by user ID. Users may only wipe their own mailbox, admins any.
 // @Tags emails
 // @Produce plain
 // @Param user_id path int true "User ID"
 // @Success 200 {string} string "All emails deleted successfully"
 // @Router /emails/user/{user_id} [delete]
 func (h *EmailHandler) DeleteAllEmailsByUserIDHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
 	userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
 	if err != nil {
 		h.log.Error("Invalid user ID", "error", err)
 		http.Error(w, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
+	if !p.CanAccess(userID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 
 	err = h.emailService.DeleteAllEmailsByUserID(userID)
 	if err != nil {
@@ -0,0 +1,48 @@
+package emailHandlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/17HIERARCH70/SocialManager/internal/lib/imageproxy"
+	"github.com/17HIERARCH70/SocialManager/internal/services/emailService"
+)
+
+// ProxyImageHandler serves a remote image referenced by a sanitized email body
+// @Summary Proxy Remote Image
+// @Description Fetch a remote image of an email on behalf of the client, so the sender never sees the reader's address. The URLs are generated by the sanitizer in body_safe and signed, which lets img tags load them without an access token. Only raster images below the configured size are served.
+// @Tags emails
+// @Produce image/png,image/jpeg,image/gif,image/webp
+// @Param url query string true "Remote image URL"
+// @Param sig query string true "Signature of the URL"
+// @Success 200 {file} file "Image content"
+// @Failure 403 {string} string "Invalid signature"
+// @Failure 404 {string} string "Remote images are blocked"
+// @Failure 502 {string} string "Failed to fetch image"
+// @Router /images/proxy [get]
+func (h *EmailHandler) ProxyImageHandler(w http.ResponseWriter, r *http.Request) {
+	src, sig := r.URL.Query().Get("url"), r.URL.Query().Get("sig")
+	image, err := h.emailService.ProxyImage(r.Context(), src, sig)
+	switch {
+	case errors.Is(err, emailService.ErrImagesBlocked):
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	case errors.Is(err, imageproxy.ErrBadSignature):
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	case err != nil:
+		h.log.Warn("Failed to proxy image", "url", src, "error", err)
+		http.Error(w, "Failed to fetch image", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", image.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(image.Data)))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	if _, err := w.Write(image.Data); err != nil {
+		h.log.Error("Failed to write image", "error", err)
+	}
+}
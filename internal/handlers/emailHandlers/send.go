@@ -0,0 +1,115 @@
+package emailHandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/services/authService"
+	"github.com/17HIERARCH70/SocialManager/internal/services/emailService"
+	"github.com/gorilla/mux"
+)
+
+// maxSendBody bounds the size of an outgoing email request. Gmail accepts
+// messages up to 35 MB, which base64 attachments inflate by a third.
+const maxSendBody = 48 << 20
+
+// SendEmailHandler sends a new email from one of the caller's Gmail accounts
+// @Summary Send Email
+// @Description Send an email from a linked Gmail account, the first one unless account_id is set, and record it locally. Attachment contents are base64-encoded. Accounts that did not grant the permission to send, including those linked before sending was supported, have to be linked again.
+// @Tags emails
+// @Accept json
+// @Produce json
+// @Param email body models.OutgoingEmail true "Email to send"
+// @Success 201 {object} models.Email
+// @Failure 400 {string} string "Invalid email"
+// @Failure 403 {string} string "Sending is not permitted for the account"
+// @Failure 404 {string} string "Account not found"
+// @Router /emails/send [post]
+func (h *EmailHandler) SendEmailHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+
+	var out models.OutgoingEmail
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSendBody)).Decode(&out); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	email, err := h.emailService.SendEmail(r.Context(), p.UserID, out)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+	h.writeSent(w, email)
+}
+
+// ReplyEmailHandler answers one of the caller's emails
+// @Summary Reply to Email
+// @Description Reply to an email from the Gmail account it was received in, in the same thread. Without recipients the reply goes to the Reply-To or sender of the email, joined by its other recipients with reply_all; without a subject it is the original one prefixed with "Re:".
+// @Tags emails
+// @Accept json
+// @Produce json
+// @Param email_id path int true "Email ID"
+// @Param email body models.OutgoingEmail true "Reply"
+// @Success 201 {object} models.Email
+// @Failure 400 {string} string "Invalid email"
+// @Failure 403 {string} string "Sending is not permitted for the account"
+// @Failure 404 {string} string "Email not found"
+// @Router /emails/{email_id}/reply [post]
+func (h *EmailHandler) ReplyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["email_id"])
+	if err != nil {
+		http.Error(w, "Invalid email ID", http.StatusBadRequest)
+		return
+	}
+
+	var out models.OutgoingEmail
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSendBody)).Decode(&out); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	email, err := h.emailService.ReplyToEmail(r.Context(), p.UserID, id, out)
+	if errors.Is(err, emailService.ErrEmailNotFound) {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+	h.writeSent(w, email)
+}
+
+// sendError reports a failure to send an email
+func (h *EmailHandler) sendError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, emailService.ErrInvalidOutgoing), errors.Is(err, emailService.ErrSendUnsupported):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, emailService.ErrSendNotPermitted):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, authService.ErrAccountNotFound):
+		http.Error(w, "Account not found", http.StatusNotFound)
+	default:
+		h.log.Error("Failed to send email", "error", err)
+		http.Error(w, "Failed to send email", http.StatusInternalServerError)
+	}
+}
+
+// writeSent responds with the sent email
+func (h *EmailHandler) writeSent(w http.ResponseWriter, email models.Email) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(email); err != nil {
+		h.log.Error("Failed to encode response", "error", err)
+	}
+}
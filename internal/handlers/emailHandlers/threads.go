@@ -0,0 +1,142 @@
+package emailHandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/17HIERARCH70/SocialManager/internal/services/emailService"
+	"github.com/gorilla/mux"
+)
+
+// ListThreadsHandler retrieves the conversations of a mailbox
+// @Summary List Threads
+// @Description Retrieve the email threads, the most recently active first, with their participants, message and unread counts. Users list their own threads, admins all threads unless user_id is set.
+// @Tags threads
+// @Produce json
+// @Param user_id query int false "Restrict the listing to one user's mailbox"
+// @Param account_id query int false "Restrict the listing to one linked account"
+// @Param unread query bool false "Only threads with unread emails"
+// @Param limit query int false "Page size (max 500)" default(50)
+// @Param offset query int false "Number of threads to skip" default(0)
+// @Success 200 {array} models.Thread
+// @Header 200 {integer} X-Total-Count "Total number of matching threads"
+// @Router /threads [get]
+func (h *EmailHandler) ListThreadsHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	values := r.URL.Query()
+
+	var userID *int
+	if v := values.Get("user_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		if !p.CanAccess(id) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		userID = &id
+	} else if !p.IsAdmin() {
+		userID = &p.UserID
+	}
+
+	var accountID *int
+	if v := values.Get("account_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid account ID", http.StatusBadRequest)
+			return
+		}
+		accountID = &id
+	}
+
+	var unread bool
+	if v := values.Get("unread"); v != "" {
+		var err error
+		if unread, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "Invalid unread flag", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var limit, offset int
+	var err error
+	if v := values.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := values.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	threads, total, err := h.emailService.ListThreads(userID, accountID, unread, limit, offset)
+	if err != nil {
+		h.log.Error("Failed to list threads", "error", err)
+		http.Error(w, "Failed to list threads", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	err = json.NewEncoder(w).Encode(threads)
+	if err != nil {
+		h.log.Error("Failed to encode response", "error", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetThreadHandler retrieves a conversation with its emails
+// @Summary Get Thread
+// @Description Retrieve a thread with its emails in the order they were sent, its participants and unread count. Users may only read their own threads, admins any.
+// @Tags threads
+// @Produce json
+// @Param thread_id path int true "Thread ID"
+// @Success 200 {object} models.Thread
+// @Failure 404 {string} string "Thread not found"
+// @Router /threads/{thread_id} [get]
+func (h *EmailHandler) GetThreadHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["thread_id"])
+	if err != nil {
+		http.Error(w, "Invalid thread ID", http.StatusBadRequest)
+		return
+	}
+
+	var owner *int
+	if !p.IsAdmin() {
+		owner = &p.UserID
+	}
+	thread, err := h.emailService.GetThread(owner, id)
+	if errors.Is(err, emailService.ErrThreadNotFound) {
+		http.Error(w, "Thread not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to get thread", "error", err)
+		http.Error(w, "Failed to get thread", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(thread)
+	if err != nil {
+		h.log.Error("Failed to encode response", "error", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
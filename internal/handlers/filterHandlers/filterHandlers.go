@@ -0,0 +1,254 @@
+package filterHandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/17HIERARCH70/SocialManager/internal/api/middleware"
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/services/filterService"
+	"github.com/gorilla/mux"
+	"golang.org/x/exp/slog"
+)
+
+// FilterHandler handles filter-related requests
+type FilterHandler struct {
+	filterService *filterService.FilterService
+	log           *slog.Logger
+}
+
+// NewFilterHandler creates a new FilterHandler
+func NewFilterHandler(filterService *filterService.FilterService, log *slog.Logger) *FilterHandler {
+	return &FilterHandler{
+		filterService: filterService,
+		log:           log,
+	}
+}
+
+// FilterInput is the body of the create and update filter endpoints
+type FilterInput struct {
+	Name           string                   `json:"name"`
+	Enabled        *bool                    `json:"enabled"`
+	Priority       int                      `json:"priority"`
+	MatchAll       *bool                    `json:"match_all"`
+	StopProcessing bool                     `json:"stop_processing"`
+	Conditions     []models.FilterCondition `json:"conditions"`
+	Actions        []models.FilterAction    `json:"actions"`
+}
+
+// toFilter converts the input into a filter, enabling it and requiring all conditions by default
+func (in FilterInput) toFilter(userID int) models.Filter {
+	f := models.Filter{
+		UserID:         userID,
+		Name:           in.Name,
+		Enabled:        true,
+		Priority:       in.Priority,
+		MatchAll:       true,
+		StopProcessing: in.StopProcessing,
+		Conditions:     in.Conditions,
+		Actions:        in.Actions,
+	}
+	if in.Enabled != nil {
+		f.Enabled = *in.Enabled
+	}
+	if in.MatchAll != nil {
+		f.MatchAll = *in.MatchAll
+	}
+	return f
+}
+
+// callerID returns the ID of the authenticated user
+func callerID(r *http.Request) (int, bool) {
+	p, ok := middleware.PrincipalFromContext(r.Context())
+	return p.UserID, ok
+}
+
+// ListFiltersHandler retrieves the caller's filters
+// @Summary List Filters
+// @Description Retrieve the caller's filters in evaluation order
+// @Tags filters
+// @Produce json
+// @Success 200 {array} models.Filter
+// @Router /filters [get]
+func (h *FilterHandler) ListFiltersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	filters, err := h.filterService.ListFilters(userID)
+	if err != nil {
+		h.log.Error("Failed to list filters", "error", err)
+		http.Error(w, "Failed to list filters", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, filters)
+}
+
+// GetFilterHandler retrieves one of the caller's filters
+// @Summary Get Filter
+// @Description Retrieve a filter by its ID
+// @Tags filters
+// @Produce json
+// @Param filter_id path int true "Filter ID"
+// @Success 200 {object} models.Filter
+// @Router /filters/{filter_id} [get]
+func (h *FilterHandler) GetFilterHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	filterID, err := strconv.Atoi(mux.Vars(r)["filter_id"])
+	if err != nil {
+		http.Error(w, "Invalid filter ID", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := h.filterService.GetFilter(userID, filterID)
+	if errors.Is(err, filterService.ErrFilterNotFound) {
+		http.Error(w, "Filter not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to get filter", "error", err)
+		http.Error(w, "Failed to get filter", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, filter)
+}
+
+// CreateFilterHandler creates a filter for the caller
+// @Summary Create Filter
+// @Description Create a filter. Conditions test the sender, subject, body or attachment fields with the contains (any keyword, case-insensitive) or regex operators; actions are notify, tag or delete, which moves the email to the trash of its mailbox.
+// @Tags filters
+// @Accept json
+// @Produce json
+// @Param filter body FilterInput true "Filter"
+// @Success 201 {object} models.Filter
+// @Router /filters [post]
+func (h *FilterHandler) CreateFilterHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var in FilterInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := h.filterService.CreateFilter(in.toFilter(userID))
+	if errors.Is(err, filterService.ErrInvalidFilter) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to create filter", "error", err)
+		http.Error(w, "Failed to create filter", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, filter)
+}
+
+// UpdateFilterHandler replaces one of the caller's filters
+// @Summary Update Filter
+// @Description Replace a filter by its ID
+// @Tags filters
+// @Accept json
+// @Produce json
+// @Param filter_id path int true "Filter ID"
+// @Param filter body FilterInput true "Filter"
+// @Success 200 {object} models.Filter
+// @Router /filters/{filter_id} [put]
+func (h *FilterHandler) UpdateFilterHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	filterID, err := strconv.Atoi(mux.Vars(r)["filter_id"])
+	if err != nil {
+		http.Error(w, "Invalid filter ID", http.StatusBadRequest)
+		return
+	}
+
+	var in FilterInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	f := in.toFilter(userID)
+	f.ID = filterID
+
+	filter, err := h.filterService.UpdateFilter(f)
+	switch {
+	case errors.Is(err, filterService.ErrInvalidFilter):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, filterService.ErrFilterNotFound):
+		http.Error(w, "Filter not found", http.StatusNotFound)
+		return
+	case err != nil:
+		h.log.Error("Failed to update filter", "error", err)
+		http.Error(w, "Failed to update filter", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, filter)
+}
+
+// DeleteFilterHandler deletes one of the caller's filters
+// @Summary Delete Filter
+// @Description Delete a filter by its ID
+// @Tags filters
+// @Produce plain
+// @Param filter_id path int true "Filter ID"
+// @Success 200 {string} string "Filter deleted successfully"
+// @Router /filters/{filter_id} [delete]
+func (h *FilterHandler) DeleteFilterHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	filterID, err := strconv.Atoi(mux.Vars(r)["filter_id"])
+	if err != nil {
+		http.Error(w, "Invalid filter ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.filterService.DeleteFilter(userID, filterID)
+	if errors.Is(err, filterService.ErrFilterNotFound) {
+		http.Error(w, "Filter not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to delete filter", "error", err)
+		http.Error(w, "Failed to delete filter", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write([]byte("Filter deleted successfully"))
+	if err != nil {
+		return
+	}
+}
+
+// writeJSON encodes v as the JSON response body
+func (h *FilterHandler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Error("Failed to encode response", "error", err)
+	}
+}
@@ -0,0 +1,105 @@
+package telegramHandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/api/middleware"
+	"github.com/17HIERARCH70/SocialManager/internal/services/telegramService"
+	"golang.org/x/exp/slog"
+)
+
+// TelegramHandler handles Telegram linking requests
+type TelegramHandler struct {
+	telegramService *telegramService.TelegramService
+	log             *slog.Logger
+}
+
+// NewTelegramHandler creates a new TelegramHandler
+func NewTelegramHandler(telegramService *telegramService.TelegramService, log *slog.Logger) *TelegramHandler {
+	return &TelegramHandler{
+		telegramService: telegramService,
+		log:             log,
+	}
+}
+
+// LinkCode is the response of the link code endpoint
+type LinkCode struct {
+	Code      string    `json:"code"`
+	Command   string    `json:"command"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// callerID returns the ID of the authenticated user
+func callerID(r *http.Request) (int, bool) {
+	p, ok := middleware.PrincipalFromContext(r.Context())
+	return p.UserID, ok
+}
+
+// CreateLinkCodeHandler issues a one-time code for linking a Telegram chat
+// @Summary Create Telegram Link Code
+// @Description Issue a one-time code. Sending "/start <code>" to the bot links the chat to the caller.
+// @Tags telegram
+// @Produce json
+// @Success 201 {object} LinkCode
+// @Router /telegram/link [post]
+func (h *TelegramHandler) CreateLinkCodeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !h.telegramService.Enabled() {
+		http.Error(w, "Telegram bot is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	code, expiresAt, err := h.telegramService.CreateLinkCode(userID)
+	if err != nil {
+		h.log.Error("Failed to create Telegram link code", "error", err)
+		http.Error(w, "Failed to create link code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(LinkCode{Code: code, Command: "/start " + code, ExpiresAt: expiresAt})
+	if err != nil {
+		h.log.Error("Failed to encode response", "error", err)
+		return
+	}
+}
+
+// UnlinkHandler detaches the caller's Telegram chat
+// @Summary Unlink Telegram
+// @Description Stop delivering emails to the caller's Telegram chat
+// @Tags telegram
+// @Produce plain
+// @Success 200 {string} string "Telegram chat unlinked successfully"
+// @Router /telegram/link [delete]
+func (h *TelegramHandler) UnlinkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := callerID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := h.telegramService.Unlink(userID)
+	if errors.Is(err, telegramService.ErrNotLinked) {
+		http.Error(w, "Telegram chat is not linked", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to unlink Telegram chat", "error", err)
+		http.Error(w, "Failed to unlink Telegram chat", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write([]byte("Telegram chat unlinked successfully"))
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,133 @@
+package userHandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/17HIERARCH70/SocialManager/internal/api/middleware"
+	"github.com/17HIERARCH70/SocialManager/internal/services/userService"
+	"github.com/gorilla/mux"
+	"golang.org/x/exp/slog"
+)
+
+// UserHandler handles user-related requests
+type UserHandler struct {
+	userService *userService.UserService
+	log         *slog.Logger
+}
+
+// NewUserHandler creates a new UserHandler
+func NewUserHandler(userService *userService.UserService, log *slog.Logger) *UserHandler {
+	return &UserHandler{
+		userService: userService,
+		log:         log,
+	}
+}
+
+// IngestionPolicy is the body of the ingestion policy endpoints
+type IngestionPolicy struct {
+	Policy string `json:"policy"`
+}
+
+// authorize checks that the caller may access the user's settings and answers 401 or 403 otherwise
+func authorize(w http.ResponseWriter, r *http.Request, userID int) bool {
+	p, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if !p.CanAccess(userID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// GetIngestionPolicyHandler retrieves the ingestion policy of a user
+// @Summary Get Ingestion Policy
+// @Description Retrieve what happens to Gmail messages after they are stored (none, mark_read, archive, label). Users may only access their own policy, admins any.
+// @Tags users
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Success 200 {object} IngestionPolicy
+// @Router /users/{user_id}/ingestion_policy [get]
+func (h *UserHandler) GetIngestionPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		h.log.Error("Invalid user ID", "error", err)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if !authorize(w, r, userID) {
+		return
+	}
+
+	policy, err := h.userService.GetIngestionPolicy(userID)
+	if errors.Is(err, userService.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to get ingestion policy", "error", err)
+		http.Error(w, "Failed to get ingestion policy", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(IngestionPolicy{Policy: policy})
+	if err != nil {
+		h.log.Error("Failed to encode response", "error", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// UpdateIngestionPolicyHandler changes the ingestion policy of a user
+// @Summary Update Ingestion Policy
+// @Description Change what happens to Gmail messages after they are stored (none, mark_read, archive, label). Users may only access their own policy, admins any.
+// @Tags users
+// @Accept json
+// @Produce plain
+// @Param user_id path int true "User ID"
+// @Param policy body IngestionPolicy true "Ingestion policy"
+// @Success 200 {string} string "Ingestion policy updated successfully"
+// @Router /users/{user_id}/ingestion_policy [put]
+func (h *UserHandler) UpdateIngestionPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		h.log.Error("Invalid user ID", "error", err)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if !authorize(w, r, userID) {
+		return
+	}
+
+	var body IngestionPolicy
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err = h.userService.SetIngestionPolicy(userID, body.Policy)
+	switch {
+	case errors.Is(err, userService.ErrInvalidIngestionPolicy):
+		http.Error(w, "Invalid ingestion policy", http.StatusBadRequest)
+		return
+	case errors.Is(err, userService.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	case err != nil:
+		h.log.Error("Failed to update ingestion policy", "error", err)
+		http.Error(w, "Failed to update ingestion policy", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write([]byte("Ingestion policy updated successfully"))
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,68 @@
+package webhookHandlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/17HIERARCH70/SocialManager/internal/lib/gmailpush"
+	"github.com/17HIERARCH70/SocialManager/internal/services/emailService"
+	"golang.org/x/exp/slog"
+)
+
+// maxPushBody bounds the size of a Pub/Sub push request
+const maxPushBody = 1 << 20
+
+// WebhookHandler handles notifications pushed by external services
+type WebhookHandler struct {
+	emailService *emailService.EmailService
+	verifier     *gmailpush.Verifier
+	log          *slog.Logger
+}
+
+// NewWebhookHandler creates a new WebhookHandler
+func NewWebhookHandler(emailService *emailService.EmailService, verifier *gmailpush.Verifier, log *slog.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		emailService: emailService,
+		verifier:     verifier,
+		log:          log,
+	}
+}
+
+// GmailWebhookHandler receives Gmail change notifications from a Pub/Sub push subscription
+// @Summary Gmail Push Notification
+// @Description Receive a Gmail users.watch notification pushed by Cloud Pub/Sub and queue an incremental sync of the mailbox. Requests are authenticated by the OIDC token of the push subscription or by the configured token query parameter. Any 2xx response acknowledges the message, so notifications for unknown mailboxes are acknowledged too.
+// @Tags webhooks
+// @Accept json
+// @Param token query string false "Shared push token"
+// @Success 204 "Notification accepted"
+// @Failure 400 {string} string "Invalid notification"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Push notifications are not configured"
+// @Router /webhooks/gmail [post]
+func (h *WebhookHandler) GmailWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if err := h.verifier.Verify(r); err != nil {
+		if errors.Is(err, gmailpush.ErrDisabled) {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		h.log.Warn("Rejected Gmail push request", "error", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	n, err := gmailpush.Parse(http.MaxBytesReader(w, r.Body, maxPushBody))
+	if err != nil {
+		// Pub/Sub retries failed deliveries, a malformed message never gets better
+		h.log.Error("Failed to parse Gmail notification", "error", err)
+		http.Error(w, "Invalid notification", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.emailService.HandleGmailNotification(r.Context(), n); err != nil {
+		h.log.Error("Failed to handle Gmail notification", "address", n.EmailAddress, "error", err)
+		http.Error(w, "Failed to handle notification", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,39 @@
+package webhookHandlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/17HIERARCH70/SocialManager/internal/lib/gmailpush"
+	"golang.org/x/exp/slog"
+)
+
+func TestGmailWebhookHandlerRejects(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	const valid = `{"message":{"data":"eyJlbWFpbEFkZHJlc3MiOiAidXNlckBleGFtcGxlLmNvbSIsICJoaXN0b3J5SWQiOiA5ODc2NTQzMjEwfQ==","messageId":"1"}}`
+
+	tests := []struct {
+		name     string
+		verifier *gmailpush.Verifier
+		target   string
+		body     string
+		want     int
+	}{
+		{name: "disabled", verifier: gmailpush.NewVerifier("", "", "", nil), target: "/api/webhooks/gmail?token=secret", body: valid, want: http.StatusNotFound},
+		{name: "wrong token", verifier: gmailpush.NewVerifier("secret", "", "", nil), target: "/api/webhooks/gmail?token=guess", body: valid, want: http.StatusUnauthorized},
+		{name: "invalid body", verifier: gmailpush.NewVerifier("secret", "", "", nil), target: "/api/webhooks/gmail?token=secret", body: `{"message":{"data":"bm90IGpzb24="}}`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewWebhookHandler(nil, tt.verifier, log)
+			w := httptest.NewRecorder()
+			h.GmailWebhookHandler(w, httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
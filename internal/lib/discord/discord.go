@@ -0,0 +1,261 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client sends messages through Discord webhooks and the bot API, limiting the
+// rate per channel and retrying rate-limited requests
+type Client struct {
+	baseURL    string
+	botToken   string
+	http       *http.Client
+	interval   time.Duration
+	burst      int
+	maxRetries int
+
+	mu       sync.Mutex
+	limiters map[string]*limiter
+}
+
+// Message is the body of an execute webhook or create message request
+type Message struct {
+	Content string  `json:"content,omitempty"`
+	Embeds  []Embed `json:"embeds,omitempty"`
+}
+
+// Embed is a rich message block
+type Embed struct {
+	Title       string       `json:"title,omitempty"`
+	Description string       `json:"description,omitempty"`
+	URL         string       `json:"url,omitempty"`
+	Color       int          `json:"color,omitempty"`
+	Timestamp   string       `json:"timestamp,omitempty"`
+	Author      *EmbedAuthor `json:"author,omitempty"`
+	Footer      *EmbedFooter `json:"footer,omitempty"`
+	Fields      []EmbedField `json:"fields,omitempty"`
+}
+
+// EmbedAuthor is shown above the embed title
+type EmbedAuthor struct {
+	Name string `json:"name"`
+}
+
+// EmbedFooter is shown below the embed
+type EmbedFooter struct {
+	Text string `json:"text"`
+}
+
+// EmbedField is a titled block inside an embed
+type EmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// Error is a Discord API error response
+type Error struct {
+	Status int
+	Body   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("discord: %d %s", e.Status, e.Body)
+}
+
+// ErrNoBotToken is returned when a channel message is sent without a bot token
+var ErrNoBotToken = errors.New("discord: bot token is not configured")
+
+// NewClient creates a client. baseURL is the API root, such as
+// https://discord.com/api/v10. Each channel may send burst messages at once and
+// then one message per interval.
+func NewClient(baseURL, botToken string, interval time.Duration, burst, maxRetries int) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		botToken:   botToken,
+		http:       &http.Client{Timeout: 30 * time.Second},
+		interval:   interval,
+		burst:      max(burst, 1),
+		maxRetries: maxRetries,
+		limiters:   make(map[string]*limiter),
+	}
+}
+
+// HasBotToken reports whether channel messages can be sent
+func (c *Client) HasBotToken() bool {
+	return c.botToken != ""
+}
+
+// ExecuteWebhook posts a message through a webhook
+func (c *Client) ExecuteWebhook(ctx context.Context, webhookID, webhookToken string, msg Message) error {
+	endpoint := fmt.Sprintf("%s/webhooks/%s/%s?wait=true", c.baseURL, url.PathEscape(webhookID), url.PathEscape(webhookToken))
+	return c.send(ctx, "webhook:"+webhookID, endpoint, "", msg)
+}
+
+// CreateMessage posts a message to a channel as the bot
+func (c *Client) CreateMessage(ctx context.Context, channelID string, msg Message) error {
+	if !c.HasBotToken() {
+		return ErrNoBotToken
+	}
+	endpoint := fmt.Sprintf("%s/channels/%s/messages", c.baseURL, url.PathEscape(channelID))
+	return c.send(ctx, "channel:"+channelID, endpoint, "Bot "+c.botToken, msg)
+}
+
+// ParseWebhookURL extracts the webhook ID and token from a webhook URL such as
+// https://discord.com/api/webhooks/{id}/{token}
+func ParseWebhookURL(raw string) (string, string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" && u.Scheme != "http" {
+		return "", "", errors.New("discord: invalid webhook URL")
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i+2 < len(parts); i++ {
+		if parts[i] == "webhooks" && parts[i+1] != "" && parts[i+2] != "" {
+			return parts[i+1], parts[i+2], nil
+		}
+	}
+	return "", "", errors.New("discord: invalid webhook URL")
+}
+
+// send posts the message, waiting for the channel limiter and retrying on 429 and 5xx responses
+func (c *Client) send(ctx context.Context, key, endpoint, auth string, msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	lim := c.limiter(key)
+	for attempt := 0; ; attempt++ {
+		if err := lim.wait(ctx); err != nil {
+			return err
+		}
+
+		retryAfter, err := c.post(ctx, endpoint, auth, body)
+		if err == nil {
+			return nil
+		}
+
+		var apiErr *Error
+		retryable := errors.As(err, &apiErr) && (apiErr.Status == http.StatusTooManyRequests || apiErr.Status >= 500)
+		if !retryable || attempt >= c.maxRetries {
+			return err
+		}
+		if retryAfter <= 0 {
+			retryAfter = time.Duration(1<<attempt) * time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
+// post performs one request and returns how long Discord asked to wait on failure
+func (c *Client) post(ctx context.Context, endpoint, auth string, body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// Drop the request URL from the error, webhook URLs contain a secret token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, fmt.Errorf("discord: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return 0, nil
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return retryAfter(resp, data), &Error{Status: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+}
+
+// retryAfter reads the wait time of a rate-limited response from its body or headers
+func retryAfter(resp *http.Response, body []byte) time.Duration {
+	var limited struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if json.Unmarshal(body, &limited) == nil && limited.RetryAfter > 0 {
+		return time.Duration(limited.RetryAfter * float64(time.Second))
+	}
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+			return time.Duration(seconds * float64(time.Second))
+		}
+	}
+	return 0
+}
+
+// limiter returns the rate limiter of a channel
+func (c *Client) limiter(key string) *limiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lim, ok := c.limiters[key]
+	if !ok {
+		lim = &limiter{interval: c.interval, burst: float64(c.burst), tokens: float64(c.burst), last: time.Now()}
+		c.limiters[key] = lim
+	}
+	return lim
+}
+
+// limiter is a token bucket refilled with one token per interval
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// wait blocks until a token is available and takes it
+func (l *limiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		if l.interval > 0 {
+			l.tokens = min(l.burst, l.tokens+float64(now.Sub(l.last))/float64(l.interval))
+		} else {
+			l.tokens = l.burst
+		}
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - l.tokens) * float64(l.interval))
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
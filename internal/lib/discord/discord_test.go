@@ -0,0 +1,223 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeAPI serves the Discord API with handle and counts the requests it gets
+func fakeAPI(t *testing.T, handle func(w http.ResponseWriter, r *http.Request, n int32)) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle(w, r, atomic.AddInt32(&calls, 1))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestExecuteWebhook(t *testing.T) {
+	srv, calls := fakeAPI(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		if r.Method != http.MethodPost || r.URL.Path != "/webhooks/123/tok" || r.URL.Query().Get("wait") != "true" {
+			t.Errorf("request = %s %s", r.Method, r.URL)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Authorization = %q, want none", auth)
+		}
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if len(msg.Embeds) != 1 || msg.Embeds[0].Title != "Subject" {
+			t.Errorf("message = %+v", msg)
+		}
+		w.Write([]byte(`{"id":"1"}`))
+	})
+
+	c := NewClient(srv.URL+"/", "", 0, 1, 3)
+	if err := c.ExecuteWebhook(context.Background(), "123", "tok", Message{Embeds: []Embed{{Title: "Subject"}}}); err != nil {
+		t.Fatalf("ExecuteWebhook() = %v", err)
+	}
+	if *calls != 1 {
+		t.Errorf("calls = %d, want 1", *calls)
+	}
+}
+
+func TestCreateMessage(t *testing.T) {
+	srv, _ := fakeAPI(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		if r.URL.Path != "/channels/987/messages" {
+			t.Errorf("path = %s, want /channels/987/messages", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bot BOT" {
+			t.Errorf("Authorization = %q, want %q", auth, "Bot BOT")
+		}
+		w.Write([]byte(`{"id":"1"}`))
+	})
+
+	if err := NewClient(srv.URL, "BOT", 0, 1, 0).CreateMessage(context.Background(), "987", Message{Content: "hi"}); err != nil {
+		t.Fatalf("CreateMessage() = %v", err)
+	}
+	if err := NewClient(srv.URL, "", 0, 1, 0).CreateMessage(context.Background(), "987", Message{Content: "hi"}); !errors.Is(err, ErrNoBotToken) {
+		t.Errorf("CreateMessage() without a bot token = %v, want ErrNoBotToken", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		limited func(w http.ResponseWriter)
+	}{
+		{name: "retry_after in body", limited: func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"message":"You are being rate limited.","retry_after":0.05,"global":false}`))
+		}},
+		{name: "Retry-After header", limited: func(w http.ResponseWriter) {
+			w.Header().Set("Retry-After", "0.05")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}},
+		{name: "server error", limited: func(w http.ResponseWriter) {
+			w.Header().Set("Retry-After", "0.05")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := fakeAPI(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+				if n == 1 {
+					tt.limited(w)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			start := time.Now()
+			if err := NewClient(srv.URL, "", 0, 1, 3).ExecuteWebhook(context.Background(), "1", "t", Message{Content: "hi"}); err != nil {
+				t.Fatalf("ExecuteWebhook() = %v", err)
+			}
+			if *calls != 2 {
+				t.Errorf("calls = %d, want 2", *calls)
+			}
+			if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+				t.Errorf("retried after %v, want at least 50ms", elapsed)
+			}
+		})
+	}
+}
+
+func TestRetryLimit(t *testing.T) {
+	srv, calls := fakeAPI(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"retry_after":0.01}`))
+	})
+
+	err := NewClient(srv.URL, "", 0, 1, 2).ExecuteWebhook(context.Background(), "1", "t", Message{Content: "hi"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusTooManyRequests {
+		t.Fatalf("ExecuteWebhook() = %v, want a 429 error", err)
+	}
+	if *calls != 3 {
+		t.Errorf("calls = %d, want 3", *calls)
+	}
+}
+
+func TestClientErrorNotRetried(t *testing.T) {
+	srv, calls := fakeAPI(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"Unknown Webhook","code":10015}`))
+	})
+
+	err := NewClient(srv.URL, "", 0, 1, 3).ExecuteWebhook(context.Background(), "1", "t", Message{Content: "hi"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound || !strings.Contains(apiErr.Body, "Unknown Webhook") {
+		t.Fatalf("ExecuteWebhook() = %v, want a 404 error", err)
+	}
+	if *calls != 1 {
+		t.Errorf("calls = %d, want 1", *calls)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	srv, _ := fakeAPI(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"retry_after":30}`))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := NewClient(srv.URL, "", 0, 1, 3).ExecuteWebhook(ctx, "1", "t", Message{Content: "hi"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ExecuteWebhook() = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestChannelRateLimit(t *testing.T) {
+	srv, _ := fakeAPI(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	c := NewClient(srv.URL, "", 100*time.Millisecond, 2, 0)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := c.ExecuteWebhook(ctx, "1", "t", Message{Content: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("burst took %v, want no wait", elapsed)
+	}
+
+	// Another webhook has its own bucket
+	if err := c.ExecuteWebhook(ctx, "2", "t", Message{Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("other webhook waited %v, want no wait", elapsed)
+	}
+
+	if err := c.ExecuteWebhook(ctx, "1", "t", Message{Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("third message sent after %v, want to wait for the interval", elapsed)
+	}
+}
+
+func TestParseWebhookURL(t *testing.T) {
+	tests := []struct {
+		url       string
+		id, token string
+		ok        bool
+	}{
+		{url: "https://discord.com/api/webhooks/123/abc", id: "123", token: "abc", ok: true},
+		{url: "https://discordapp.com/api/v10/webhooks/123/abc/", id: "123", token: "abc", ok: true},
+		{url: "https://discord.com/api/webhooks/123", ok: false},
+		{url: "ftp://discord.com/api/webhooks/123/abc", ok: false},
+		{url: "not a url", ok: false},
+	}
+	for _, tt := range tests {
+		id, token, err := ParseWebhookURL(tt.url)
+		if (err == nil) != tt.ok || id != tt.id || token != tt.token {
+			t.Errorf("ParseWebhookURL(%q) = %q, %q, %v, want %q, %q, ok %v", tt.url, id, token, err, tt.id, tt.token, tt.ok)
+		}
+	}
+}
+
+func TestErrorHidesToken(t *testing.T) {
+	srv, _ := fakeAPI(t, func(w http.ResponseWriter, r *http.Request, n int32) {})
+	srv.Close()
+
+	err := NewClient(srv.URL, "", 0, 1, 0).ExecuteWebhook(context.Background(), "1", "SECRET", Message{Content: "hi"})
+	if err == nil {
+		t.Fatal("ExecuteWebhook() to a closed server succeeded")
+	}
+	if strings.Contains(err.Error(), "SECRET") {
+		t.Errorf("error %q leaks the webhook token", err)
+	}
+}
@@ -0,0 +1,109 @@
+// Package gmailpush receives Gmail change notifications delivered by Cloud Pub/Sub push subscriptions.
+package gmailpush
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/api/idtoken"
+)
+
+// ErrUnauthorized is returned when a push request is not authenticated
+var ErrUnauthorized = errors.New("gmailpush: unauthorized push request")
+
+// ErrDisabled is returned when no push authentication is configured
+var ErrDisabled = errors.New("gmailpush: push notifications are not configured")
+
+// PushRequest is the body Pub/Sub posts to a push endpoint
+type PushRequest struct {
+	Message struct {
+		// Data is the base64 encoded Notification, decoded by encoding/json
+		Data        []byte    `json:"data"`
+		MessageID   string    `json:"messageId"`
+		PublishTime time.Time `json:"publishTime"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// Notification tells that the mailbox of EmailAddress changed up to HistoryID
+type Notification struct {
+	EmailAddress string `json:"emailAddress"`
+	HistoryID    uint64 `json:"historyId"`
+	MessageID    string `json:"-"`
+}
+
+// Parse decodes a push request body into the Gmail notification it carries
+func Parse(r io.Reader) (Notification, error) {
+	var req PushRequest
+	if err := json.NewDecoder(r).Decode(&req); err != nil {
+		return Notification{}, fmt.Errorf("gmailpush: invalid push request: %w", err)
+	}
+
+	var n Notification
+	if err := json.Unmarshal(req.Message.Data, &n); err != nil {
+		return Notification{}, fmt.Errorf("gmailpush: invalid notification: %w", err)
+	}
+	if n.EmailAddress == "" || n.HistoryID == 0 {
+		return Notification{}, errors.New("gmailpush: notification without emailAddress or historyId")
+	}
+	n.MessageID = req.Message.MessageID
+	return n, nil
+}
+
+// TokenValidator checks a Google-signed OIDC token, idtoken.Validate by default
+type TokenValidator func(ctx context.Context, token, audience string) (*idtoken.Payload, error)
+
+// Verifier authenticates push requests, either by the OIDC token Pub/Sub attaches
+// to authenticated push subscriptions or by a shared token in the query string
+type Verifier struct {
+	token          string
+	audience       string
+	serviceAccount string
+	validate       TokenValidator
+}
+
+// NewVerifier creates a verifier. With an audience the OIDC token is required and
+// must be issued to serviceAccount when it is set; otherwise the token query
+// parameter must equal token. A verifier with neither rejects every request.
+func NewVerifier(token, audience, serviceAccount string, validate TokenValidator) *Verifier {
+	if validate == nil {
+		validate = idtoken.Validate
+	}
+	return &Verifier{token: token, audience: audience, serviceAccount: serviceAccount, validate: validate}
+}
+
+// Verify authenticates a push request
+func (v *Verifier) Verify(r *http.Request) error {
+	switch {
+	case v.audience != "":
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return ErrUnauthorized
+		}
+		payload, err := v.validate(r.Context(), bearer, v.audience)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrUnauthorized, err)
+		}
+		if v.serviceAccount != "" {
+			email, _ := payload.Claims["email"].(string)
+			verified, _ := payload.Claims["email_verified"].(bool)
+			if !verified || !strings.EqualFold(email, v.serviceAccount) {
+				return ErrUnauthorized
+			}
+		}
+		return nil
+	case v.token != "":
+		if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(v.token)) != 1 {
+			return ErrUnauthorized
+		}
+		return nil
+	}
+	return ErrDisabled
+}
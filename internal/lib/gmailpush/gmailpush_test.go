@@ -0,0 +1,100 @@
+package gmailpush
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/idtoken"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    Notification
+		wantErr bool
+	}{
+		{fixture: "push.json", want: Notification{EmailAddress: "user@example.com", HistoryID: 9876543210, MessageID: "2070443601311540"}},
+		{fixture: "push_no_history.json", wantErr: true},
+		{fixture: "push_bad_data.json", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			n, err := Parse(f)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if n != tt.want {
+				t.Errorf("Parse() = %+v, want %+v", n, tt.want)
+			}
+		})
+	}
+
+	if _, err := Parse(strings.NewReader("{")); err == nil {
+		t.Error("Parse() of a truncated body succeeded")
+	}
+}
+
+// validator accepts the token "good" for the audience and returns the claims
+func validator(claims map[string]interface{}) TokenValidator {
+	return func(_ context.Context, token, audience string) (*idtoken.Payload, error) {
+		if token != "good" || audience != "https://example.com/api/webhooks/gmail" {
+			return nil, errors.New("invalid token")
+		}
+		return &idtoken.Payload{Audience: audience, Claims: claims}, nil
+	}
+}
+
+func TestVerify(t *testing.T) {
+	const audience = "https://example.com/api/webhooks/gmail"
+	const account = "push@project.iam.gserviceaccount.com"
+	pushClaims := map[string]interface{}{"email": account, "email_verified": true}
+
+	tests := []struct {
+		name     string
+		verifier *Verifier
+		bearer   string
+		query    string
+		want     error
+	}{
+		{name: "oidc", verifier: NewVerifier("", audience, account, validator(pushClaims)), bearer: "good"},
+		{name: "oidc without service account", verifier: NewVerifier("", audience, "", validator(nil)), bearer: "good"},
+		{name: "oidc service account case", verifier: NewVerifier("", audience, "Push@Project.iam.gserviceaccount.com", validator(pushClaims)), bearer: "good"},
+		{name: "oidc invalid token", verifier: NewVerifier("", audience, account, validator(pushClaims)), bearer: "bad", want: ErrUnauthorized},
+		{name: "oidc missing token", verifier: NewVerifier("", audience, account, validator(pushClaims)), want: ErrUnauthorized},
+		{name: "oidc other account", verifier: NewVerifier("", audience, account, validator(map[string]interface{}{"email": "other@example.com", "email_verified": true})), bearer: "good", want: ErrUnauthorized},
+		{name: "oidc unverified account", verifier: NewVerifier("", audience, account, validator(map[string]interface{}{"email": account})), bearer: "good", want: ErrUnauthorized},
+		{name: "oidc ignores the query token", verifier: NewVerifier("secret", audience, account, validator(pushClaims)), query: "secret", want: ErrUnauthorized},
+		{name: "token", verifier: NewVerifier("secret", "", "", validator(nil)), query: "secret"},
+		{name: "wrong token", verifier: NewVerifier("secret", "", "", validator(nil)), query: "guess", want: ErrUnauthorized},
+		{name: "missing token", verifier: NewVerifier("secret", "", "", validator(nil)), want: ErrUnauthorized},
+		{name: "disabled", verifier: NewVerifier("", "", "", validator(nil)), bearer: "good", query: "secret", want: ErrDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/webhooks/gmail", nil)
+			if tt.query != "" {
+				r.URL.RawQuery = "token=" + tt.query
+			}
+			if tt.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+
+			err := tt.verifier.Verify(r)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package htmlsafe
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// ReplaceContentIDs points the cid: sources of an HTML document at the URLs of
+// urls, keyed by Content-ID. Only src attributes whose whole value names a
+// known Content-ID are replaced; the rest of the document is kept byte for byte.
+func ReplaceContentIDs(doc string, urls map[string]string) string {
+	if len(urls) == 0 || !strings.Contains(strings.ToLower(doc), "cid:") {
+		return doc
+	}
+
+	var b strings.Builder
+	z := xhtml.NewTokenizer(strings.NewReader(doc))
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			if z.Err() != io.EOF {
+				return doc
+			}
+			return b.String()
+		}
+		raw := z.Raw()
+		if tt != xhtml.StartTagToken && tt != xhtml.SelfClosingTagToken || !strings.Contains(strings.ToLower(string(raw)), "cid:") {
+			b.Write(raw)
+			continue
+		}
+		// Token reuses the buffer raw points into
+		rawTag := string(raw)
+		token := z.Token()
+		replaced := false
+		for i, attr := range token.Attr {
+			if attr.Namespace != "" || attr.Key != "src" {
+				continue
+			}
+			if u, ok := contentIDURL(attr.Val, urls); ok {
+				token.Attr[i].Val = u
+				replaced = true
+			}
+		}
+		if replaced {
+			b.WriteString(token.String())
+		} else {
+			b.WriteString(rawTag)
+		}
+	}
+}
+
+// contentIDURL returns the URL of the Content-ID a cid: URL refers to
+func contentIDURL(src string, urls map[string]string) (string, bool) {
+	src = strings.TrimSpace(src)
+	if len(src) < len("cid:") || !strings.EqualFold(src[:len("cid:")], "cid:") {
+		return "", false
+	}
+	id := src[len("cid:"):]
+	if u, ok := urls[id]; ok {
+		return u, true
+	}
+	// cid: URLs escape the characters of Content-IDs that URLs cannot hold
+	if unescaped, err := url.PathUnescape(id); err == nil {
+		u, ok := urls[unescaped]
+		return u, ok
+	}
+	return "", false
+}
@@ -0,0 +1,52 @@
+package htmlsafe
+
+import "testing"
+
+func TestReplaceContentIDs(t *testing.T) {
+	urls := map[string]string{
+		"ab":              "/api/attachments/1/inline?expires=1&sig=a",
+		"logo@example":    "/api/attachments/2/inline?expires=1&sig=b",
+		"a b@example.org": "/api/attachments/3/inline?expires=1&sig=c",
+	}
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			name: "whole values only",
+			in:   `<img src="cid:ab"><img src="cid:abc">`,
+			want: `<img src="/api/attachments/1/inline?expires=1&amp;sig=a"><img src="cid:abc">`,
+		},
+		{
+			name: "single quoted and unquoted",
+			in:   `<IMG SRC='cid:logo@example' alt=x><p><img src=cid:ab></p>`,
+			want: `<img src="/api/attachments/2/inline?expires=1&amp;sig=b" alt="x"><p><img src="/api/attachments/1/inline?expires=1&amp;sig=a"></p>`,
+		},
+		{
+			name: "escaped content ID",
+			in:   `<img src="cid:a%20b@example.org">`,
+			want: `<img src="/api/attachments/3/inline?expires=1&amp;sig=c">`,
+		},
+		{
+			name: "other attributes and text",
+			in:   `<img alt="src=cid:ab" data-src="cid:ab"> cid:ab <a href="cid:ab">x</a>`,
+			want: `<img alt="src=cid:ab" data-src="cid:ab"> cid:ab <a href="cid:ab">x</a>`,
+		},
+		{
+			name: "unknown content ID",
+			in:   `<img src="cid:missing" width=1>`,
+			want: `<img src="cid:missing" width=1>`,
+		},
+		{
+			name: "script text",
+			in:   `<script>var s = '<img src="cid:ab">';</script>`,
+			want: `<script>var s = '<img src="cid:ab">';</script>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReplaceContentIDs(tt.in, urls); got != tt.want {
+				t.Errorf("ReplaceContentIDs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+// Package htmlsafe rewrites untrusted email HTML into markup that is safe to
+// render. The document is parsed and rebuilt from an allowlist of elements and
+// attributes: scripts, styles, forms, frames and event handlers are dropped,
+// links may only use web, mail and phone URLs, and remote images go through a
+// caller supplied rewrite so they can be proxied or blocked.
+package htmlsafe
+
+import (
+	"net/url"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ImageRewriter maps the URL of a remote image to the URL the image is loaded
+// from. Returning false removes the image source.
+type ImageRewriter func(src string) (string, bool)
+
+// droppedElements are removed together with their content
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "head": true, "title": true, "meta": true, "link": true, "base": true,
+	"noscript": true, "template": true, "iframe": true, "frame": true, "frameset": true, "object": true,
+	"embed": true, "applet": true, "svg": true, "math": true, "audio": true, "video": true, "canvas": true,
+	"select": true, "textarea": true, "button": true,
+}
+
+// allowedElements are kept; other elements are replaced by their content
+var allowedElements = map[string]bool{
+	"a": true, "abbr": true, "address": true, "b": true, "bdi": true, "bdo": true, "big": true,
+	"blockquote": true, "br": true, "caption": true, "center": true, "cite": true, "code": true,
+	"col": true, "colgroup": true, "dd": true, "del": true, "details": true, "dfn": true, "div": true,
+	"dl": true, "dt": true, "em": true, "figcaption": true, "figure": true, "font": true, "h1": true,
+	"h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true, "i": true, "img": true,
+	"ins": true, "kbd": true, "li": true, "mark": true, "ol": true, "p": true, "pre": true, "q": true,
+	"s": true, "samp": true, "small": true, "span": true, "strike": true, "strong": true, "sub": true,
+	"summary": true, "sup": true, "table": true, "tbody": true, "td": true, "tfoot": true, "th": true,
+	"thead": true, "time": true, "tr": true, "tt": true, "u": true, "ul": true, "var": true, "wbr": true,
+	"article": true, "aside": true, "footer": true, "header": true, "main": true, "nav": true, "section": true,
+}
+
+// allowedAttributes are kept on every allowed element; href and src are checked separately
+var allowedAttributes = map[string]bool{
+	"abbr": true, "align": true, "alt": true, "bgcolor": true, "border": true, "cellpadding": true,
+	"cellspacing": true, "color": true, "colspan": true, "datetime": true, "dir": true, "face": true,
+	"headers": true, "height": true, "hspace": true, "lang": true, "nowrap": true, "reversed": true,
+	"rowspan": true, "scope": true, "size": true, "span": true, "start": true, "summary": true,
+	"title": true, "type": true, "valign": true, "vspace": true, "width": true,
+}
+
+// linkSchemes are the URL schemes links may use
+var linkSchemes = map[string]bool{"http": true, "https": true, "mailto": true, "tel": true}
+
+// inlineImageTypes are the data: URL types images may embed; SVG is left out as it can carry scripts
+var inlineImageTypes = []string{"data:image/png;", "data:image/gif;", "data:image/jpeg;", "data:image/webp;"}
+
+// Sanitize returns the safe markup of an HTML document or fragment. Images
+// referencing cid: URLs and inline data are kept, remote images are passed to
+// images, and every link opens in a new window without sending a referrer.
+func Sanitize(doc string, images ImageRewriter) string {
+	context := &xhtml.Node{Type: xhtml.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := xhtml.ParseFragment(strings.NewReader(doc), context)
+	if err != nil {
+		return ""
+	}
+
+	root := &xhtml.Node{Type: xhtml.DocumentNode}
+	for _, n := range nodes {
+		copyNode(root, n, images)
+	}
+
+	var b strings.Builder
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if err := xhtml.Render(&b, c); err != nil {
+			return ""
+		}
+	}
+	return b.String()
+}
+
+// FromText returns the safe markup of a plain text body
+func FromText(text string) string {
+	if text == "" {
+		return ""
+	}
+	return "<pre>" + xhtml.EscapeString(text) + "</pre>"
+}
+
+// copyNode appends the allowed part of n to parent
+func copyNode(parent, n *xhtml.Node, images ImageRewriter) {
+	switch n.Type {
+	case xhtml.TextNode:
+		parent.AppendChild(&xhtml.Node{Type: xhtml.TextNode, Data: n.Data})
+		return
+	case xhtml.ElementNode:
+	default:
+		// Comments and doctypes carry nothing worth showing, conditional comments may hold markup
+		return
+	}
+
+	tag := strings.ToLower(n.Data)
+	if droppedElements[tag] {
+		return
+	}
+	target := parent
+	if allowedElements[tag] {
+		target = &xhtml.Node{Type: xhtml.ElementNode, Data: tag, DataAtom: atom.Lookup([]byte(tag))}
+		target.Attr = attributes(tag, n.Attr, images)
+		parent.AppendChild(target)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		copyNode(target, c, images)
+	}
+}
+
+// attributes filters the attributes of an allowed element
+func attributes(tag string, attrs []xhtml.Attribute, images ImageRewriter) []xhtml.Attribute {
+	var out []xhtml.Attribute
+	for _, attr := range attrs {
+		if attr.Namespace != "" {
+			continue
+		}
+		key := strings.ToLower(attr.Key)
+		switch {
+		case key == "href" && tag == "a":
+			if href, ok := safeLink(attr.Val); ok {
+				out = append(out, xhtml.Attribute{Key: key, Val: href})
+			}
+		case key == "src" && tag == "img":
+			if src, ok := safeImage(attr.Val, images); ok {
+				out = append(out, xhtml.Attribute{Key: key, Val: src})
+			}
+		case allowedAttributes[key]:
+			out = append(out, xhtml.Attribute{Key: key, Val: attr.Val})
+		}
+	}
+	if tag == "a" {
+		out = append(out,
+			xhtml.Attribute{Key: "target", Val: "_blank"},
+			xhtml.Attribute{Key: "rel", Val: "noopener noreferrer nofollow"},
+		)
+	}
+	return out
+}
+
+// safeLink returns href when it is an absolute URL with an allowed scheme
+func safeLink(href string) (string, bool) {
+	href = strings.TrimSpace(href)
+	u, err := url.Parse(href)
+	if err != nil || !linkSchemes[strings.ToLower(u.Scheme)] {
+		return "", false
+	}
+	return href, true
+}
+
+// safeImage returns the source an image is loaded from
+func safeImage(src string, images ImageRewriter) (string, bool) {
+	src = strings.TrimSpace(src)
+	lower := strings.ToLower(src)
+	if strings.HasPrefix(lower, "cid:") {
+		return src, true
+	}
+	for _, prefix := range inlineImageTypes {
+		if strings.HasPrefix(lower, prefix) {
+			return src, true
+		}
+	}
+
+	u, err := url.Parse(src)
+	if err != nil || images == nil {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "https", "http":
+		return images(u.String())
+	case "":
+		// Protocol-relative URLs are fetched over HTTPS
+		if u.Host != "" {
+			u.Scheme = "https"
+			return images(u.String())
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,97 @@
+package htmlsafe
+
+import (
+	"net/url"
+	"testing"
+)
+
+// proxy rewrites remote images like the image proxy does
+func proxy(src string) (string, bool) {
+	return "/api/images/proxy?url=" + url.QueryEscape(src), true
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			name: "scripts",
+			in:   `<p>Hi</p><script>alert(1)</script><SCRIPT src="https://evil.example/x.js"></SCRIPT>`,
+			want: `<p>Hi</p>`,
+		},
+		{
+			name: "styles and frames",
+			in:   `<style>body{display:none}</style><iframe src="https://evil.example"></iframe><b>ok</b>`,
+			want: `<b>ok</b>`,
+		},
+		{
+			name: "event handlers",
+			in:   `<img src="cid:logo" onerror="alert(1)"><div onclick="alert(1)" OnMouseOver=alert(1) style="x" title="t">x</div>`,
+			want: `<img src="cid:logo"/><div title="t">x</div>`,
+		},
+		{
+			name: "javascript links",
+			in:   `<a href="javascript:alert(1)">a</a><a href=" JaVaScRiPt:alert(1)">b</a><a href="vbscript:x">c</a><a href="data:text/html,<script>alert(1)</script>">d</a>`,
+			want: `<a target="_blank" rel="noopener noreferrer nofollow">a</a><a target="_blank" rel="noopener noreferrer nofollow">b</a><a target="_blank" rel="noopener noreferrer nofollow">c</a><a target="_blank" rel="noopener noreferrer nofollow">d</a>`,
+		},
+		{
+			name: "web and mail links",
+			in:   `<a href="https://example.org/?a=1&amp;b=2">a</a><a href="mailto:bob@example.org">b</a><a href="/relative">c</a>`,
+			want: `<a href="https://example.org/?a=1&amp;b=2" target="_blank" rel="noopener noreferrer nofollow">a</a><a href="mailto:bob@example.org" target="_blank" rel="noopener noreferrer nofollow">b</a><a target="_blank" rel="noopener noreferrer nofollow">c</a>`,
+		},
+		{
+			name: "svg",
+			in:   `<svg onload="alert(1)"><script>alert(1)</script><image href="https://evil.example/x"/></svg><p>after</p>`,
+			want: `<p>after</p>`,
+		},
+		{
+			name: "data images",
+			in:   `<img src="data:image/png;base64,iVBORw0KGgo="><img src="data:image/svg+xml;base64,PHN2Zz4="><img src="data:text/html;base64,PHNjcmlwdD4=">`,
+			want: `<img src="data:image/png;base64,iVBORw0KGgo="/><img/><img/>`,
+		},
+		{
+			name: "remote images",
+			in:   `<img src="https://img.example/a.png"><img src="http://img.example/b.png">`,
+			want: `<img src="/api/images/proxy?url=https%3A%2F%2Fimg.example%2Fa.png"/><img src="/api/images/proxy?url=http%3A%2F%2Fimg.example%2Fb.png"/>`,
+		},
+		{
+			name: "protocol-relative images",
+			in:   `<img src="//img.example/a.png"><img src="/local.png"><img src="javascript:alert(1)">`,
+			want: `<img src="/api/images/proxy?url=https%3A%2F%2Fimg.example%2Fa.png"/><img/><img/>`,
+		},
+		{
+			name: "forms and unknown elements",
+			in:   `<form action="https://evil.example"><input name="password"><button>Go</button></form><custom-tag>text</custom-tag>`,
+			want: `text`,
+		},
+		{
+			name: "comments",
+			in:   `<!--[if mso]><script>alert(1)</script><![endif]--><p>x</p>`,
+			want: `<p>x</p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sanitize(tt.in, proxy); got != tt.want {
+				t.Errorf("Sanitize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeBlockedImages(t *testing.T) {
+	in := `<img src="https://img.example/a.png"><img src="//img.example/b.png"><img src="cid:logo">`
+	want := `<img/><img/><img src="cid:logo"/>`
+	if got := Sanitize(in, nil); got != want {
+		t.Errorf("Sanitize() without a rewriter = %q, want %q", got, want)
+	}
+}
+
+func TestFromText(t *testing.T) {
+	if got, want := FromText(`<script>alert("x")</script> & more`), `<pre>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; more</pre>`; got != want {
+		t.Errorf("FromText() = %q, want %q", got, want)
+	}
+	if got := FromText(""); got != "" {
+		t.Errorf("FromText(\"\") = %q, want empty", got)
+	}
+}
@@ -0,0 +1,96 @@
+package htmltext
+
+import (
+	"strings"
+	"unicode"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// skippedElements hold content that is never shown to the reader
+var skippedElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"head":     true,
+	"title":    true,
+	"noscript": true,
+	"template": true,
+}
+
+// blockElements start a new line in the extracted text
+var blockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "td": true, "th": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"table": true, "ul": true, "ol": true, "blockquote": true, "pre": true, "hr": true,
+	"section": true, "article": true, "header": true, "footer": true,
+}
+
+// ToText strips the markup of an HTML document and returns its readable text,
+// with runs of whitespace collapsed and one line per block element
+func ToText(doc string) string {
+	z := xhtml.NewTokenizer(strings.NewReader(doc))
+	var b strings.Builder
+	skip := 0
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case xhtml.ErrorToken:
+			return collapse(b.String())
+		case xhtml.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+			}
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if skippedElements[tag] && tt == xhtml.StartTagToken {
+				skip++
+			}
+			if blockElements[tag] {
+				b.WriteByte('\n')
+			}
+		case xhtml.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if skippedElements[tag] && skip > 0 {
+				skip--
+			}
+			if blockElements[tag] {
+				b.WriteByte('\n')
+			}
+		}
+	}
+}
+
+// collapse merges whitespace runs into single spaces and blank lines into single line breaks
+func collapse(s string) string {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		line = strings.Join(strings.FieldsFunc(line, unicode.IsSpace), " ")
+		if line != "" {
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// Snippet returns the start of a text on one line, cut at a word boundary to
+// at most limit runes and ending with an ellipsis when shortened
+func Snippet(text string, limit int) string {
+	text = strings.Join(strings.FieldsFunc(text, unicode.IsSpace), " ")
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+
+	cut := limit
+	for i := limit; i > limit/2; i-- {
+		if runes[i] == ' ' {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimRight(string(runes[:cut]), " ,.;:-") + "…"
+}
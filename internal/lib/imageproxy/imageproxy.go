@@ -0,0 +1,143 @@
+// Package imageproxy loads the remote images of emails on behalf of clients, so
+// that senders never see the reader's address or learn when a message is opened.
+// Proxied URLs are signed: the proxy only fetches images that appeared in a
+// sanitized body and cannot be used to reach arbitrary addresses.
+package imageproxy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/lib/netguard"
+)
+
+// Path is the API route serving proxied images
+const Path = "/api/images/proxy"
+
+// maxRedirects bounds the redirects followed for one image
+const maxRedirects = 3
+
+var (
+	// ErrBadSignature is returned when a proxied URL was not signed by this server
+	ErrBadSignature = errors.New("imageproxy: invalid signature")
+	// ErrNotImage is returned when the remote server answers with something else than a raster image
+	ErrNotImage = errors.New("imageproxy: not an image")
+	// ErrTooLarge is returned when the image exceeds the size limit
+	ErrTooLarge = errors.New("imageproxy: image too large")
+	// ErrForbiddenAddress is returned when the image host resolves to a private or local address
+	ErrForbiddenAddress = netguard.ErrForbiddenAddress
+)
+
+// Image is a fetched remote image
+type Image struct {
+	ContentType string
+	Data        []byte
+}
+
+// Proxy signs image URLs and fetches the images they point to
+type Proxy struct {
+	key     []byte
+	maxSize int64
+	client  *http.Client
+}
+
+// New creates a Proxy signing URLs with key and fetching images of up to maxSize bytes within timeout
+func New(key string, maxSize int64, timeout time.Duration) *Proxy {
+	dialer := &net.Dialer{Timeout: timeout, Control: netguard.Control}
+	transport := &http.Transport{
+		// The proxy environment would bypass the address checks of the dialer
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          20,
+		IdleConnTimeout:       time.Minute,
+	}
+	return &Proxy{
+		key:     []byte(key),
+		maxSize: maxSize,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return errors.New("imageproxy: too many redirects")
+				}
+				if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+					return fmt.Errorf("imageproxy: redirect to %s URL", req.URL.Scheme)
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// URL returns the proxied URL of a remote image
+func (p *Proxy) URL(src string) string {
+	query := url.Values{"url": {src}, "sig": {p.sign(src)}}
+	return Path + "?" + query.Encode()
+}
+
+// Rewrite maps a remote image to its proxied URL, for use as an htmlsafe.ImageRewriter
+func (p *Proxy) Rewrite(src string) (string, bool) {
+	return p.URL(src), true
+}
+
+// sign returns the hex HMAC-SHA256 of a URL
+func (p *Proxy) sign(src string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(src))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Fetch downloads the image at src after checking its signature
+func (p *Proxy) Fetch(ctx context.Context, src, sig string) (*Image, error) {
+	if !hmac.Equal([]byte(p.sign(src)), []byte(strings.ToLower(sig))) {
+		return nil, ErrBadSignature
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "SocialManager-ImageProxy")
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("imageproxy: unexpected status %s", resp.Status)
+	}
+	contentType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	// SVG images can run scripts when opened directly
+	if err != nil || !strings.HasPrefix(contentType, "image/") || contentType == "image/svg+xml" {
+		return nil, ErrNotImage
+	}
+	if resp.ContentLength > p.maxSize {
+		return nil, ErrTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, p.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > p.maxSize {
+		return nil, ErrTooLarge
+	}
+	return &Image{ContentType: contentType, Data: data}, nil
+}
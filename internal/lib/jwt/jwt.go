@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"os"
@@ -8,21 +9,49 @@ import (
 )
 
 const (
-	accessTokenDuration  = time.Minute * 15
-	refreshTokenDuration = time.Hour * 128
+	AccessTokenDuration  = time.Minute * 15
+	RefreshTokenDuration = time.Hour * 128
+	StateTokenDuration   = time.Minute * 10
+)
+
+const (
+	accessTokenType  = "access"
+	refreshTokenType = "refresh"
+	stateTokenType   = "state"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrInvalidStateToken   = errors.New("invalid state token")
 )
 
 type AuthDetails struct {
 	AuthUuid string
 	UserId   uint64
+	Role     string
+	// AccessID and RefreshID identify the tokens, FamilyID the chain of tokens rotated from one login
+	AccessID  string
+	RefreshID string
+	FamilyID  string
+}
+
+type RefreshClaims struct {
+	AuthUuid  string
+	UserId    uint64
+	RefreshID string
+	FamilyID  string
 }
 
 func CreateAccessToken(authD AuthDetails) (string, error) {
 	claims := jwt.MapClaims{
 		"authorized": true,
+		"typ":        accessTokenType,
 		"auth_uuid":  authD.AuthUuid,
 		"user_id":    authD.UserId,
-		"exp":        time.Now().Add(accessTokenDuration).Unix(),
+		"role":       authD.Role,
+		"jti":        authD.AccessID,
+		"fid":        authD.FamilyID,
+		"exp":        time.Now().Add(AccessTokenDuration).Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(os.Getenv("API_SECRET")))
@@ -30,8 +59,12 @@ func CreateAccessToken(authD AuthDetails) (string, error) {
 
 func CreateRefreshToken(authD AuthDetails) (string, error) {
 	claims := jwt.MapClaims{
+		"typ":       refreshTokenType,
 		"auth_uuid": authD.AuthUuid,
-		"exp":       time.Now().Add(refreshTokenDuration).Unix(),
+		"user_id":   authD.UserId,
+		"jti":       authD.RefreshID,
+		"fid":       authD.FamilyID,
+		"exp":       time.Now().Add(RefreshTokenDuration).Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(os.Getenv("API_SECRET")))
@@ -55,6 +88,83 @@ func CreateTokenPair(authD AuthDetails) (map[string]string, error) {
 }
 
 func VerifyAccessToken(tokenString string) (*jwt.Token, error) {
+	token, err := parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	// Refresh and state tokens are signed with the same key and must not authenticate requests
+	if claims, ok := token.Claims.(jwt.MapClaims); !ok || claims["typ"] != accessTokenType {
+		return nil, errors.New("not an access token")
+	}
+	return token, nil
+}
+
+func VerifyRefreshToken(tokenString string) (RefreshClaims, error) {
+	token, err := parse(tokenString)
+	if err != nil || !token.Valid {
+		return RefreshClaims{}, ErrInvalidRefreshToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != refreshTokenType {
+		return RefreshClaims{}, ErrInvalidRefreshToken
+	}
+
+	userID, _ := claims["user_id"].(float64)
+	rc := RefreshClaims{UserId: uint64(userID)}
+	rc.AuthUuid, _ = claims["auth_uuid"].(string)
+	rc.RefreshID, _ = claims["jti"].(string)
+	rc.FamilyID, _ = claims["fid"].(string)
+	if rc.UserId == 0 || rc.RefreshID == "" || rc.FamilyID == "" {
+		return RefreshClaims{}, ErrInvalidRefreshToken
+	}
+	return rc, nil
+}
+
+type StateClaims struct {
+	Nonce       string
+	RedirectURL string
+	ShowCode    bool
+	LinkUserID  uint64
+}
+
+func CreateStateToken(sc StateClaims) (string, error) {
+	claims := jwt.MapClaims{
+		"typ":      stateTokenType,
+		"nonce":    sc.Nonce,
+		"redirect": sc.RedirectURL,
+		"code":     sc.ShowCode,
+		"link":     sc.LinkUserID,
+		"exp":      time.Now().Add(StateTokenDuration).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(os.Getenv("API_SECRET")))
+}
+
+func VerifyStateToken(tokenString string) (StateClaims, error) {
+	token, err := parse(tokenString)
+	if err != nil || !token.Valid {
+		return StateClaims{}, ErrInvalidStateToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != stateTokenType {
+		return StateClaims{}, ErrInvalidStateToken
+	}
+
+	var sc StateClaims
+	sc.Nonce, _ = claims["nonce"].(string)
+	sc.RedirectURL, _ = claims["redirect"].(string)
+	sc.ShowCode, _ = claims["code"].(bool)
+	linkUserID, _ := claims["link"].(float64)
+	sc.LinkUserID = uint64(linkUserID)
+	if sc.Nonce == "" {
+		return StateClaims{}, ErrInvalidStateToken
+	}
+	return sc, nil
+}
+
+func parse(tokenString string) (*jwt.Token, error) {
 	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unsupported signing method: %v", token.Header["alg"])
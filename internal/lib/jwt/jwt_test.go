@@ -0,0 +1,106 @@
+package jwt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokenPairRotation(t *testing.T) {
+	t.Setenv("API_SECRET", "test secret")
+	authD := AuthDetails{AuthUuid: "sub", UserId: 7, Role: "user", AccessID: "a1", RefreshID: "r1", FamilyID: "f1"}
+
+	tokens, err := CreateTokenPair(authD)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := VerifyAccessToken(tokens["access_token"])
+	if err != nil {
+		t.Fatalf("VerifyAccessToken() of an access token = %v", err)
+	}
+	if claims := token.Claims.(jwt.MapClaims); claims["jti"] != "a1" || claims["fid"] != "f1" || claims["role"] != "user" {
+		t.Errorf("access claims = %v", claims)
+	}
+
+	rc, err := VerifyRefreshToken(tokens["refresh_token"])
+	if err != nil {
+		t.Fatalf("VerifyRefreshToken() of a refresh token = %v", err)
+	}
+	if want := (RefreshClaims{AuthUuid: "sub", UserId: 7, RefreshID: "r1", FamilyID: "f1"}); rc != want {
+		t.Errorf("VerifyRefreshToken() = %+v, want %+v", rc, want)
+	}
+
+	if _, err := VerifyRefreshToken(tokens["access_token"]); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("VerifyRefreshToken() of an access token = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	t.Setenv("API_SECRET", "other secret")
+	if _, err := VerifyAccessToken(tokens["access_token"]); err == nil {
+		t.Error("VerifyAccessToken() accepted a token signed with another key")
+	}
+	if _, err := VerifyRefreshToken(tokens["refresh_token"]); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("VerifyRefreshToken() with another key = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestVerifyAccessTokenType(t *testing.T) {
+	t.Setenv("API_SECRET", "test secret")
+	sign := func(claims jwt.MapClaims) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	exp := time.Now().Add(time.Minute).Unix()
+
+	refresh, err := CreateRefreshToken(AuthDetails{UserId: 7, RefreshID: "r1", FamilyID: "f1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := CreateStateToken(StateClaims{Nonce: "n", LinkUserID: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{name: "access", token: sign(jwt.MapClaims{"typ": "access", "user_id": 7, "exp": exp}), ok: true},
+		{name: "refresh", token: refresh},
+		{name: "state", token: state},
+		{name: "untyped", token: sign(jwt.MapClaims{"user_id": 7, "exp": exp})},
+		{name: "expired", token: sign(jwt.MapClaims{"typ": "access", "user_id": 7, "exp": time.Now().Add(-time.Minute).Unix()})},
+		{name: "garbage", token: "not.a.token"},
+	}
+	for _, tt := range tests {
+		if _, err := VerifyAccessToken(tt.token); (err == nil) != tt.ok {
+			t.Errorf("VerifyAccessToken() of a %s token = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestStateToken(t *testing.T) {
+	t.Setenv("API_SECRET", "test secret")
+	want := StateClaims{Nonce: "n", RedirectURL: "http://127.0.0.1:8085/cb", ShowCode: true, LinkUserID: 7}
+	state, err := CreateStateToken(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := VerifyStateToken(state); err != nil || got != want {
+		t.Errorf("VerifyStateToken() = %+v, %v, want %+v", got, err, want)
+	}
+
+	access, err := CreateAccessToken(AuthDetails{UserId: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyStateToken(access); !errors.Is(err, ErrInvalidStateToken) {
+		t.Errorf("VerifyStateToken() of an access token = %v, want ErrInvalidStateToken", err)
+	}
+}
@@ -0,0 +1,216 @@
+// Package mailcompose builds outgoing RFC 5322 messages with text and HTML
+// alternatives, attachments and the headers that keep replies threaded.
+package mailcompose
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gomail "github.com/emersion/go-message/mail"
+)
+
+var (
+	// ErrNoRecipients is returned for a draft without To, Cc or Bcc addresses
+	ErrNoRecipients = errors.New("mailcompose: no recipients")
+	// ErrInvalidAddress is returned for an address that does not parse
+	ErrInvalidAddress = errors.New("mailcompose: invalid address")
+	// ErrEmptyBody is returned for a draft without text, HTML or attachments
+	ErrEmptyBody = errors.New("mailcompose: empty message")
+)
+
+// Draft is an outgoing message. Addresses are "Name <address>" entries or
+// bare addresses; message IDs keep their angle brackets.
+type Draft struct {
+	From        string
+	To          []string
+	Cc          []string
+	Bcc         []string
+	Subject     string
+	Text        string
+	HTML        string
+	InReplyTo   string
+	References  []string
+	Attachments []File
+}
+
+// File is an attachment of a draft. An empty MimeType is guessed from the
+// file name, then from the content.
+type File struct {
+	Filename string
+	MimeType string
+	Data     []byte
+}
+
+// Build renders the draft and returns the message with its Message-ID
+func Build(d Draft) ([]byte, string, error) {
+	from, err := parseAddresses([]string{d.From})
+	if err != nil {
+		return nil, "", err
+	}
+	if len(from) != 1 {
+		return nil, "", fmt.Errorf("%w: %q", ErrInvalidAddress, d.From)
+	}
+	to, err := parseAddresses(d.To)
+	if err != nil {
+		return nil, "", err
+	}
+	cc, err := parseAddresses(d.Cc)
+	if err != nil {
+		return nil, "", err
+	}
+	bcc, err := parseAddresses(d.Bcc)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(to)+len(cc)+len(bcc) == 0 {
+		return nil, "", ErrNoRecipients
+	}
+	if d.Text == "" && d.HTML == "" && len(d.Attachments) == 0 {
+		return nil, "", ErrEmptyBody
+	}
+
+	var h gomail.Header
+	h.SetDate(time.Now())
+	h.SetAddressList("From", from)
+	h.SetAddressList("To", to)
+	if len(cc) > 0 {
+		h.SetAddressList("Cc", cc)
+	}
+	// The Gmail API delivers to Bcc recipients and strips the header
+	if len(bcc) > 0 {
+		h.SetAddressList("Bcc", bcc)
+	}
+	h.SetSubject(d.Subject)
+	if d.InReplyTo != "" {
+		h.SetMsgIDList("In-Reply-To", []string{trimID(d.InReplyTo)})
+	}
+	if len(d.References) > 0 {
+		ids := make([]string, len(d.References))
+		for i, id := range d.References {
+			ids[i] = trimID(id)
+		}
+		h.SetMsgIDList("References", ids)
+	}
+	_, domain, _ := strings.Cut(from[0].Address, "@")
+	if err := h.GenerateMessageIDWithHostname(domain); err != nil {
+		return nil, "", err
+	}
+	messageID, err := h.MessageID()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	if len(d.Attachments) == 0 {
+		iw, err := gomail.CreateInlineWriter(&buf, h)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := writeBodies(iw, d); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "<" + messageID + ">", nil
+	}
+
+	w, err := gomail.CreateWriter(&buf, h)
+	if err != nil {
+		return nil, "", err
+	}
+	if d.Text != "" || d.HTML != "" {
+		iw, err := w.CreateInline()
+		if err != nil {
+			return nil, "", err
+		}
+		if err := writeBodies(iw, d); err != nil {
+			return nil, "", err
+		}
+	}
+	for _, f := range d.Attachments {
+		if err := writeAttachment(w, f); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "<" + messageID + ">", nil
+}
+
+// writeBodies writes the text and HTML alternatives, the preferred one last
+func writeBodies(iw *gomail.InlineWriter, d Draft) error {
+	for _, body := range []struct{ mimeType, content string }{{"text/plain", d.Text}, {"text/html", d.HTML}} {
+		if body.content == "" {
+			continue
+		}
+		var h gomail.InlineHeader
+		h.SetContentType(body.mimeType, map[string]string{"charset": "utf-8"})
+		pw, err := iw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		if _, err := pw.Write([]byte(body.content)); err != nil {
+			return err
+		}
+		if err := pw.Close(); err != nil {
+			return err
+		}
+	}
+	return iw.Close()
+}
+
+// writeAttachment adds a file to the message
+func writeAttachment(w *gomail.Writer, f File) error {
+	mimeType := f.MimeType
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(filepath.Ext(f.Filename))
+	}
+	if mimeType == "" {
+		mimeType = http.DetectContentType(f.Data)
+	}
+	mediaType, params, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType, params = "application/octet-stream", nil
+	}
+
+	var h gomail.AttachmentHeader
+	h.SetContentType(mediaType, params)
+	h.SetFilename(f.Filename)
+	aw, err := w.CreateAttachment(h)
+	if err != nil {
+		return err
+	}
+	if _, err := aw.Write(f.Data); err != nil {
+		return err
+	}
+	return aw.Close()
+}
+
+// parseAddresses parses "Name <address>" entries, skipping empty ones
+func parseAddresses(entries []string) ([]*gomail.Address, error) {
+	var addresses []*gomail.Address
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		parsed, err := mail.ParseAddressList(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidAddress, entry)
+		}
+		for _, a := range parsed {
+			addresses = append(addresses, (*gomail.Address)(a))
+		}
+	}
+	return addresses, nil
+}
+
+// trimID removes the angle brackets of a message ID
+func trimID(id string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(id), "<"), ">")
+}
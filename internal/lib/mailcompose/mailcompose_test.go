@@ -0,0 +1,185 @@
+package mailcompose
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	gomail "github.com/emersion/go-message/mail"
+)
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		draft Draft
+		want  error
+	}{
+		{name: "no recipients", draft: Draft{From: "me@example.org", Text: "hi"}, want: ErrNoRecipients},
+		{name: "blank recipients", draft: Draft{From: "me@example.org", To: []string{" "}, Text: "hi"}, want: ErrNoRecipients},
+		{name: "invalid recipient", draft: Draft{From: "me@example.org", To: []string{"not an address"}, Text: "hi"}, want: ErrInvalidAddress},
+		{name: "invalid sender", draft: Draft{From: "", To: []string{"bob@example.org"}, Text: "hi"}, want: ErrInvalidAddress},
+		{name: "two senders", draft: Draft{From: "a@example.org, b@example.org", To: []string{"bob@example.org"}, Text: "hi"}, want: ErrInvalidAddress},
+		{name: "empty body", draft: Draft{From: "me@example.org", To: []string{"bob@example.org"}, Subject: "hi"}, want: ErrEmptyBody},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Build(tt.draft); !errors.Is(err, tt.want) {
+				t.Errorf("Build() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// part is a decoded part of a built message
+type part struct {
+	contentType, filename, body string
+}
+
+// read parses a built message and returns its header and leaf parts
+func read(t *testing.T, msg []byte) (gomail.Header, []part) {
+	t.Helper()
+	r, err := gomail.CreateReader(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parts []part
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(p.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got part
+		switch h := p.Header.(type) {
+		case *gomail.InlineHeader:
+			got.contentType, _, _ = h.ContentType()
+		case *gomail.AttachmentHeader:
+			got.contentType, _, _ = h.ContentType()
+			got.filename, _ = h.Filename()
+		}
+		got.body = string(body)
+		parts = append(parts, got)
+	}
+	return r.Header, parts
+}
+
+func TestBuildReply(t *testing.T) {
+	msg, messageID, err := Build(Draft{
+		From:       "Me <me@example.org>",
+		To:         []string{"Alice <alice@example.org>"},
+		Cc:         []string{"bob@example.org, carol@example.org"},
+		Bcc:        []string{"dave@example.org"},
+		Subject:    "Re: Привет",
+		Text:       "plain",
+		HTML:       "<p>html</p>",
+		InReplyTo:  "<parent@example.org>",
+		References: []string{"<root@example.org>", "parent@example.org"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(messageID, "<") || !strings.HasSuffix(messageID, "@example.org>") {
+		t.Errorf("Build() message ID = %q", messageID)
+	}
+
+	h, parts := read(t, msg)
+	if id, _ := h.MessageID(); "<"+id+">" != messageID {
+		t.Errorf("Message-Id = %q, want %q", id, messageID)
+	}
+	if subject, _ := h.Subject(); subject != "Re: Привет" {
+		t.Errorf("Subject = %q", subject)
+	}
+	if got := h.Get("In-Reply-To"); got != "<parent@example.org>" {
+		t.Errorf("In-Reply-To = %q", got)
+	}
+	if got := h.Get("References"); got != "<root@example.org> <parent@example.org>" {
+		t.Errorf("References = %q", got)
+	}
+	for field, want := range map[string]string{
+		"From": "me@example.org",
+		"To":   "alice@example.org",
+		"Cc":   "bob@example.org carol@example.org",
+		"Bcc":  "dave@example.org",
+	} {
+		list, err := h.AddressList(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, a := range list {
+			got = append(got, a.Address)
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("%s = %q, want %q", field, got, want)
+		}
+	}
+
+	want := []part{{contentType: "text/plain", body: "plain"}, {contentType: "text/html", body: "<p>html</p>"}}
+	if len(parts) != len(want) {
+		t.Fatalf("parts = %+v, want %+v", parts, want)
+	}
+	for i := range want {
+		if parts[i] != want[i] {
+			t.Errorf("part %d = %+v, want %+v", i, parts[i], want[i])
+		}
+	}
+}
+
+func TestBuildAttachments(t *testing.T) {
+	msg, _, err := Build(Draft{
+		From: "me@example.org",
+		To:   []string{"alice@example.org"},
+		Text: "see attached",
+		Attachments: []File{
+			{Filename: "report.pdf", Data: []byte("%PDF-1.4")},
+			{Filename: "notes", Data: []byte("just text")},
+			{Filename: "data.bin", MimeType: "application/x-custom; version=2", Data: []byte{0, 1, 2}},
+			{Filename: "broken", MimeType: "not a type", Data: []byte{0}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, parts := read(t, msg)
+	if h.Get("Cc") != "" || h.Get("In-Reply-To") != "" || h.Get("References") != "" {
+		t.Errorf("unexpected headers Cc=%q In-Reply-To=%q References=%q", h.Get("Cc"), h.Get("In-Reply-To"), h.Get("References"))
+	}
+	want := []part{
+		{contentType: "text/plain", body: "see attached"},
+		{contentType: "application/pdf", filename: "report.pdf", body: "%PDF-1.4"},
+		{contentType: "text/plain", filename: "notes", body: "just text"},
+		{contentType: "application/x-custom", filename: "data.bin", body: "\x00\x01\x02"},
+		{contentType: "application/octet-stream", filename: "broken", body: "\x00"},
+	}
+	if len(parts) != len(want) {
+		t.Fatalf("parts = %+v, want %+v", parts, want)
+	}
+	for i := range want {
+		if parts[i] != want[i] {
+			t.Errorf("part %d = %+v, want %+v", i, parts[i], want[i])
+		}
+	}
+}
+
+func TestBuildAttachmentOnly(t *testing.T) {
+	msg, _, err := Build(Draft{
+		From:        "me@example.org",
+		To:          []string{"alice@example.org"},
+		Attachments: []File{{Filename: "a.txt", Data: []byte("a")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, parts := read(t, msg); len(parts) != 1 || parts[0].filename != "a.txt" {
+		t.Errorf("parts = %+v, want only the attachment", parts)
+	}
+}
@@ -0,0 +1,410 @@
+package mailsource
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// batchModifyLimit is the maximum number of IDs accepted by messages.batchModify
+const batchModifyLimit = 1000
+
+// Gmail API quota units of the calls made by the source
+const (
+	unitsGetProfile  = 1
+	unitsListPage    = 5
+	unitsHistoryPage = 2
+	unitsGetMessage  = 5
+	unitsAttachment  = 5
+	unitsTrash       = 5
+	unitsBatchModify = 50
+	unitsLabels      = 5
+	unitsWatch       = 100
+	unitsSend        = 100
+)
+
+// historyTypes lists the Gmail history records consumed by Changes
+var historyTypes = []string{"messageAdded", "messageDeleted", "labelAdded", "labelRemoved"}
+
+// errStopPaging stops a Pages iteration early without reporting a failure
+var errStopPaging = errors.New("stop paging")
+
+// Gmail reads a mailbox through the Gmail API. The cursor is a Gmail history ID.
+type Gmail struct {
+	service *gmail.Service
+	user    string
+	quota   *Quota
+}
+
+// NewGmail creates a source for the mailbox of user, usually "me" or the account
+// address. Every call first takes its cost from quota, which may be nil.
+func NewGmail(service *gmail.Service, user string, quota *Quota) *Gmail {
+	return &Gmail{service: service, user: user, quota: quota}
+}
+
+// Service returns the underlying Gmail client
+func (g *Gmail) Service() *gmail.Service {
+	return g.service
+}
+
+// List returns the newest message IDs and the current history ID
+func (g *Gmail) List(ctx context.Context, limit int) (Listing, error) {
+	// The history ID is taken before listing so that changes made while the
+	// listing runs are replayed by the next Changes call
+	if err := g.quota.Wait(ctx, unitsGetProfile); err != nil {
+		return Listing{}, err
+	}
+	profile, err := g.service.Users.GetProfile(g.user).Context(ctx).Do()
+	if err != nil {
+		return Listing{}, err
+	}
+
+	listing := Listing{Cursor: strconv.FormatUint(profile.HistoryId, 10)}
+	if err := g.quota.Wait(ctx, unitsListPage); err != nil {
+		return Listing{}, err
+	}
+	err = g.service.Users.Messages.List(g.user).Q("-in:drafts").MaxResults(500).Pages(ctx, func(res *gmail.ListMessagesResponse) error {
+		for _, m := range res.Messages {
+			if len(listing.IDs) >= limit {
+				listing.Truncated = true
+				return errStopPaging
+			}
+			listing.IDs = append(listing.IDs, m.Id)
+		}
+		// Pay for the next page before it is requested
+		return g.quota.Wait(ctx, unitsListPage)
+	})
+	if err != nil && !errors.Is(err, errStopPaging) {
+		return Listing{}, err
+	}
+	return listing, nil
+}
+
+// Changes replays the mailbox history recorded since the cursor
+func (g *Gmail) Changes(ctx context.Context, cursor string) (Changes, error) {
+	historyID, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return Changes{}, ErrCursorExpired
+	}
+
+	latest := historyID
+	added := make(map[string]bool)
+	deleted := make(map[string]bool)
+	labels := make(map[string][]string)
+
+	if err := g.quota.Wait(ctx, unitsHistoryPage); err != nil {
+		return Changes{}, err
+	}
+	err = g.service.Users.History.List(g.user).StartHistoryId(historyID).HistoryTypes(historyTypes...).MaxResults(500).Pages(ctx, func(res *gmail.ListHistoryResponse) error {
+		for _, h := range res.History {
+			for _, m := range h.MessagesAdded {
+				added[m.Message.Id] = true
+				delete(deleted, m.Message.Id)
+			}
+			for _, m := range h.MessagesDeleted {
+				deleted[m.Message.Id] = true
+				delete(added, m.Message.Id)
+				delete(labels, m.Message.Id)
+			}
+			for _, l := range h.LabelsAdded {
+				labels[l.Message.Id] = l.Message.LabelIds
+			}
+			for _, l := range h.LabelsRemoved {
+				labels[l.Message.Id] = l.Message.LabelIds
+			}
+		}
+		if res.HistoryId > latest {
+			latest = res.HistoryId
+		}
+		return g.quota.Wait(ctx, unitsHistoryPage)
+	})
+	if isNotFound(err) {
+		// Gmail rejects start history IDs that are too old
+		return Changes{}, ErrCursorExpired
+	}
+	if err != nil {
+		return Changes{}, err
+	}
+
+	changes := Changes{Labels: labels, Cursor: strconv.FormatUint(latest, 10)}
+	for id := range added {
+		changes.Added = append(changes.Added, id)
+	}
+	for id := range deleted {
+		changes.Deleted = append(changes.Deleted, id)
+	}
+	return changes, nil
+}
+
+// FetchMessage downloads the full message
+func (g *Gmail) FetchMessage(ctx context.Context, id string) (*Message, error) {
+	if err := g.quota.Wait(ctx, unitsGetMessage); err != nil {
+		return nil, err
+	}
+	msg, err := g.service.Users.Messages.Get(g.user, id).Format("full").Context(ctx).Do()
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var received time.Time
+	if msg.InternalDate > 0 {
+		received = time.UnixMilli(msg.InternalDate)
+	}
+	m := &Message{ID: msg.Id, ThreadID: msg.ThreadId, Labels: msg.LabelIds}
+	readHeaders(m, func(name string) string {
+		return extractHeader(msg.Payload.Headers, name)
+	}, received)
+	m.Structure, err = readGmailPart(m, msg.Payload, "")
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ThreadID returns the thread of a message without downloading it
+func (g *Gmail) ThreadID(ctx context.Context, id string) (string, error) {
+	if err := g.quota.Wait(ctx, unitsGetMessage); err != nil {
+		return "", err
+	}
+	msg, err := g.service.Users.Messages.Get(g.user, id).Format("minimal").Fields("threadId").Context(ctx).Do()
+	if isNotFound(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return msg.ThreadId, nil
+}
+
+// Send delivers a message through users.messages.send. The content is uploaded
+// as media, which allows messages up to the Gmail size limit.
+func (g *Gmail) Send(ctx context.Context, raw []byte, threadID string) (string, error) {
+	if err := g.quota.Wait(ctx, unitsSend); err != nil {
+		return "", err
+	}
+	msg, err := g.service.Users.Messages.Send(g.user, &gmail.Message{ThreadId: threadID}).
+		Media(bytes.NewReader(raw), googleapi.ContentType("message/rfc822")).
+		Context(ctx).Do()
+	if isInsufficientScope(err) {
+		return "", ErrSendNotPermitted
+	}
+	if err != nil {
+		return "", err
+	}
+	return msg.Id, nil
+}
+
+// FetchAttachment downloads the attachment data
+func (g *Gmail) FetchAttachment(ctx context.Context, messageID, attachmentID string) ([]byte, error) {
+	if err := g.quota.Wait(ctx, unitsAttachment); err != nil {
+		return nil, err
+	}
+	attachment, err := g.service.Users.Messages.Attachments.Get(g.user, messageID, attachmentID).Context(ctx).Do()
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeGmailData(attachment.Data)
+}
+
+// MarkState modifies the labels of the messages, or moves them to the trash
+func (g *Gmail) MarkState(ctx context.Context, ids []string, state State) error {
+	if state.Trash {
+		for _, id := range ids {
+			if err := g.quota.Wait(ctx, unitsTrash); err != nil {
+				return err
+			}
+			_, err := g.service.Users.Messages.Trash(g.user, id).Context(ctx).Do()
+			if err != nil && !isNotFound(err) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	req := &gmail.BatchModifyMessagesRequest{}
+	if state.Read {
+		req.RemoveLabelIds = append(req.RemoveLabelIds, LabelUnread)
+	}
+	if state.Archive {
+		req.RemoveLabelIds = append(req.RemoveLabelIds, LabelInbox)
+	}
+	if state.Label != "" {
+		labelID, err := g.ensureLabel(ctx, state.Label)
+		if err != nil {
+			return err
+		}
+		req.AddLabelIds = append(req.AddLabelIds, labelID)
+	}
+	if len(req.AddLabelIds) == 0 && len(req.RemoveLabelIds) == 0 {
+		return nil
+	}
+
+	for start := 0; start < len(ids); start += batchModifyLimit {
+		end := min(start+batchModifyLimit, len(ids))
+		req.Ids = ids[start:end]
+		if err := g.quota.Wait(ctx, unitsBatchModify); err != nil {
+			return err
+		}
+		if err := g.service.Users.Messages.BatchModify(g.user, req).Context(ctx).Do(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Watch asks Gmail to publish the changes of the mailbox to a Pub/Sub topic and
+// returns when the watch expires. Watching again replaces the previous watch.
+func (g *Gmail) Watch(ctx context.Context, topic string) (time.Time, error) {
+	if err := g.quota.Wait(ctx, unitsWatch); err != nil {
+		return time.Time{}, err
+	}
+	res, err := g.service.Users.Watch(g.user, &gmail.WatchRequest{TopicName: topic}).Context(ctx).Do()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(res.Expiration), nil
+}
+
+// Close does nothing, the Gmail API is stateless
+func (g *Gmail) Close() error {
+	return nil
+}
+
+// ensureLabel returns the ID of the user label with the given name, creating it if needed
+func (g *Gmail) ensureLabel(ctx context.Context, name string) (string, error) {
+	if err := g.quota.Wait(ctx, unitsLabels); err != nil {
+		return "", err
+	}
+	res, err := g.service.Users.Labels.List(g.user).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	for _, label := range res.Labels {
+		if label.Name == name {
+			return label.Id, nil
+		}
+	}
+
+	if err := g.quota.Wait(ctx, unitsLabels); err != nil {
+		return "", err
+	}
+	label, err := g.service.Users.Labels.Create(g.user, &gmail.Label{
+		Name:                  name,
+		LabelListVisibility:   "labelShow",
+		MessageListVisibility: "show",
+	}).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	return label.Id, nil
+}
+
+// readGmailPart walks the payload of a Gmail message, filling the bodies and
+// attachments of msg, and returns its part tree. Gmail decodes the transfer
+// encoding but leaves text in its original charset.
+func readGmailPart(msg *Message, p *gmail.MessagePart, id string) (Part, error) {
+	part := Part{
+		PartID:    id,
+		MimeType:  strings.ToLower(p.MimeType),
+		Filename:  p.Filename,
+		ContentID: contentID(extractHeader(p.Headers, "Content-Id")),
+	}
+	if _, params, err := mime.ParseMediaType(extractHeader(p.Headers, "Content-Type")); err == nil {
+		part.Charset = params["charset"]
+	}
+	if disposition, _, err := mime.ParseMediaType(extractHeader(p.Headers, "Content-Disposition")); err == nil {
+		part.Disposition = disposition
+	}
+
+	if strings.HasPrefix(part.MimeType, "multipart/") {
+		for n, child := range p.Parts {
+			childPart, err := readGmailPart(msg, child, part.childID(n+1))
+			if err != nil {
+				return part, err
+			}
+			part.Parts = append(part.Parts, childPart)
+		}
+		return part, nil
+	}
+
+	var data []byte
+	var attachmentID string
+	if p.Body != nil {
+		part.Size = p.Body.Size
+		attachmentID = p.Body.AttachmentId
+		if p.Body.Data != "" {
+			var err error
+			data, err = decodeGmailData(p.Body.Data)
+			if err != nil {
+				return part, err
+			}
+		}
+	}
+	if attachmentID != "" {
+		// Large parts are downloaded separately
+		data = nil
+	} else if data == nil {
+		data = []byte{}
+	}
+	var text string
+	if part.isBody() {
+		text = decodeCharset(data, part.Charset)
+	}
+	msg.addLeaf(part, text, data, attachmentID)
+	return part, nil
+}
+
+// decodeGmailData decodes the URL-safe base64 body data of the Gmail API, which
+// may come with or without padding
+func decodeGmailData(s string) ([]byte, error) {
+	if strings.HasSuffix(s, "=") {
+		return base64.URLEncoding.DecodeString(s)
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// extractHeader extracts the header of the email, header names are case-insensitive
+func extractHeader(headers []*gmail.MessagePartHeader, name string) string {
+	for _, header := range headers {
+		if strings.EqualFold(header.Name, name) {
+			return header.Value
+		}
+	}
+	return ""
+}
+
+// isInsufficientScope reports whether err is a Gmail API 403 response caused
+// by a token missing the scope of the call
+func isInsufficientScope(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		return false
+	}
+	for _, item := range apiErr.Errors {
+		if item.Reason == "insufficientPermissions" {
+			return true
+		}
+	}
+	return strings.Contains(strings.ToLower(apiErr.Message), "insufficient authentication scopes")
+}
+
+// isNotFound reports whether err is a Gmail API 404 response
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
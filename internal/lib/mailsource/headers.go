@@ -0,0 +1,291 @@
+package mailsource
+
+import (
+	"mime"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message/charset"
+)
+
+// wordDecoder decodes RFC 2047 encoded words in any charset go-message knows
+var wordDecoder = &mime.WordDecoder{CharsetReader: charset.Reader}
+
+// readHeaders fills the header fields of msg from the header values returned
+// by get, whose name lookup must be case-insensitive. The Date header falls
+// back to internalDate, the time the mailbox received the message.
+func readHeaders(msg *Message, get func(name string) string, internalDate time.Time) {
+	msg.From = strings.Join(addressList(get("From")), ", ")
+	msg.Subject = DecodeHeader(get("Subject"))
+	msg.To = addressList(get("To"))
+	msg.Cc = addressList(get("Cc"))
+	msg.ReplyTo = addressList(get("Reply-To"))
+	msg.MessageID = messageID(get("Message-Id"))
+	msg.InReplyTo = messageID(get("In-Reply-To"))
+	msg.References = messageIDs(get("References"))
+
+	if internalDate.IsZero() {
+		internalDate = time.Now()
+	}
+	msg.Received = internalDate
+
+	date, ok := parseDate(get("Date"))
+	if !ok {
+		date = internalDate
+	}
+	msg.Date = date
+}
+
+// DecodeHeader decodes the RFC 2047 encoded words of a header value and
+// unfolds it. Values that cannot be decoded are returned unfolded only.
+func DecodeHeader(value string) string {
+	value = unfold(value)
+	if !strings.Contains(value, "=?") {
+		return value
+	}
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// unfold joins the lines of a folded header value
+func unfold(value string) string {
+	if !strings.ContainsAny(value, "\r\n") {
+		return strings.TrimSpace(value)
+	}
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// addressList decodes an address list header into "Name <address>" entries.
+// A list that does not parse is kept whole as a single decoded entry.
+func addressList(value string) []string {
+	value = unfold(value)
+	if value == "" {
+		return nil
+	}
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	addresses, err := parser.ParseList(value)
+	if err != nil {
+		return []string{DecodeHeader(value)}
+	}
+
+	list := make([]string, 0, len(addresses))
+	for _, a := range addresses {
+		list = append(list, formatAddress(a))
+	}
+	return list
+}
+
+// formatAddress writes an address without encoding its display name, quoting
+// the name when it would not parse back otherwise
+func formatAddress(a *mail.Address) string {
+	if a.Name == "" {
+		return a.Address
+	}
+	name := a.Name
+	if strings.ContainsAny(name, "()<>[]:;@\\,.\"") {
+		name = strconv.Quote(name)
+	}
+	return name + " <" + a.Address + ">"
+}
+
+// messageID returns the first message ID of a Message-ID or In-Reply-To
+// header with its angle brackets
+func messageID(value string) string {
+	value = unfold(value)
+	if start := strings.IndexByte(value, '<'); start >= 0 {
+		if end := strings.IndexByte(value[start:], '>'); end > 0 {
+			return value[start : start+end+1]
+		}
+	}
+	if fields := strings.Fields(value); len(fields) > 0 {
+		return "<" + fields[0] + ">"
+	}
+	return ""
+}
+
+// messageIDs returns the message IDs of a References header in order
+func messageIDs(value string) []string {
+	var ids []string
+	for {
+		start := strings.IndexByte(value, '<')
+		if start < 0 {
+			return ids
+		}
+		end := strings.IndexByte(value[start:], '>')
+		if end < 0 {
+			return ids
+		}
+		ids = append(ids, value[start:start+end+1])
+		value = value[start+end+1:]
+	}
+}
+
+// obsoleteZones are the zone names of RFC 5322 section 4.3 with their offsets in hours
+var obsoleteZones = map[string]int{
+	"UT": 0, "UTC": 0, "GMT": 0, "Z": 0,
+	"EST": -5, "EDT": -4, "CST": -6, "CDT": -5, "MST": -7, "MDT": -6, "PST": -8, "PDT": -7,
+}
+
+// months maps the month names of RFC 5322 dates
+var months = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// parseDate parses the Date header of a message. Besides RFC 5322 dates it
+// accepts what mailers commonly send: comments such as "(UTC)", a missing day
+// of week or seconds, single-digit days, two-digit years, obsolete and
+// military zone names, a missing zone and ISO 8601 timestamps.
+func parseDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(stripComments(unfold(value)))
+	if value == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+
+	fields := strings.Fields(strings.ReplaceAll(value, ",", " "))
+	if len(fields) > 0 && len(fields[0]) >= 3 {
+		if _, err := strconv.Atoi(fields[0]); err != nil {
+			if _, isMonth := months[strings.ToLower(fields[0][:3])]; !isMonth {
+				// Day of week
+				fields = fields[1:]
+			}
+		}
+	}
+	if len(fields) < 4 {
+		return time.Time{}, false
+	}
+
+	day, dayErr := strconv.Atoi(fields[0])
+	month, ok := monthName(fields[1])
+	if dayErr != nil || !ok {
+		// Some mailers put the month first: "Jan 2 2006"
+		day, dayErr = strconv.Atoi(fields[1])
+		month, ok = monthName(fields[0])
+		if dayErr != nil || !ok {
+			return time.Time{}, false
+		}
+	}
+	year, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return time.Time{}, false
+	}
+	switch {
+	case len(fields[2]) <= 2 && year < 50:
+		year += 2000
+	case len(fields[2]) <= 3:
+		year += 1900
+	}
+
+	clock := strings.Split(fields[3], ":")
+	if len(clock) < 2 || len(clock) > 3 {
+		return time.Time{}, false
+	}
+	var hms [3]int
+	for i, part := range clock {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return time.Time{}, false
+		}
+		hms[i] = n
+	}
+
+	offset := 0
+	if len(fields) > 4 {
+		offset, ok = zoneOffset(fields[4])
+		if !ok {
+			return time.Time{}, false
+		}
+	}
+
+	loc := time.UTC
+	if offset != 0 {
+		loc = time.FixedZone("", offset)
+	}
+	t := time.Date(year, month, day, hms[0], hms[1], hms[2], 0, loc)
+	if t.Day() != day || hms[0] > 23 || hms[1] > 59 || hms[2] > 60 {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// monthName returns the month of an English month name or abbreviation
+func monthName(name string) (time.Month, bool) {
+	if len(name) < 3 {
+		return 0, false
+	}
+	month, ok := months[strings.ToLower(name[:3])]
+	return month, ok
+}
+
+// zoneOffset returns the offset in seconds of a numeric or named zone. It
+// fails for zone names RFC 5322 does not define.
+func zoneOffset(zone string) (int, bool) {
+	if len(zone) >= 5 && (zone[0] == '+' || zone[0] == '-') {
+		digits := strings.ReplaceAll(zone[1:], ":", "")
+		if len(digits) != 4 {
+			return 0, false
+		}
+		n, err := strconv.Atoi(digits)
+		if err != nil {
+			return 0, false
+		}
+		offset := (n/100)*3600 + (n%100)*60
+		if zone[0] == '-' {
+			offset = -offset
+		}
+		return offset, true
+	}
+
+	name := strings.ToUpper(zone)
+	if hours, ok := obsoleteZones[name]; ok {
+		return hours * 3600, true
+	}
+	// RFC 5322 reads military zones as UTC, their signs were defined backwards
+	if len(name) == 1 && name[0] >= 'A' && name[0] <= 'Z' && name[0] != 'J' {
+		return 0, true
+	}
+	// Other names such as "MSK" are ambiguous, the date is not trusted
+	return 0, false
+}
+
+// stripComments removes the parenthesized comments of a header value
+func stripComments(value string) string {
+	if !strings.Contains(value, "(") {
+		return value
+	}
+	var b strings.Builder
+	depth := 0
+	escaped := false
+	for _, r := range value {
+		switch {
+		case escaped:
+			escaped = false
+			if depth > 0 {
+				continue
+			}
+		case r == '\\' && depth > 0:
+			escaped = true
+			continue
+		case r == '(':
+			depth++
+			continue
+		case r == ')' && depth > 0:
+			depth--
+			b.WriteByte(' ')
+			continue
+		}
+		if depth == 0 {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
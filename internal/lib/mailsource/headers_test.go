@@ -0,0 +1,200 @@
+package mailsource
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	utc := func(year int, month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+	}
+	tests := []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		{in: "Mon, 02 Jan 2006 15:04:05 -0700", want: utc(2006, 1, 2, 22, 4, 5), ok: true},
+		{in: "Mon, 2 Jan 2006 15:04:05 +0300", want: utc(2006, 1, 2, 12, 4, 5), ok: true},
+		{in: "2 Jan 2006 15:04:05 +0000", want: utc(2006, 1, 2, 15, 4, 5), ok: true},
+		{in: "Mon, 02 Jan 2006 15:04 +0100", want: utc(2006, 1, 2, 14, 4, 0), ok: true},
+		{in: "Mon,02 Jan 2006 15:04:05 GMT", want: utc(2006, 1, 2, 15, 4, 5), ok: true},
+		{in: "Mon, 02 Jan 2006 15:04:05 +0000 (UTC)", want: utc(2006, 1, 2, 15, 4, 5), ok: true},
+		{in: "Mon, 02 Jan 2006 15:04:05 (comment (nested) \\) here) -0500", want: utc(2006, 1, 2, 20, 4, 5), ok: true},
+		{in: "Mon, 02 Jan 2006\r\n 15:04:05 +0000", want: utc(2006, 1, 2, 15, 4, 5), ok: true},
+		{in: "Monday, 02 January 2006 15:04:05 +0000", want: utc(2006, 1, 2, 15, 4, 5), ok: true},
+
+		// Month first
+		{in: "Jan 2 2006 15:04:05 +0000", want: utc(2006, 1, 2, 15, 4, 5), ok: true},
+		{in: "Mon, Jan 02 2006 15:04:05 -0100", want: utc(2006, 1, 2, 16, 4, 5), ok: true},
+
+		// Two- and three-digit years
+		{in: "02 Jan 06 15:04:05 +0000", want: utc(2006, 1, 2, 15, 4, 5), ok: true},
+		{in: "02 Jan 99 15:04:05 +0000", want: utc(1999, 1, 2, 15, 4, 5), ok: true},
+		{in: "02 Jan 106 15:04:05 +0000", want: utc(2006, 1, 2, 15, 4, 5), ok: true},
+
+		// Obsolete and military zones
+		{in: "Mon, 02 Jan 2006 15:04:05 EST", want: utc(2006, 1, 2, 20, 4, 5), ok: true},
+		{in: "Mon, 02 Jan 2006 15:04:05 pdt", want: utc(2006, 1, 2, 22, 4, 5), ok: true},
+		{in: "Mon, 02 Jan 2006 15:04:05 UT", want: utc(2006, 1, 2, 15, 4, 5), ok: true},
+		{in: "Mon, 02 Jan 2006 15:04:05 Z", want: utc(2006, 1, 2, 15, 4, 5), ok: true},
+		{in: "Mon, 02 Jan 2006 15:04:05 A", want: utc(2006, 1, 2, 15, 4, 5), ok: true},
+		{in: "Mon, 02 Jan 2006 15:04:05 +03:00", want: utc(2006, 1, 2, 12, 4, 5), ok: true},
+		{in: "Mon, 02 Jan 2006 15:04:05", want: utc(2006, 1, 2, 15, 4, 5), ok: true},
+
+		// ISO 8601
+		{in: "2006-01-02T15:04:05+02:00", want: utc(2006, 1, 2, 13, 4, 5), ok: true},
+
+		// Unknown zones and invalid dates fall back to the received time
+		{in: "Mon, 02 Jan 2006 15:04:05 MSK"},
+		{in: "Mon, 02 Jan 2006 15:04:05 J"},
+		{in: "Mon, 02 Jan 2006 15:04:05 +030"},
+		{in: "Mon, 31 Feb 2006 15:04:05 +0000"},
+		{in: "Mon, 02 Jan 2006 25:04:05 +0000"},
+		{in: "Mon, 02 Foo 2006 15:04:05 +0000"},
+		{in: "Mon, 02 Jan 2006"},
+		{in: "(only a comment)"},
+		{in: ""},
+	}
+	for _, tt := range tests {
+		got, ok := parseDate(tt.in)
+		if ok != tt.ok || ok && !got.Equal(tt.want) {
+			t.Errorf("parseDate(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestZoneOffset(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{in: "+0000", want: 0, ok: true},
+		{in: "-0000", want: 0, ok: true},
+		{in: "+0530", want: 5*3600 + 30*60, ok: true},
+		{in: "-0800", want: -8 * 3600, ok: true},
+		{in: "+05:30", want: 5*3600 + 30*60, ok: true},
+		{in: "GMT", want: 0, ok: true},
+		{in: "cdt", want: -5 * 3600, ok: true},
+		{in: "MST", want: -7 * 3600, ok: true},
+		{in: "N", want: 0, ok: true},
+		{in: "J"},
+		{in: "MSK"},
+		{in: "CEST"},
+		{in: "+05"},
+		{in: "+0a00"},
+	}
+	for _, tt := range tests {
+		got, ok := zoneOffset(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("zoneOffset(%q) = %d, %v, want %d, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMessageIDs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "<a@example.org> <b@example.org>", want: []string{"<a@example.org>", "<b@example.org>"}},
+		{in: "<a@example.org>\r\n\t<b@example.org>,<c@example.org>", want: []string{"<a@example.org>", "<b@example.org>", "<c@example.org>"}},
+		{in: "(first) <a@example.org> garbage <b@example.org", want: []string{"<a@example.org>"}},
+		{in: "no ids here"},
+		{in: ""},
+	}
+	for _, tt := range tests {
+		got := messageIDs(tt.in)
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("messageIDs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMessageID(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "<a@example.org>", want: "<a@example.org>"},
+		{in: " <a@example.org> (comment)", want: "<a@example.org>"},
+		{in: "a@example.org", want: "<a@example.org>"},
+		{in: "<a@example.org> <b@example.org>", want: "<a@example.org>"},
+		{in: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := messageID(tt.in); got != tt.want {
+			t.Errorf("messageID(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeHeader(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "=?UTF-8?B?0J/RgNC40LLQtdGC?=", want: "Привет"},
+		{in: "=?koi8-r?Q?=F0=D2=C9=D7=C5=D4?= world", want: "Привет world"},
+		{in: "Hello\r\n world", want: "Hello world"},
+		{in: "=?bogus?Q?x?=", want: "=?bogus?Q?x?="},
+		{in: "plain", want: "plain"},
+	}
+	for _, tt := range tests {
+		if got := DecodeHeader(tt.in); got != tt.want {
+			t.Errorf("DecodeHeader(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAddressList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "alice@example.org", want: []string{"alice@example.org"}},
+		{in: "Alice <alice@example.org>, =?UTF-8?B?0JHQvtCx?= <bob@example.org>", want: []string{"Alice <alice@example.org>", "Боб <bob@example.org>"}},
+		{in: `"Smith, John" <john@example.org>`, want: []string{`"Smith, John" <john@example.org>`}},
+		{in: "not an address", want: []string{"not an address"}},
+		{in: ""},
+	}
+	for _, tt := range tests {
+		got := addressList(tt.in)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("addressList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReadHeadersDateFallback(t *testing.T) {
+	received := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+	headers := map[string]string{
+		"date":        "Mon, 02 Jan 2006 15:04:05 MSK",
+		"subject":     "=?UTF-8?B?0J/RgNC40LLQtdGC?=",
+		"message-id":  "<m@example.org>",
+		"in-reply-to": "<p@example.org>",
+		"references":  "<r@example.org> <p@example.org>",
+	}
+	get := func(name string) string { return headers[strings.ToLower(name)] }
+
+	var msg Message
+	readHeaders(&msg, get, received)
+	if !msg.Date.Equal(received) {
+		t.Errorf("Date = %v, want the received time %v", msg.Date, received)
+	}
+	if !msg.Received.Equal(received) {
+		t.Errorf("Received = %v, want %v", msg.Received, received)
+	}
+	if msg.Subject != "Привет" || msg.MessageID != "<m@example.org>" || msg.InReplyTo != "<p@example.org>" {
+		t.Errorf("headers = %q %q %q", msg.Subject, msg.MessageID, msg.InReplyTo)
+	}
+	if strings.Join(msg.References, " ") != "<r@example.org> <p@example.org>" {
+		t.Errorf("References = %q", msg.References)
+	}
+
+	headers["date"] = "Mon, 02 Jan 2006 15:04:05 +0000 (UTC)"
+	readHeaders(&msg, get, received)
+	if want := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC); !msg.Date.Equal(want) {
+		t.Errorf("Date = %v, want %v", msg.Date, want)
+	}
+}
@@ -0,0 +1,341 @@
+package mailsource
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// imapTimeout bounds the connection and every IMAP command
+const imapTimeout = 30 * time.Second
+
+// IMAPConfig holds the connection settings of an IMAP mailbox
+type IMAPConfig struct {
+	Host     string
+	Port     int
+	TLS      bool
+	Username string
+	Password string
+	// Mailbox is the folder messages are ingested from, INBOX by default
+	Mailbox string
+	// ArchiveMailbox and TrashMailbox receive archived and trashed messages
+	ArchiveMailbox string
+	TrashMailbox   string
+	// Control vets the server address after name resolution, see net.Dialer.
+	// Servers of user accounts are dialed with netguard.Control.
+	Control func(network, address string, c syscall.RawConn) error
+}
+
+// IMAP reads a mailbox over IMAP. Message IDs and the cursor have the form
+// UIDVALIDITY.UID, so a reset of the UID validity expires both.
+type IMAP struct {
+	cfg    IMAPConfig
+	mu     sync.Mutex
+	client *client.Client
+	status *imap.MailboxStatus
+}
+
+// DialIMAP connects and logs in to an IMAP server
+func DialIMAP(ctx context.Context, cfg IMAPConfig) (*IMAP, error) {
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "INBOX"
+	}
+	if cfg.ArchiveMailbox == "" {
+		cfg.ArchiveMailbox = "Archive"
+	}
+	if cfg.TrashMailbox == "" {
+		cfg.TrashMailbox = "Trash"
+	}
+
+	dialer := &net.Dialer{Timeout: imapTimeout, Control: cfg.Control}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+
+	var c *client.Client
+	var err error
+	if cfg.TLS {
+		c, err = client.DialWithDialerTLS(dialer, addr, &tls.Config{ServerName: cfg.Host})
+	} else {
+		c, err = client.DialWithDialer(dialer, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Timeout = imapTimeout
+
+	if err := c.Login(cfg.Username, cfg.Password); err != nil {
+		c.Logout()
+		return nil, err
+	}
+	return &IMAP{cfg: cfg, client: c}, nil
+}
+
+// List returns the UIDs of the newest messages of the mailbox
+func (m *IMAP) List(ctx context.Context, limit int) (Listing, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.selectMailbox(); err != nil {
+		return Listing{}, err
+	}
+	uids, err := m.searchUIDs()
+	if err != nil {
+		return Listing{}, err
+	}
+
+	listing := Listing{Cursor: m.formatID(m.lastUID(uids))}
+	if len(uids) > limit {
+		uids = uids[len(uids)-limit:]
+		listing.Truncated = true
+	}
+	for _, uid := range uids {
+		listing.IDs = append(listing.IDs, m.formatID(uid))
+	}
+	return listing, nil
+}
+
+// Changes returns the messages that arrived after the cursor. Plain IMAP cannot
+// report expunged messages, so every present UID is returned as well.
+func (m *IMAP) Changes(ctx context.Context, cursor string) (Changes, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.selectMailbox(); err != nil {
+		return Changes{}, err
+	}
+	last, ok := m.parseID(cursor)
+	if !ok {
+		return Changes{}, ErrCursorExpired
+	}
+
+	uids, err := m.searchUIDs()
+	if err != nil {
+		return Changes{}, err
+	}
+
+	changes := Changes{Cursor: m.formatID(max(last, m.lastUID(uids)))}
+	for _, uid := range uids {
+		id := m.formatID(uid)
+		changes.Present = append(changes.Present, id)
+		if uid > last {
+			changes.Added = append(changes.Added, id)
+		}
+	}
+	return changes, nil
+}
+
+// FetchMessage downloads and parses the message
+func (m *IMAP) FetchMessage(ctx context.Context, id string) (*Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.status == nil {
+		if err := m.selectMailbox(); err != nil {
+			return nil, err
+		}
+	}
+	uid, ok := m.parseID(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uid)
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{section.FetchItem(), imap.FetchFlags, imap.FetchInternalDate, imap.FetchUid}
+
+	ch := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- m.client.UidFetch(seqset, items, ch)
+	}()
+
+	var fetched *imap.Message
+	for msg := range ch {
+		fetched = msg
+	}
+	if err := <-done; err != nil {
+		return nil, err
+	}
+	if fetched == nil {
+		return nil, ErrNotFound
+	}
+
+	body := fetched.GetBody(section)
+	if body == nil {
+		return nil, fmt.Errorf("mailsource: server returned no body for message %s", id)
+	}
+	msg, err := parseMessage(body, fetched.InternalDate)
+	if err != nil {
+		return nil, err
+	}
+	msg.ID = id
+	msg.Labels = flagLabels(fetched.Flags, m.cfg.Mailbox)
+	return msg, nil
+}
+
+// FetchAttachment downloads the message again and returns one of its attachments.
+// IMAP attachments are returned with their data by FetchMessage, so this is rarely needed.
+func (m *IMAP) FetchAttachment(ctx context.Context, messageID, attachmentID string) ([]byte, error) {
+	msg, err := m.FetchMessage(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range msg.Attachments {
+		if a.ID == attachmentID {
+			return a.Data, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// MarkState sets flags on the messages or moves them to the archive or trash folder
+func (m *IMAP) MarkState(ctx context.Context, ids []string, state State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.status == nil {
+		if err := m.selectMailbox(); err != nil {
+			return err
+		}
+	}
+
+	seqset := new(imap.SeqSet)
+	for _, id := range ids {
+		if uid, ok := m.parseID(id); ok {
+			seqset.AddNum(uid)
+		}
+	}
+	if seqset.Empty() {
+		return nil
+	}
+
+	var flags []interface{}
+	if state.Read {
+		flags = append(flags, imap.SeenFlag)
+	}
+	if state.Label != "" {
+		flags = append(flags, keyword(state.Label))
+	}
+	if len(flags) > 0 {
+		if err := m.client.UidStore(seqset, imap.FormatFlagsOp(imap.AddFlags, true), flags, nil); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case state.Trash:
+		return m.client.UidMove(seqset, m.cfg.TrashMailbox)
+	case state.Archive:
+		return m.client.UidMove(seqset, m.cfg.ArchiveMailbox)
+	}
+	return nil
+}
+
+// Close logs out of the server
+func (m *IMAP) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.client.Logout()
+}
+
+// selectMailbox opens the ingested folder, refreshing its UID validity and next UID
+func (m *IMAP) selectMailbox() error {
+	status, err := m.client.Select(m.cfg.Mailbox, false)
+	if err != nil {
+		return err
+	}
+	m.status = status
+	return nil
+}
+
+// searchUIDs returns the sorted UIDs of the messages in the folder, drafts excluded
+func (m *IMAP) searchUIDs() ([]uint32, error) {
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.DraftFlag, imap.DeletedFlag}
+
+	found, err := m.client.UidSearch(criteria)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i] < found[j] })
+	return found, nil
+}
+
+// lastUID returns the highest UID assigned so far in the selected folder
+func (m *IMAP) lastUID(uids []uint32) uint32 {
+	var last uint32
+	if m.status.UidNext > 0 {
+		last = m.status.UidNext - 1
+	}
+	if len(uids) > 0 && uids[len(uids)-1] > last {
+		last = uids[len(uids)-1]
+	}
+	return last
+}
+
+// formatID combines the UID validity of the selected folder with a UID
+func (m *IMAP) formatID(uid uint32) string {
+	return fmt.Sprintf("%d.%d", m.status.UidValidity, uid)
+}
+
+// parseID returns the UID of an ID created by formatID, which is only valid
+// while the UID validity of the folder is unchanged
+func (m *IMAP) parseID(id string) (uint32, bool) {
+	validity, uid, ok := strings.Cut(id, ".")
+	if !ok || validity != strconv.FormatUint(uint64(m.status.UidValidity), 10) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(uid, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(n), true
+}
+
+// flagLabels maps IMAP flags onto the system labels. Keywords are kept as labels.
+func flagLabels(flags []string, mailbox string) []string {
+	labels := []string{}
+	if strings.EqualFold(mailbox, "INBOX") {
+		labels = append(labels, LabelInbox)
+	}
+	seen := false
+	for _, flag := range flags {
+		switch flag {
+		case imap.SeenFlag:
+			seen = true
+		case imap.DraftFlag:
+			labels = append(labels, LabelDraft)
+		default:
+			if !strings.HasPrefix(flag, "\\") {
+				labels = append(labels, flag)
+			}
+		}
+	}
+	if !seen {
+		labels = append(labels, LabelUnread)
+	}
+	return labels
+}
+
+// keyword turns a label name into a valid IMAP keyword
+func keyword(label string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || strings.ContainsRune(`(){%*"\]`, r) {
+			return '_'
+		}
+		return r
+	}, label)
+}
@@ -0,0 +1,288 @@
+package mailsource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/lib/netguard"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+)
+
+// testBackend serves the memory backend with a UID validity the test can
+// change, and MOVE built from copy, flag and expunge
+type testBackend struct {
+	*memory.Backend
+	validity atomic.Uint32
+}
+
+func (b *testBackend) Login(info *imap.ConnInfo, username, password string) (backend.User, error) {
+	u, err := b.Backend.Login(info, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return testUser{User: u, backend: b}, nil
+}
+
+type testUser struct {
+	backend.User
+	backend *testBackend
+}
+
+func (u testUser) GetMailbox(name string) (backend.Mailbox, error) {
+	m, err := u.User.GetMailbox(name)
+	if err != nil {
+		return nil, err
+	}
+	return testMailbox{Mailbox: m, user: u}, nil
+}
+
+type testMailbox struct {
+	backend.Mailbox
+	user testUser
+}
+
+func (m testMailbox) Status(items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	status, err := m.Mailbox.Status(items)
+	if err == nil && status.UidValidity != 0 {
+		status.UidValidity = m.user.backend.validity.Load()
+	}
+	return status, err
+}
+
+func (m testMailbox) MoveMessages(uid bool, seqset *imap.SeqSet, dest string) error {
+	if err := m.CopyMessages(uid, seqset, dest); err != nil {
+		return err
+	}
+	if err := m.UpdateMessagesFlags(uid, seqset, imap.AddFlags, []string{imap.DeletedFlag}); err != nil {
+		return err
+	}
+	return m.Expunge()
+}
+
+// startIMAP runs an in-process IMAP server holding the default message of the
+// memory backend with UID 6 and an empty Trash folder
+func startIMAP(t *testing.T) (*testBackend, IMAPConfig) {
+	t.Helper()
+	be := &testBackend{Backend: memory.New()}
+	be.validity.Store(1)
+	u, err := be.Backend.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.CreateMailbox("Trash"); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := server.New(be)
+	srv.AllowInsecureAuth = true
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	addr := l.Addr().(*net.TCPAddr)
+	return be, IMAPConfig{Host: "127.0.0.1", Port: addr.Port, Username: "username", Password: "password"}
+}
+
+// mailbox returns a folder of the test user straight from the backend
+func (b *testBackend) mailbox(t *testing.T, name string) *memory.Mailbox {
+	t.Helper()
+	u, err := b.Backend.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := u.GetMailbox(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.(*memory.Mailbox)
+}
+
+// deliver appends a message to the inbox
+func (b *testBackend) deliver(t *testing.T, subject string) {
+	t.Helper()
+	body := "From: Alice <alice@example.org>\r\n" +
+		"To: bob@example.org\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: Mon, 02 Jan 2006 15:04:05 +0000\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Hello"
+	err := b.mailbox(t, "INBOX").CreateMessage(nil, time.Now(), bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func dialTest(t *testing.T, cfg IMAPConfig) *IMAP {
+	t.Helper()
+	m, err := DialIMAP(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestIMAPListAndFetch(t *testing.T) {
+	_, cfg := startIMAP(t)
+	m := dialTest(t, cfg)
+	ctx := context.Background()
+
+	listing, err := m.List(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(listing.IDs, ",") != "1.6" || listing.Cursor != "1.6" || listing.Truncated {
+		t.Fatalf("List = %+v, want the message 1.6", listing)
+	}
+
+	msg, err := m.FetchMessage(ctx, "1.6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "A little message, just for you" || msg.ID != "1.6" {
+		t.Errorf("FetchMessage = %q %q", msg.ID, msg.Subject)
+	}
+	if msg.HasLabel(LabelUnread) || !msg.HasLabel(LabelInbox) {
+		t.Errorf("labels = %v, want a read inbox message", msg.Labels)
+	}
+}
+
+func TestIMAPChanges(t *testing.T) {
+	be, cfg := startIMAP(t)
+	m := dialTest(t, cfg)
+	ctx := context.Background()
+
+	listing, err := m.List(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	be.deliver(t, "New")
+	changes, err := m.Changes(ctx, listing.Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(changes.Added, ",") != "1.7" {
+		t.Errorf("Added = %v, want [1.7]", changes.Added)
+	}
+	if strings.Join(changes.Present, ",") != "1.6,1.7" {
+		t.Errorf("Present = %v, want [1.6 1.7]", changes.Present)
+	}
+	if changes.Cursor != "1.7" {
+		t.Errorf("Cursor = %q, want 1.7", changes.Cursor)
+	}
+
+	// Expunged messages are only noticed by their absence from Present
+	inbox := be.mailbox(t, "INBOX")
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(6)
+	if err := inbox.UpdateMessagesFlags(true, seqset, imap.AddFlags, []string{imap.DeletedFlag}); err != nil {
+		t.Fatal(err)
+	}
+	if err := inbox.Expunge(); err != nil {
+		t.Fatal(err)
+	}
+	changes, err = m.Changes(ctx, changes.Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Added) != 0 || strings.Join(changes.Present, ",") != "1.7" || changes.Cursor != "1.7" {
+		t.Errorf("Changes after expunge = %+v", changes)
+	}
+}
+
+func TestIMAPValidityChange(t *testing.T) {
+	be, cfg := startIMAP(t)
+	m := dialTest(t, cfg)
+	ctx := context.Background()
+
+	listing, err := m.List(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	be.validity.Store(2)
+	if _, err := m.Changes(ctx, listing.Cursor); !errors.Is(err, ErrCursorExpired) {
+		t.Errorf("Changes after a UIDVALIDITY change = %v, want ErrCursorExpired", err)
+	}
+	if _, err := m.FetchMessage(ctx, "1.6"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FetchMessage of an old ID = %v, want ErrNotFound", err)
+	}
+
+	listing, err = m.List(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(listing.IDs, ",") != "2.6" {
+		t.Errorf("List after a UIDVALIDITY change = %v, want [2.6]", listing.IDs)
+	}
+	if _, err := m.Changes(ctx, "not-a-cursor"); !errors.Is(err, ErrCursorExpired) {
+		t.Errorf("Changes with a malformed cursor = %v, want ErrCursorExpired", err)
+	}
+}
+
+func TestIMAPMarkState(t *testing.T) {
+	be, cfg := startIMAP(t)
+	be.deliver(t, "Unread")
+	m := dialTest(t, cfg)
+	ctx := context.Background()
+
+	msg, err := m.FetchMessage(ctx, "1.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !msg.HasLabel(LabelUnread) {
+		t.Fatalf("labels = %v, want UNREAD", msg.Labels)
+	}
+
+	if err := m.MarkState(ctx, []string{"1.7"}, State{Read: true, Label: "work stuff"}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err = m.FetchMessage(ctx, "1.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.HasLabel(LabelUnread) || !msg.HasLabel("work_stuff") {
+		t.Errorf("labels after MarkState = %v, want read with work_stuff", msg.Labels)
+	}
+
+	if err := m.MarkState(ctx, []string{"1.7"}, State{Trash: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.FetchMessage(ctx, "1.7"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FetchMessage of a trashed message = %v, want ErrNotFound", err)
+	}
+	if n := len(be.mailbox(t, "Trash").Messages); n != 1 {
+		t.Errorf("Trash holds %d messages, want 1", n)
+	}
+
+	// IDs of another UID validity are ignored
+	if err := m.MarkState(ctx, []string{"9.6"}, State{Trash: true}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(be.mailbox(t, "INBOX").Messages); n != 1 {
+		t.Errorf("INBOX holds %d messages, want 1", n)
+	}
+}
+
+func TestIMAPDialControl(t *testing.T) {
+	_, cfg := startIMAP(t)
+	cfg.Control = netguard.Control
+	_, err := DialIMAP(context.Background(), cfg)
+	if !errors.Is(err, netguard.ErrForbiddenAddress) {
+		t.Errorf("DialIMAP of a loopback server with netguard = %v, want ErrForbiddenAddress", err)
+	}
+}
@@ -0,0 +1,146 @@
+// Package mailsource abstracts the mailbox providers emails are ingested from.
+//
+// Message states use the Gmail system label vocabulary: a message without the
+// UNREAD label is read, INBOX marks messages in the inbox and DRAFT marks drafts.
+// Sources that have no labels map their flags and folders onto these names.
+package mailsource
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// System labels shared by all sources
+const (
+	LabelUnread = "UNREAD"
+	LabelInbox  = "INBOX"
+	LabelDraft  = "DRAFT"
+)
+
+// ErrNotFound is returned when a message or attachment no longer exists in the mailbox
+var ErrNotFound = errors.New("mailsource: message not found")
+
+// ErrCursorExpired is returned by Changes when the cursor can no longer be used
+// and the mailbox has to be listed again
+var ErrCursorExpired = errors.New("mailsource: sync cursor expired")
+
+// MailSource is a mailbox that emails are ingested from
+type MailSource interface {
+	// List returns the IDs of up to limit of the newest messages, drafts excluded,
+	// and a cursor from which Changes reports later modifications
+	List(ctx context.Context, limit int) (Listing, error)
+	// Changes returns the modifications of the mailbox since cursor
+	Changes(ctx context.Context, cursor string) (Changes, error)
+	// FetchMessage downloads a message with its headers, body and attachment metadata
+	FetchMessage(ctx context.Context, id string) (*Message, error)
+	// FetchAttachment downloads the content of an attachment
+	FetchAttachment(ctx context.Context, messageID, attachmentID string) ([]byte, error)
+	// MarkState changes the state of the messages in the mailbox
+	MarkState(ctx context.Context, ids []string, state State) error
+	// Close releases the connection to the mailbox
+	Close() error
+}
+
+// ErrSendNotPermitted is returned by Send when the account did not grant the
+// permission to send mail
+var ErrSendNotPermitted = errors.New("mailsource: not permitted to send")
+
+// Sender is implemented by sources that can send messages
+type Sender interface {
+	// Send delivers an RFC 5322 message, in the source thread threadID unless
+	// it is empty, and returns the ID of the sent message
+	Send(ctx context.Context, raw []byte, threadID string) (string, error)
+}
+
+// Threader is implemented by sources that group messages in threads
+type Threader interface {
+	// ThreadID returns the thread of a message, or ErrNotFound
+	ThreadID(ctx context.Context, id string) (string, error)
+}
+
+// Listing is the result of MailSource.List
+type Listing struct {
+	IDs []string
+	// Truncated is set when the mailbox holds more messages than the limit
+	Truncated bool
+	Cursor    string
+}
+
+// Changes is the result of MailSource.Changes
+type Changes struct {
+	Added   []string
+	Deleted []string
+	// Labels holds the current labels of messages whose labels changed
+	Labels map[string][]string
+	// Present lists every message of the mailbox. Sources that cannot report
+	// deletions set it instead of Deleted.
+	Present []string
+	Cursor  string
+}
+
+// Message is a message downloaded from a source. Address headers are decoded
+// into "Name <address>" entries and message IDs keep their angle brackets.
+type Message struct {
+	ID string
+	// ThreadID is the conversation the source groups the message in, empty for
+	// sources without threads, which are threaded by References instead
+	ThreadID  string
+	Labels    []string
+	From      string
+	To        []string
+	Cc        []string
+	ReplyTo   []string
+	Subject   string
+	MessageID string
+	InReplyTo string
+	// References lists the message IDs of the conversation, oldest first
+	References []string
+	// Date is taken from the Date header, or is the time the mailbox received
+	// the message when the header is missing or invalid
+	Date time.Time
+	// Received is the time the mailbox received the message, which unlike
+	// Date is not set by the sender
+	Received    time.Time
+	HTMLBody    string
+	TextBody    string
+	Attachments []Attachment
+	// Structure is the MIME part tree of the message
+	Structure Part
+}
+
+// Attachment is a file attached to a message. Data is nil when the content has
+// to be downloaded with FetchAttachment.
+type Attachment struct {
+	ID string
+	// PartID locates the attachment in the part tree of the message
+	PartID   string
+	Filename string
+	MimeType string
+	// ContentID is referenced by cid: URLs of the HTML body, Inline is set for
+	// parts meant to be shown within the message such as embedded images
+	ContentID string
+	Inline    bool
+	// Size is the decoded size in bytes, known before the content is downloaded
+	Size int64
+	Data []byte
+}
+
+// State is a change of message state. Zero fields are left untouched.
+type State struct {
+	Read    bool
+	Archive bool
+	Trash   bool
+	// Label is added to the messages, creating it when needed
+	Label string
+}
+
+// HasLabel reports whether the message carries the given label
+func (m *Message) HasLabel(label string) bool {
+	for _, l := range m.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package mailsource
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/charset"
+	"github.com/emersion/go-message/mail"
+)
+
+// Part is a node of the MIME structure of a message. Leaves are either body
+// alternatives or attachments; the content itself is not part of the tree.
+type Part struct {
+	// PartID numbers the part in IMAP style: "1.2" is the second child of the
+	// first child of the root, whose ID is empty
+	PartID      string
+	MimeType    string
+	Charset     string
+	Filename    string
+	ContentID   string
+	Disposition string
+	Size        int64
+	Parts       []Part
+}
+
+// isBody reports whether a leaf part is a text alternative of the message
+// rather than a file
+func (p Part) isBody() bool {
+	if p.Filename != "" || p.Disposition == "attachment" {
+		return false
+	}
+	return p.MimeType == "text/html" || p.MimeType == "text/plain"
+}
+
+// childID returns the ID of the n-th child of the part, counting from 1
+func (p Part) childID(n int) string {
+	if p.PartID == "" {
+		return strconv.Itoa(n)
+	}
+	return p.PartID + "." + strconv.Itoa(n)
+}
+
+// addLeaf records a leaf part as a body alternative or an attachment. text is
+// the UTF-8 content of body parts; data is the content of attachments, nil if
+// it has to be downloaded with sourceID.
+func (m *Message) addLeaf(part Part, text string, data []byte, sourceID string) {
+	if part.isBody() {
+		// Every text part of a multipart/mixed message is shown, in order
+		if part.MimeType == "text/html" {
+			m.HTMLBody = joinBody(m.HTMLBody, text)
+		} else {
+			m.TextBody = joinBody(m.TextBody, text)
+		}
+		return
+	}
+
+	if sourceID == "" {
+		sourceID = part.PartID
+	}
+	m.Attachments = append(m.Attachments, Attachment{
+		ID:        sourceID,
+		PartID:    part.PartID,
+		Filename:  part.Filename,
+		MimeType:  part.MimeType,
+		ContentID: part.ContentID,
+		Inline:    part.Disposition == "inline" || part.Disposition == "" && part.ContentID != "",
+		Size:      part.Size,
+		Data:      data,
+	})
+}
+
+// joinBody appends a body part to the ones found before it
+func joinBody(body, part string) string {
+	if body == "" {
+		return part
+	}
+	return body + "\n" + part
+}
+
+// decodeCharset converts text in the given charset to UTF-8. Unknown charsets
+// are returned unchanged rather than dropping the text.
+func decodeCharset(data []byte, label string) string {
+	switch strings.ToLower(label) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return string(data)
+	}
+	r, err := charset.Reader(label, bytes.NewReader(data))
+	if err != nil {
+		return string(data)
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return string(data)
+	}
+	return string(decoded)
+}
+
+// contentID returns the Content-ID header value without its angle brackets
+func contentID(value string) string {
+	return strings.Trim(strings.TrimSpace(value), "<>")
+}
+
+// readEntity walks an RFC 5322 entity, filling the bodies and attachments of
+// msg, and returns its part tree. go-message has already decoded the transfer
+// encoding and the charset of text parts.
+func readEntity(msg *Message, e *message.Entity, id string) (Part, error) {
+	mediaType, params, _ := e.Header.ContentType()
+	disposition, _, _ := e.Header.ContentDisposition()
+	filename, _ := (&mail.AttachmentHeader{Header: e.Header}).Filename()
+	part := Part{
+		PartID:      id,
+		MimeType:    strings.ToLower(mediaType),
+		Charset:     params["charset"],
+		Filename:    filename,
+		ContentID:   contentID(e.Header.Get("Content-Id")),
+		Disposition: strings.ToLower(disposition),
+	}
+
+	if mr := e.MultipartReader(); mr != nil {
+		for n := 1; ; n++ {
+			child, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil && !isUnknownEncoding(err) {
+				return part, err
+			}
+			childPart, err := readEntity(msg, child, part.childID(n))
+			if err != nil {
+				return part, err
+			}
+			part.Parts = append(part.Parts, childPart)
+		}
+		return part, nil
+	}
+
+	data, err := io.ReadAll(e.Body)
+	if err != nil {
+		return part, err
+	}
+	part.Size = int64(len(data))
+	msg.addLeaf(part, string(data), data, "")
+	return part, nil
+}
+
+// parseMessage reads the headers, the bodies, the attachments and the part tree
+// of an RFC 5322 message
+func parseMessage(r io.Reader, internalDate time.Time) (*Message, error) {
+	e, err := message.Read(r)
+	if err != nil && !isUnknownEncoding(err) {
+		return nil, err
+	}
+
+	msg := &Message{}
+	readHeaders(msg, e.Header.Get, internalDate)
+
+	msg.Structure, err = readEntity(msg, e, "")
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// isUnknownEncoding reports whether go-message could not decode a part, which
+// is then read as is
+func isUnknownEncoding(err error) bool {
+	return message.IsUnknownCharset(err) || message.IsUnknownEncoding(err)
+}
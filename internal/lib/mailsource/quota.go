@@ -0,0 +1,50 @@
+package mailsource
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Quota is a token bucket of API quota units, such as the Gmail per-user limit
+// of 250 units per second. A nil Quota never waits.
+type Quota struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// NewQuota creates a bucket refilled with unitsPerSecond units per second and
+// holding at most one second of units
+func NewQuota(unitsPerSecond int) *Quota {
+	return &Quota{rate: float64(unitsPerSecond), tokens: float64(unitsPerSecond), last: time.Now()}
+}
+
+// Wait blocks until units are available or the context is cancelled
+func (q *Quota) Wait(ctx context.Context, units int) error {
+	if q == nil || q.rate <= 0 {
+		return nil
+	}
+	need := min(float64(units), q.rate)
+
+	for {
+		q.mu.Lock()
+		now := time.Now()
+		q.tokens = min(q.rate, q.tokens+now.Sub(q.last).Seconds()*q.rate)
+		q.last = now
+		if q.tokens >= need {
+			q.tokens -= need
+			q.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((need - q.tokens) / q.rate * float64(time.Second))
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
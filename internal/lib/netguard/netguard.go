@@ -0,0 +1,35 @@
+// Package netguard keeps connections opened on behalf of users away from the
+// server's own network, such as the local Postgres and Redis or private hosts.
+package netguard
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// ErrForbiddenAddress is returned when a host resolves to a private or local address
+var ErrForbiddenAddress = errors.New("netguard: forbidden address")
+
+// Control refuses connections to loopback, private, link-local and other
+// non-public addresses. Used as the Control of a net.Dialer, it runs after name
+// resolution for every connection attempt.
+func Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !PublicIP(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// PublicIP reports whether ip is a globally routable unicast address
+func PublicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
@@ -0,0 +1,130 @@
+package searchquery
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// dateLayouts are the date formats accepted by before: and after:
+var dateLayouts = []string{"2006/01/02", "2006-01-02", "2006/1/2", "2006-1-2"}
+
+// Query is a parsed Gmail-like search query
+type Query struct {
+	// Text is the free-text part, in websearch_to_tsquery syntax
+	Text          string
+	From          []string
+	Subject       []string
+	HasAttachment bool
+	IsRead        *bool
+	Before        *time.Time
+	After         *time.Time
+}
+
+// Parse parses a query such as `from:alice subject:"weekly report" has:attachment after:2024/01/01 budget`.
+// Unknown operators are kept as free text.
+func Parse(q string) (Query, error) {
+	var query Query
+	var text []string
+
+	for _, token := range tokenize(q) {
+		key, value, found := strings.Cut(token, ":")
+		if !found || value == "" {
+			text = append(text, token)
+			continue
+		}
+		value = unquote(value)
+
+		switch strings.ToLower(key) {
+		case "from":
+			query.From = append(query.From, value)
+		case "subject":
+			query.Subject = append(query.Subject, value)
+		case "has":
+			if strings.ToLower(value) != "attachment" {
+				return query, fmt.Errorf("unsupported operator has:%s", value)
+			}
+			query.HasAttachment = true
+		case "is":
+			switch strings.ToLower(value) {
+			case "read":
+				read := true
+				query.IsRead = &read
+			case "unread":
+				read := false
+				query.IsRead = &read
+			default:
+				return query, fmt.Errorf("unsupported operator is:%s", value)
+			}
+		case "before", "after":
+			date, err := parseDate(value)
+			if err != nil {
+				return query, fmt.Errorf("invalid date in %s:%s", key, value)
+			}
+			if strings.ToLower(key) == "before" {
+				query.Before = &date
+			} else {
+				query.After = &date
+			}
+		default:
+			text = append(text, token)
+		}
+	}
+
+	query.Text = strings.Join(text, " ")
+	return query, nil
+}
+
+// IsEmpty reports whether the query has neither text nor operators
+func (q Query) IsEmpty() bool {
+	return q.Text == "" && len(q.From) == 0 && len(q.Subject) == 0 && !q.HasAttachment &&
+		q.IsRead == nil && q.Before == nil && q.After == nil
+}
+
+// tokenize splits the query on whitespace, keeping double-quoted parts together
+func tokenize(q string) []string {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+
+	for _, r := range q {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// unquote removes the surrounding double quotes of an operator value
+func unquote(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		return s[1 : len(s)-1]
+	}
+	return strings.Trim(s, `"`)
+}
+
+// parseDate parses the date of a before: or after: operator
+func parseDate(s string) (time.Time, error) {
+	var err error
+	for _, layout := range dateLayouts {
+		var t time.Time
+		t, err = time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
@@ -0,0 +1,66 @@
+package searchquery
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	date := func(year int, month time.Month, day int) *time.Time {
+		d := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		return &d
+	}
+	read, unread := true, false
+
+	tests := []struct {
+		in      string
+		want    Query
+		wantErr bool
+	}{
+		{in: "", want: Query{}},
+		{in: "budget  report", want: Query{Text: "budget report"}},
+		{in: `"budget report" q3`, want: Query{Text: `"budget report" q3`}},
+		{in: "from:alice FROM:bob", want: Query{From: []string{"alice", "bob"}}},
+		{in: `subject:"weekly report" budget`, want: Query{Subject: []string{"weekly report"}, Text: "budget"}},
+		{in: "has:attachment", want: Query{HasAttachment: true}},
+		{in: "is:read", want: Query{IsRead: &read}},
+		{in: "is:Unread", want: Query{IsRead: &unread}},
+		{in: "after:2024/01/02 before:2024-2-3", want: Query{After: date(2024, 1, 2), Before: date(2024, 2, 3)}},
+		{in: "label:work from: x", want: Query{Text: "label:work from: x"}},
+		{in: `subject:"unterminated value`, want: Query{Subject: []string{"unterminated value"}}},
+		{in: "has:drive", wantErr: true},
+		{in: "is:starred", wantErr: true},
+		{in: "before:yesterday", wantErr: true},
+		{in: "after:2024/13/01", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	read := false
+	tests := []struct {
+		q    Query
+		want bool
+	}{
+		{q: Query{}, want: true},
+		{q: Query{Text: "x"}},
+		{q: Query{From: []string{"alice"}}},
+		{q: Query{HasAttachment: true}},
+		{q: Query{IsRead: &read}},
+	}
+	for _, tt := range tests {
+		if got := tt.q.IsEmpty(); got != tt.want {
+			t.Errorf("%+v.IsEmpty() = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Package secretbox encrypts credentials such as IMAP passwords before they
+// are stored, with AES-256-GCM under a key only the server holds.
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// prefix marks sealed values and the format version
+const prefix = "gcm1:"
+
+// ErrOpen is returned when a sealed value was not sealed by this key for the
+// same associated data, or has been tampered with
+var ErrOpen = errors.New("secretbox: cannot open sealed value")
+
+// Box seals and opens values with one key
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New creates a box whose AES-256 key is derived from secret
+func New(secret string) (*Box, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Sealed reports whether the value was produced by Seal
+func Sealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Seal encrypts plaintext bound to the associated data, which Open must be
+// given again, e.g. the row the value is stored in
+func (b *Box) Seal(plaintext, data string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), []byte(data))
+	return prefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value returned by Seal with the same associated data
+func (b *Box) Open(value, data string) (string, error) {
+	if !Sealed(value) {
+		return "", ErrOpen
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(value[len(prefix):])
+	if err != nil || len(sealed) < b.aead.NonceSize() {
+		return "", ErrOpen
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, []byte(data))
+	if err != nil {
+		return "", ErrOpen
+	}
+	return string(plaintext), nil
+}
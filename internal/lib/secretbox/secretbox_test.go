@@ -0,0 +1,55 @@
+package secretbox
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	box, err := New("0123456789abcdef0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := box.Seal("hunter2", "alice@imap.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Sealed(sealed) || strings.Contains(sealed, "hunter2") {
+		t.Fatalf("Seal() = %q", sealed)
+	}
+	if again, _ := box.Seal("hunter2", "alice@imap.example.org"); again == sealed {
+		t.Error("Seal() reused a nonce")
+	}
+	if got, err := box.Open(sealed, "alice@imap.example.org"); err != nil || got != "hunter2" {
+		t.Errorf("Open() = %q, %v, want hunter2", got, err)
+	}
+
+	other, err := New("another secret of thirty-two bytes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if tampered == sealed {
+		tampered = sealed[:len(sealed)-2] + "BB"
+	}
+	tests := []struct {
+		name  string
+		box   *Box
+		value string
+		data  string
+	}{
+		{name: "other row", box: box, value: sealed, data: "mallory@imap.example.org"},
+		{name: "other key", box: other, value: sealed, data: "alice@imap.example.org"},
+		{name: "tampered", box: box, value: tampered, data: "alice@imap.example.org"},
+		{name: "plaintext", box: box, value: "hunter2", data: "alice@imap.example.org"},
+		{name: "truncated", box: box, value: "gcm1:AAAA", data: "alice@imap.example.org"},
+		{name: "bad encoding", box: box, value: "gcm1:!!", data: "alice@imap.example.org"},
+	}
+	for _, tt := range tests {
+		if _, err := tt.box.Open(tt.value, tt.data); !errors.Is(err, ErrOpen) {
+			t.Errorf("Open() of %s = %v, want ErrOpen", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeBotAPI serves the Bot API with handle and counts the requests it gets
+func fakeBotAPI(t *testing.T, handle func(w http.ResponseWriter, r *http.Request, n int32)) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle(w, r, atomic.AddInt32(&calls, 1))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestSendMessage(t *testing.T) {
+	srv, calls := fakeBotAPI(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		if r.Method != http.MethodPost || r.URL.Path != "/botTOKEN/sendMessage" {
+			t.Errorf("request = %s %s, want POST /botTOKEN/sendMessage", r.Method, r.URL.Path)
+		}
+		var params map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			t.Fatal(err)
+		}
+		if params["chat_id"] != float64(42) || params["text"] != "<b>hi</b>" || params["parse_mode"] != "HTML" {
+			t.Errorf("params = %v", params)
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	})
+
+	c := NewClient(srv.URL+"/", "TOKEN", 3)
+	if err := c.SendMessage(context.Background(), 42, "<b>hi</b>"); err != nil {
+		t.Fatalf("SendMessage() = %v", err)
+	}
+	if *calls != 1 {
+		t.Errorf("calls = %d, want 1", *calls)
+	}
+}
+
+func TestGetUpdates(t *testing.T) {
+	srv, _ := fakeBotAPI(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		var params map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&params)
+		if params["offset"] != float64(10) || params["timeout"] != float64(5) {
+			t.Errorf("params = %v", params)
+		}
+		w.Write([]byte(`{"ok":true,"result":[{"update_id":10,"message":{"message_id":3,"chat":{"id":42,"type":"private"},"text":"/start"}}]}`))
+	})
+
+	updates, err := NewClient(srv.URL, "TOKEN", 0).GetUpdates(context.Background(), 10, 5*time.Second)
+	if err != nil {
+		t.Fatalf("GetUpdates() = %v", err)
+	}
+	if len(updates) != 1 || updates[0].Message == nil || updates[0].Message.Chat.ID != 42 || updates[0].Message.Text != "/start" {
+		t.Errorf("GetUpdates() = %+v", updates)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	srv, calls := fakeBotAPI(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		if n == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 1","parameters":{"retry_after":1}}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	})
+
+	start := time.Now()
+	if err := NewClient(srv.URL, "TOKEN", 3).SendMessage(context.Background(), 42, "hi"); err != nil {
+		t.Fatalf("SendMessage() = %v", err)
+	}
+	if *calls != 2 {
+		t.Errorf("calls = %d, want 2", *calls)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want at least retry_after", elapsed)
+	}
+}
+
+func TestRetryServerError(t *testing.T) {
+	srv, calls := fakeBotAPI(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		if n == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`<html>502 Bad Gateway</html>`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	})
+
+	if err := NewClient(srv.URL, "TOKEN", 1).SendMessage(context.Background(), 42, "hi"); err != nil {
+		t.Fatalf("SendMessage() = %v", err)
+	}
+	if *calls != 2 {
+		t.Errorf("calls = %d, want 2", *calls)
+	}
+}
+
+func TestRetryLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		wantCalls int32
+		wantCode  int
+	}{
+		{name: "rate limited", status: http.StatusTooManyRequests, body: `{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":0}}`, wantCalls: 1, wantCode: 429},
+		{name: "server error", status: http.StatusInternalServerError, body: `{"ok":false,"error_code":500,"description":"Internal Server Error"}`, wantCalls: 1, wantCode: 500},
+		{name: "bad request is not retried", status: http.StatusBadRequest, body: `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`, wantCalls: 1, wantCode: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := fakeBotAPI(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			err := NewClient(srv.URL, "TOKEN", 0).SendMessage(context.Background(), 42, "hi")
+			var apiErr *Error
+			if !errors.As(err, &apiErr) || apiErr.Code != tt.wantCode {
+				t.Fatalf("SendMessage() = %v, want code %d", err, tt.wantCode)
+			}
+			if *calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", *calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	srv, calls := fakeBotAPI(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":30}}`))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := NewClient(srv.URL, "TOKEN", 3).SendMessage(ctx, 42, "hi"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SendMessage() = %v, want context.DeadlineExceeded", err)
+	}
+	if *calls != 1 {
+		t.Errorf("calls = %d, want 1", *calls)
+	}
+}
+
+func TestErrorHidesToken(t *testing.T) {
+	srv, _ := fakeBotAPI(t, func(w http.ResponseWriter, r *http.Request, n int32) {})
+	srv.Close()
+
+	err := NewClient(srv.URL, "SECRET", 0).SendMessage(context.Background(), 42, "hi")
+	if err == nil {
+		t.Fatal("SendMessage() to a closed server succeeded")
+	}
+	if msg := err.Error(); strings.Contains(msg, "SECRET") {
+		t.Errorf("error %q leaks the bot token", msg)
+	}
+}
@@ -0,0 +1,192 @@
+package authService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/mailsource"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/netguard"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/oauth2"
+)
+
+// ErrAccountNotFound is returned when the linked account does not exist or belongs to another user
+var ErrAccountNotFound = errors.New("linked account not found")
+
+// ErrAccountLinkedElsewhere is returned when a mailbox is already linked to another user
+var ErrAccountLinkedElsewhere = errors.New("mailbox is linked to another user")
+
+// ErrIMAPLogin is returned when the IMAP server cannot be reached or rejects the credentials
+var ErrIMAPLogin = errors.New("IMAP login failed")
+
+const accountColumns = `id, user_id, provider, external_id, address, access_token, refresh_token, COALESCE(expires_at, 'epoch'),
+	COALESCE(imap_host, ''), COALESCE(imap_port, 0), imap_tls, COALESCE(imap_username, ''), COALESCE(imap_password, ''), created_at`
+
+// scanAccount reads a linked account row selected with accountColumns and
+// decrypts its IMAP password
+func (s *AuthService) scanAccount(row pgx.Row) (models.LinkedAccount, error) {
+	var a models.LinkedAccount
+	err := row.Scan(&a.ID, &a.UserID, &a.Provider, &a.ExternalID, &a.Address, &a.AccessToken, &a.RefreshToken, &a.ExpiresAt,
+		&a.IMAPHost, &a.IMAPPort, &a.IMAPTLS, &a.IMAPUsername, &a.IMAPPassword, &a.CreatedAt)
+	if err != nil {
+		return a, err
+	}
+	a.IMAPPassword = s.openPassword(a)
+	return a, nil
+}
+
+// LinkAccount connects a mailbox to the user, or updates its address and tokens
+// when it is already linked to them
+func (s *AuthService) LinkAccount(userID int, provider, externalID, address string, token *oauth2.Token) (models.LinkedAccount, error) {
+	row := s.psql.QueryRow(context.Background(), `
+		INSERT INTO linked_accounts (user_id, provider, external_id, address, access_token, refresh_token, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (provider, external_id) DO UPDATE
+		SET address = EXCLUDED.address,
+			access_token = EXCLUDED.access_token,
+			refresh_token = COALESCE(NULLIF(EXCLUDED.refresh_token, ''), linked_accounts.refresh_token),
+			expires_at = EXCLUDED.expires_at
+		WHERE linked_accounts.user_id = EXCLUDED.user_id
+		RETURNING `+accountColumns,
+		userID, provider, externalID, address, token.AccessToken, token.RefreshToken, token.Expiry,
+	)
+	account, err := s.scanAccount(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The conflicting row was left untouched because it belongs to someone else
+		return account, ErrAccountLinkedElsewhere
+	}
+	return account, err
+}
+
+// LinkIMAPAccount checks that the IMAP server accepts the credentials and connects
+// the mailbox to the user, or updates its settings when it is already linked to them
+func (s *AuthService) LinkIMAPAccount(ctx context.Context, userID int, address string, cfg mailsource.IMAPConfig) (models.LinkedAccount, error) {
+	// The host is chosen by the user, it must not reach the server's own network
+	cfg.Control = netguard.Control
+	source, err := mailsource.DialIMAP(ctx, cfg)
+	if errors.Is(err, netguard.ErrForbiddenAddress) {
+		return models.LinkedAccount{}, fmt.Errorf("%w: the host is not a public address", ErrIMAPLogin)
+	}
+	if err != nil {
+		// The details stay in the log, they would tell which internal ports are open
+		s.Log.Warn("IMAP login failed", "user", userID, "host", cfg.Host, "port", cfg.Port, "error", err)
+		return models.LinkedAccount{}, fmt.Errorf("%w: could not connect or log in", ErrIMAPLogin)
+	}
+	source.Close()
+
+	if address == "" {
+		address = cfg.Username
+	}
+	externalID := strings.ToLower(cfg.Username + "@" + cfg.Host)
+	password, err := s.credentials.Seal(cfg.Password, externalID)
+	if err != nil {
+		return models.LinkedAccount{}, err
+	}
+
+	row := s.psql.QueryRow(ctx, `
+		INSERT INTO linked_accounts (user_id, provider, external_id, address, imap_host, imap_port, imap_tls, imap_username, imap_password)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (provider, external_id) DO UPDATE
+		SET address = EXCLUDED.address,
+			imap_port = EXCLUDED.imap_port,
+			imap_tls = EXCLUDED.imap_tls,
+			imap_password = EXCLUDED.imap_password
+		WHERE linked_accounts.user_id = EXCLUDED.user_id
+		RETURNING `+accountColumns,
+		userID, models.ProviderIMAP, externalID, address, cfg.Host, cfg.Port, cfg.TLS, cfg.Username, password,
+	)
+	account, err := s.scanAccount(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return account, ErrAccountLinkedElsewhere
+	}
+	return account, err
+}
+
+// SaveAccountToken stores refreshed OAuth tokens of a linked account
+func (s *AuthService) SaveAccountToken(accountID int, token *oauth2.Token) error {
+	_, err := s.psql.Exec(context.Background(), `
+		UPDATE linked_accounts
+		SET access_token = $2, refresh_token = COALESCE(NULLIF($3, ''), refresh_token), expires_at = $4
+		WHERE id = $1`,
+		accountID, token.AccessToken, token.RefreshToken, token.Expiry,
+	)
+	if err != nil {
+		s.Log.Error("Failed to save account tokens to DB", "account", accountID, "error", err)
+	}
+	return err
+}
+
+// AccountToken returns a valid OAuth token of the linked account, refreshing it first if it has expired
+func (s *AuthService) AccountToken(account models.LinkedAccount) (*oauth2.Token, error) {
+	token := &oauth2.Token{
+		AccessToken:  account.AccessToken,
+		RefreshToken: account.RefreshToken,
+		Expiry:       account.ExpiresAt,
+		TokenType:    "Bearer",
+	}
+	if time.Now().After(token.Expiry) {
+		return s.RefreshToken(account.ID, token)
+	}
+	return token, nil
+}
+
+// GetAccount retrieves a linked account by its ID
+func (s *AuthService) GetAccount(accountID int) (models.LinkedAccount, error) {
+	row := s.psql.QueryRow(context.Background(), "SELECT "+accountColumns+" FROM linked_accounts WHERE id=$1", accountID)
+	account, err := s.scanAccount(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return account, ErrAccountNotFound
+	}
+	return account, err
+}
+
+// ListAccounts retrieves the mailboxes linked to the user
+func (s *AuthService) ListAccounts(userID int) ([]models.LinkedAccount, error) {
+	return s.queryAccounts(context.Background(), "SELECT "+accountColumns+" FROM linked_accounts WHERE user_id=$1 ORDER BY id", userID)
+}
+
+// FindAccountsByAddress retrieves the linked accounts of a provider with the given address
+func (s *AuthService) FindAccountsByAddress(provider, address string) ([]models.LinkedAccount, error) {
+	return s.queryAccounts(context.Background(), "SELECT "+accountColumns+" FROM linked_accounts WHERE provider=$1 AND lower(address)=lower($2)", provider, address)
+}
+
+// ListAllAccounts retrieves the mailboxes of all users
+func (s *AuthService) ListAllAccounts() ([]models.LinkedAccount, error) {
+	return s.queryAccounts(context.Background(), "SELECT "+accountColumns+" FROM linked_accounts ORDER BY id")
+}
+
+// UnlinkAccount disconnects a mailbox from the user, deleting its emails with
+// it. It runs in tx so that the caller can clean up what the deletion leaves behind.
+func (s *AuthService) UnlinkAccount(ctx context.Context, tx pgx.Tx, userID, accountID int) error {
+	tag, err := tx.Exec(ctx, "DELETE FROM linked_accounts WHERE id=$1 AND user_id=$2", accountID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
+}
+
+// queryAccounts runs a linked account query selecting accountColumns
+func (s *AuthService) queryAccounts(ctx context.Context, sql string, args ...interface{}) ([]models.LinkedAccount, error) {
+	rows, err := s.psql.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []models.LinkedAccount{}
+	for rows.Next() {
+		a, err := s.scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
@@ -5,11 +5,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/17HIERARCH70/SocialManager/internal/config"
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/jwt"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/secretbox"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"golang.org/x/exp/slog"
 	"golang.org/x/oauth2"
@@ -17,27 +24,59 @@ import (
 	"google.golang.org/api/gmail/v1"
 )
 
+// ErrRefreshTokenReused is returned when a spent refresh token is presented again
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
 // AuthService handles authentication and token management
 type AuthService struct {
 	psql        *pgxpool.Pool
+	redis       *redis.Client
 	oauthConfig *oauth2.Config
+	admins      map[string]bool
+	redirects   []*url.URL
+	// credentials encrypts the IMAP passwords of linked accounts
+	credentials *secretbox.Box
 	Log         *slog.Logger
 }
 
 // NewAuthService creates a new AuthService
-func NewAuthService(psql *pgxpool.Pool, cfg *config.Config, log *slog.Logger) (*AuthService, error) {
+func NewAuthService(psql *pgxpool.Pool, rdb *redis.Client, cfg *config.Config, log *slog.Logger) (*AuthService, error) {
 	oauthConfig, err := loadOAuthConfig(cfg.OAuth2.CredentialPath)
 	if err != nil {
 		return nil, err
 	}
 
+	admins := make(map[string]bool, len(cfg.Auth.Admins))
+	for _, email := range cfg.Auth.Admins {
+		admins[strings.ToLower(strings.TrimSpace(email))] = true
+	}
+
+	redirects, err := parseRedirectURLs(cfg.Auth.RedirectURLs)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := secretbox.New(cfg.Auth.CredentialKey)
+	if err != nil {
+		return nil, err
+	}
+
 	return &AuthService{
 		psql:        psql,
+		redis:       rdb,
 		oauthConfig: oauthConfig,
+		admins:      admins,
+		redirects:   redirects,
+		credentials: credentials,
 		Log:         log,
 	}, nil
 }
 
+// requiredScopes are the scopes a login must grant. Sending is optional: the
+// consent screen lets users decline it, and sending then fails with
+// ErrSendNotPermitted.
+var requiredScopes = []string{gmail.GmailReadonlyScope, gmail.GmailModifyScope}
+
 // loadOAuthConfig loads the OAuth configuration from a file
 func loadOAuthConfig(credentialsFile string) (*oauth2.Config, error) {
 	b, err := os.ReadFile(credentialsFile)
@@ -45,7 +84,8 @@ func loadOAuthConfig(credentialsFile string) (*oauth2.Config, error) {
 		return nil, err
 	}
 
-	return google.ConfigFromJSON(b, gmail.GmailReadonlyScope, gmail.GmailModifyScope, "https://www.googleapis.com/auth/userinfo.profile", "https://www.googleapis.com/auth/userinfo.email")
+	scopes := append(requiredScopes[:len(requiredScopes):len(requiredScopes)], gmail.GmailSendScope, "https://www.googleapis.com/auth/userinfo.profile", "https://www.googleapis.com/auth/userinfo.email")
+	return google.ConfigFromJSON(b, scopes...)
 }
 
 // OAuthConfig returns the OAuth configuration
@@ -53,9 +93,9 @@ func (s *AuthService) OAuthConfig() *oauth2.Config {
 	return s.oauthConfig
 }
 
-// ExchangeToken exchanges the authorization code for an access token
-func (s *AuthService) ExchangeToken(code string) (*oauth2.Token, error) {
-	token, err := s.oauthConfig.Exchange(context.Background(), code)
+// ExchangeToken exchanges the authorization code and its PKCE verifier for an access token
+func (s *AuthService) ExchangeToken(code, verifier string) (*oauth2.Token, error) {
+	token, err := s.oauthConfig.Exchange(context.Background(), code, oauth2.VerifierOption(verifier))
 	if err != nil {
 		return nil, err
 	}
@@ -64,22 +104,10 @@ func (s *AuthService) ExchangeToken(code string) (*oauth2.Token, error) {
 		return nil, fmt.Errorf("insufficient token scopes")
 	}
 
-	userID, err := s.GetUserIDByToken(token)
-	if err != nil {
-		return nil, err
-	}
-
-	if token.Expiry.Before(time.Now()) {
-		token, err = s.RefreshToken(userID, token)
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	return token, nil
 }
 
-// hasRequiredScopes checks if the token has the required scopes
+// hasRequiredScopes checks if the token has the required scopes, the optional ones may be missing
 func (s *AuthService) hasRequiredScopes(token *oauth2.Token) bool {
 	client := s.oauthConfig.Client(context.Background(), token)
 	resp, err := client.Get("https://www.googleapis.com/oauth2/v1/tokeninfo?access_token=" + token.AccessToken)
@@ -93,14 +121,17 @@ func (s *AuthService) hasRequiredScopes(token *oauth2.Token) bool {
 		return false
 	}
 
-	scopes, ok := tokenInfo["scope"].(string)
+	scope, ok := tokenInfo["scope"].(string)
 	if !ok {
 		return false
 	}
 
-	requiredScopes := s.oauthConfig.Scopes
-	for _, scope := range requiredScopes {
-		if !strings.Contains(scopes, scope) {
+	granted := make(map[string]bool)
+	for _, name := range strings.Fields(scope) {
+		granted[name] = true
+	}
+	for _, required := range requiredScopes {
+		if !granted[required] {
 			return false
 		}
 	}
@@ -124,85 +155,171 @@ func (s *AuthService) FetchUserInfo(token *oauth2.Token) (map[string]interface{}
 	return userInfo, nil
 }
 
-// SaveUserToDB saves the user info to the database
-func (s *AuthService) SaveUserToDB(userInfo map[string]interface{}) (int, error) {
-	tx, err := s.psql.Begin(context.Background())
-	if err != nil {
-		return 0, err
-	}
-	defer tx.Rollback(context.Background())
+// SaveUserToDB saves the user info to the database and returns the user ID and role.
+// Logging in with a mailbox linked to another user logs into that user.
+// Users listed in auth.admins are promoted to admins.
+func (s *AuthService) SaveUserToDB(userInfo map[string]interface{}) (int, string, error) {
+	ctx := context.Background()
+	email, _ := userInfo["email"].(string)
+	isAdmin := s.admins[strings.ToLower(email)]
 
-	query := `INSERT INTO users (google_id, email) VALUES ($1, $2)
-              ON CONFLICT (google_id) DO NOTHING RETURNING id`
 	var userID int
-	err = tx.QueryRow(context.Background(), query, userInfo["sub"], userInfo["email"]).Scan(&userID)
-	if err != nil {
-		if err.Error() == "no rows in result set" {
-			var id int
-			err = tx.QueryRow(context.Background(), "SELECT id FROM users WHERE google_id=$1", userInfo["sub"]).Scan(&id)
-			if err != nil {
-				return 0, err
-			}
-			userID = id
-		} else {
-			return 0, err
-		}
+	var role string
+	err := s.psql.QueryRow(ctx, `
+		UPDATE users u SET role = CASE WHEN $3 THEN 'admin' ELSE u.role END
+		FROM linked_accounts a
+		WHERE a.user_id = u.id AND a.provider = $1 AND a.external_id = $2
+		RETURNING u.id, u.role`,
+		models.ProviderGmail, userInfo["sub"], isAdmin,
+	).Scan(&userID, &role)
+	if err == nil {
+		return userID, role, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, "", err
 	}
 
-	if err := tx.Commit(context.Background()); err != nil {
-		return 0, err
+	query := `INSERT INTO users (google_id, email, role) VALUES ($1, $2, CASE WHEN $3 THEN 'admin' ELSE 'user' END)
+              ON CONFLICT (google_id) DO UPDATE SET role = CASE WHEN $3 THEN 'admin' ELSE users.role END
+              RETURNING id, role`
+	err = s.psql.QueryRow(ctx, query, userInfo["sub"], email, isAdmin).Scan(&userID, &role)
+	if err != nil {
+		return 0, "", err
 	}
 
-	return userID, nil
+	return userID, role, nil
 }
 
-// SaveGoogleTokensToDB saves the Google tokens to the database
-func (s *AuthService) SaveGoogleTokensToDB(userID int, token *oauth2.Token) error {
+// IssueTokens creates a JWT pair for a new login, starting a new refresh token family
+func (s *AuthService) IssueTokens(userID int, authUUID, role string) (map[string]string, error) {
 	ctx := context.Background()
-	query := `
-        INSERT INTO google_tokens (user_id, access_token, refresh_token, expires_at)
-        VALUES ($1, $2, $3, $4)
-        ON CONFLICT (user_id)
-        DO UPDATE SET access_token = EXCLUDED.access_token, refresh_token = EXCLUDED.refresh_token, expires_at = EXCLUDED.expires_at`
-	_, err := s.psql.Exec(ctx, query, userID, token.AccessToken, token.RefreshToken, token.Expiry)
+	tx, err := s.psql.Begin(ctx)
 	if err != nil {
-		s.Log.Error("Failed to save Google tokens to DB", "error", err)
+		return nil, err
 	}
-	return err
+	defer tx.Rollback(ctx)
+
+	tokens, err := s.saveTokenPair(ctx, tx, jwt.AuthDetails{
+		AuthUuid: authUUID,
+		UserId:   uint64(userID),
+		Role:     role,
+		FamilyID: uuid.NewString(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, tx.Commit(ctx)
 }
 
-// SaveTokensToDB saves the JWT tokens to the database
-func (s *AuthService) SaveTokensToDB(userID int, accessToken, refreshToken string, expiresAt time.Time) error {
+// RefreshTokens exchanges a refresh token for a new JWT pair in the same family.
+// The refresh token is spent; presenting it again revokes the whole family.
+func (s *AuthService) RefreshTokens(refreshToken string) (map[string]string, error) {
+	claims, err := jwt.VerifyRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
 	ctx := context.Background()
-	query := `INSERT INTO tokens (user_id, access_token, refresh_token, expires_at) 
-	          VALUES ($1, $2, $3, $4)
-	          ON CONFLICT (user_id) 
-	          DO UPDATE SET access_token = EXCLUDED.access_token, refresh_token = EXCLUDED.refresh_token, expires_at = EXCLUDED.expires_at`
-	_, err := s.psql.Exec(ctx, query, userID, accessToken, refreshToken, expiresAt)
-	return err
+	tx, err := s.psql.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var stored storedRefresh
+	var role string
+	err = tx.QueryRow(ctx, `
+		SELECT t.user_id, t.family_id, t.used_at, t.revoked_at, u.role
+		FROM tokens t JOIN users u ON u.id = t.user_id
+		WHERE t.refresh_jti=$1 AND t.refresh_expires_at > NOW()
+		FOR UPDATE OF t`, claims.RefreshID,
+	).Scan(&stored.userID, &stored.familyID, &stored.usedAt, &stored.revokedAt, &role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, jwt.ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	userID, familyID := stored.userID, stored.familyID
+
+	err = stored.check(claims)
+	if errors.Is(err, ErrRefreshTokenReused) {
+		revoked, err := revokeTokens(ctx, tx, "family_id=$1", familyID)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, err
+		}
+		s.denyAccessTokens(ctx, revoked)
+		s.Log.Warn("Refresh token reused, session family revoked", "user", userID, "family", familyID)
+		return nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE tokens SET used_at=NOW() WHERE refresh_jti=$1", claims.RefreshID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.saveTokenPair(ctx, tx, jwt.AuthDetails{
+		AuthUuid: claims.AuthUuid,
+		UserId:   uint64(userID),
+		Role:     role,
+		FamilyID: familyID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, tx.Commit(ctx)
 }
 
-// FetchGoogleTokenByUserID retrieves the Google token from the database by user ID
-func (s *AuthService) FetchGoogleTokenByUserID(userID int) (*oauth2.Token, error) {
-	row := s.psql.QueryRow(context.Background(), "SELECT access_token, refresh_token, expires_at FROM google_tokens WHERE user_id=$1", userID)
+// storedRefresh is the stored state of a presented refresh token
+type storedRefresh struct {
+	userID            int
+	familyID          string
+	usedAt, revokedAt *time.Time
+}
+
+// check decides whether a refresh token with the claims may be rotated. A spent
+// token presented again may have been stolen, which ErrRefreshTokenReused
+// reports so that the caller revokes its family.
+func (t storedRefresh) check(claims jwt.RefreshClaims) error {
+	if t.revokedAt != nil || t.familyID != claims.FamilyID || t.userID != int(claims.UserId) {
+		return jwt.ErrInvalidRefreshToken
+	}
+	if t.usedAt != nil {
+		return ErrRefreshTokenReused
+	}
+	return nil
+}
 
-	var accessToken, refreshToken string
-	var expiresAt time.Time
-	err := row.Scan(&accessToken, &refreshToken, &expiresAt)
+// saveTokenPair creates a JWT pair with a fresh refresh token ID and stores it
+func (s *AuthService) saveTokenPair(ctx context.Context, tx pgx.Tx, authD jwt.AuthDetails) (map[string]string, error) {
+	authD.AccessID = uuid.NewString()
+	authD.RefreshID = uuid.NewString()
+	tokens, err := jwt.CreateTokenPair(authD)
 	if err != nil {
 		return nil, err
 	}
 
-	return &oauth2.Token{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		Expiry:       expiresAt,
-		TokenType:    "Bearer",
-	}, nil
+	now := time.Now()
+	_, err = tx.Exec(ctx, `
+		INSERT INTO tokens (user_id, access_token, refresh_token, expires_at, access_jti, refresh_jti, family_id, refresh_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		authD.UserId, tokens["access_token"], tokens["refresh_token"], now.Add(jwt.AccessTokenDuration),
+		authD.AccessID, authD.RefreshID, authD.FamilyID, now.Add(jwt.RefreshTokenDuration),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
 }
 
-// RefreshToken refreshes the access token using the refresh token
-func (s *AuthService) RefreshToken(userID int, token *oauth2.Token) (*oauth2.Token, error) {
+// RefreshToken refreshes the access token of a linked account using the refresh token
+func (s *AuthService) RefreshToken(accountID int, token *oauth2.Token) (*oauth2.Token, error) {
 	if token.RefreshToken == "" {
 		s.Log.Warn("No refresh token available")
 		return nil, errors.New("no refresh token available")
@@ -214,9 +331,9 @@ func (s *AuthService) RefreshToken(userID int, token *oauth2.Token) (*oauth2.Tok
 		return nil, err
 	}
 
-	s.Log.Info("New token obtained", slog.String("access_token", newToken.AccessToken), slog.String("refresh_token", newToken.RefreshToken), slog.Time("expires_at", newToken.Expiry))
+	s.Log.Info("New token obtained", "account", accountID, slog.Time("expires_at", newToken.Expiry))
 
-	err = s.SaveGoogleTokensToDB(userID, newToken)
+	err = s.SaveAccountToken(accountID, newToken)
 	if err != nil {
 		s.Log.Error("Failed to save new tokens to DB", "error", err)
 		return nil, err
@@ -224,12 +341,3 @@ func (s *AuthService) RefreshToken(userID int, token *oauth2.Token) (*oauth2.Tok
 
 	return newToken, nil
 }
-
-// GetUserIDByToken retrieves the user ID associated with the token
-func (s *AuthService) GetUserIDByToken(token *oauth2.Token) (int, error) {
-	userInfo, err := s.FetchUserInfo(token)
-	if err != nil {
-		return 0, err
-	}
-	return s.SaveUserToDB(userInfo)
-}
@@ -0,0 +1,77 @@
+package authService
+
+import (
+	"context"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/secretbox"
+)
+
+// openPassword decrypts the stored IMAP password of an account, which is
+// bound to its external ID. Passwords stored before they were encrypted are
+// returned as they are until EncryptIMAPPasswords has run.
+func (s *AuthService) openPassword(a models.LinkedAccount) string {
+	if a.IMAPPassword == "" || !secretbox.Sealed(a.IMAPPassword) {
+		return a.IMAPPassword
+	}
+	password, err := s.credentials.Open(a.IMAPPassword, a.ExternalID)
+	if err != nil {
+		// The account cannot log in until it is linked again with the password
+		s.Log.Error("Failed to decrypt the IMAP password, was CREDENTIAL_KEY changed?", "account", a.ID, "error", err)
+		return ""
+	}
+	return password
+}
+
+// EncryptIMAPPasswords encrypts the IMAP passwords stored in plaintext before
+// passwords were encrypted. It stops once every password is done or ctx is cancelled.
+func (s *AuthService) EncryptIMAPPasswords(ctx context.Context) {
+	rows, err := s.psql.Query(ctx, `
+		SELECT id, external_id, imap_password FROM linked_accounts
+		WHERE imap_password <> '' AND imap_password NOT LIKE 'gcm1:%'`)
+	if err != nil {
+		s.Log.Error("Failed to load plaintext IMAP passwords", "error", err)
+		return
+	}
+	type pending struct {
+		id                   int
+		externalID, password string
+	}
+	var accounts []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.externalID, &p.password); err != nil {
+			rows.Close()
+			s.Log.Error("Failed to load plaintext IMAP passwords", "error", err)
+			return
+		}
+		accounts = append(accounts, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		s.Log.Error("Failed to load plaintext IMAP passwords", "error", err)
+		return
+	}
+
+	done := 0
+	for _, p := range accounts {
+		if ctx.Err() != nil {
+			return
+		}
+		sealed, err := s.credentials.Seal(p.password, p.externalID)
+		if err != nil {
+			s.Log.Error("Failed to encrypt IMAP password", "account", p.id, "error", err)
+			return
+		}
+		// A password changed by a new link in the meantime is already encrypted
+		_, err = s.psql.Exec(ctx, "UPDATE linked_accounts SET imap_password=$2 WHERE id=$1 AND imap_password=$3", p.id, sealed, p.password)
+		if err != nil {
+			s.Log.Error("Failed to store encrypted IMAP password", "account", p.id, "error", err)
+			return
+		}
+		done++
+	}
+	if done > 0 {
+		s.Log.Info("Encrypted stored IMAP passwords", "accounts", done)
+	}
+}
@@ -0,0 +1,310 @@
+package authService
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/lib/jwt"
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// pkceKeyPrefix prefixes the Redis keys of the PKCE verifiers of pending logins
+	pkceKeyPrefix = "auth:pkce:"
+	// linkTicketKeyPrefix prefixes the Redis keys of the account links waiting to be opened in a browser
+	linkTicketKeyPrefix = "auth:link:"
+	// loginCodeKeyPrefix prefixes the Redis keys of the JWT pairs waiting for a login code exchange
+	loginCodeKeyPrefix = "auth:login:"
+	// loginCodeDuration is how long the client has to exchange a login code
+	loginCodeDuration = 2 * time.Minute
+	// shortCodeLength is the number of characters of a short login code
+	shortCodeLength = 8
+	// shortCodeAlphabet leaves out characters that are easily confused, 32 symbols keep the modulo unbiased
+	shortCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+var (
+	// ErrInvalidState is returned when the OAuth state is forged, expired, already used or not bound to the browser
+	ErrInvalidState = errors.New("invalid oauth state")
+	// ErrInvalidRedirectURL is returned when a login asks to return to a URL that is not allowed
+	ErrInvalidRedirectURL = errors.New("invalid redirect URL")
+	// ErrInvalidLinkTicket is returned when a link ticket is unknown, expired or already opened
+	ErrInvalidLinkTicket = errors.New("invalid link ticket")
+	// ErrInvalidLoginCode is returned when a login code is unknown, expired or already exchanged
+	ErrInvalidLoginCode = errors.New("invalid login code")
+)
+
+// LoginRequest is a pending Google login
+type LoginRequest struct {
+	AuthURL string
+	// Nonce binds the OAuth state to the browser that started the login
+	Nonce string
+}
+
+// LoginState is what the callback of a login needs from its OAuth state
+type LoginState struct {
+	Verifier    string
+	RedirectURL string
+	// ShowCode asks the callback to display a short login code instead of returning tokens
+	ShowCode bool
+	// LinkUserID is set when the Google account is linked to an existing user instead of logging in
+	LinkUserID int
+}
+
+// BeginLogin starts a Google login returning to redirectURL, which may be empty.
+// With showCode the callback displays a short login code for clients that cannot
+// receive a redirect. The PKCE verifier is kept in Redis until the callback.
+func (s *AuthService) BeginLogin(ctx context.Context, redirectURL string, showCode bool) (LoginRequest, error) {
+	if err := s.ValidateRedirectURL(redirectURL); err != nil {
+		return LoginRequest{}, err
+	}
+	if showCode && redirectURL != "" {
+		return LoginRequest{}, ErrInvalidRedirectURL
+	}
+	return s.beginAuthorization(ctx, jwt.StateClaims{RedirectURL: redirectURL, ShowCode: showCode})
+}
+
+// BeginLink starts the authorization of another Google mailbox for the user and
+// returns a one-time ticket for it. The link is started by an API client while
+// the authorization runs in a browser, so the browser opens the ticket to get
+// the state cookie and the Google URL, see OpenLink. The callback links the
+// mailbox and returns to redirectURL when it is set.
+func (s *AuthService) BeginLink(ctx context.Context, userID int, redirectURL string) (string, error) {
+	if err := s.ValidateRedirectURL(redirectURL); err != nil {
+		return "", err
+	}
+	var user string
+	if err := s.psql.QueryRow(ctx, "SELECT email FROM users WHERE id=$1", userID).Scan(&user); err != nil {
+		return "", err
+	}
+	link, err := s.beginAuthorization(ctx, jwt.StateClaims{RedirectURL: redirectURL, LinkUserID: uint64(userID)})
+	if err != nil {
+		return "", err
+	}
+
+	ticket, err := randomString(24)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(map[string]string{"auth_url": link.AuthURL, "nonce": link.Nonce, "user": user})
+	if err != nil {
+		return "", err
+	}
+	if err := s.redis.Set(ctx, linkTicketKeyPrefix+ticket, b, jwt.StateTokenDuration).Err(); err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// LinkTarget returns the email of the user a link ticket links the mailbox to,
+// without spending the ticket, so that the browser can confirm the link first
+func (s *AuthService) LinkTarget(ctx context.Context, ticket string) (string, error) {
+	link, err := decodeLink(s.redis.Get(ctx, linkTicketKeyPrefix+ticket))
+	return link["user"], err
+}
+
+// OpenLink returns the pending authorization behind a link ticket and spends the ticket
+func (s *AuthService) OpenLink(ctx context.Context, ticket string) (LoginRequest, error) {
+	link, err := decodeLink(s.redis.GetDel(ctx, linkTicketKeyPrefix+ticket))
+	if err != nil {
+		return LoginRequest{}, err
+	}
+	return LoginRequest{AuthURL: link["auth_url"], Nonce: link["nonce"]}, nil
+}
+
+// decodeLink decodes the link ticket returned by a Redis command
+func decodeLink(cmd *redis.StringCmd) (map[string]string, error) {
+	b, err := cmd.Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrInvalidLinkTicket
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var link map[string]string
+	if err := json.Unmarshal(b, &link); err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// beginAuthorization signs the state of a Google authorization and keeps its PKCE verifier in Redis
+func (s *AuthService) beginAuthorization(ctx context.Context, claims jwt.StateClaims) (LoginRequest, error) {
+	nonce, err := randomString(32)
+	if err != nil {
+		return LoginRequest{}, err
+	}
+	claims.Nonce = nonce
+	state, err := jwt.CreateStateToken(claims)
+	if err != nil {
+		return LoginRequest{}, err
+	}
+
+	verifier := oauth2.GenerateVerifier()
+	if err := s.redis.Set(ctx, pkceKeyPrefix+nonce, verifier, jwt.StateTokenDuration).Err(); err != nil {
+		return LoginRequest{}, err
+	}
+
+	authURL := s.oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce, oauth2.S256ChallengeOption(verifier))
+	return LoginRequest{AuthURL: authURL, Nonce: nonce}, nil
+}
+
+// CompleteLogin checks the OAuth state of a callback against the nonce of the
+// browser. Every state can be completed once.
+func (s *AuthService) CompleteLogin(ctx context.Context, state, nonce string) (LoginState, error) {
+	claims, err := jwt.VerifyStateToken(state)
+	if err != nil {
+		return LoginState{}, ErrInvalidState
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return LoginState{}, ErrInvalidState
+	}
+
+	verifier, err := s.redis.GetDel(ctx, pkceKeyPrefix+claims.Nonce).Result()
+	if errors.Is(err, redis.Nil) {
+		return LoginState{}, ErrInvalidState
+	}
+	if err != nil {
+		return LoginState{}, err
+	}
+
+	// The allowlist may have changed since the login started
+	if err := s.ValidateRedirectURL(claims.RedirectURL); err != nil {
+		return LoginState{}, err
+	}
+	return LoginState{
+		Verifier:    verifier,
+		RedirectURL: claims.RedirectURL,
+		ShowCode:    claims.ShowCode,
+		LinkUserID:  int(claims.LinkUserID),
+	}, nil
+}
+
+// CreateLoginCode stores a JWT pair behind a short-lived one-time code, so that
+// tokens never appear in a redirect URL
+func (s *AuthService) CreateLoginCode(ctx context.Context, tokens map[string]string) (string, error) {
+	code, err := randomString(24)
+	if err != nil {
+		return "", err
+	}
+	return code, s.storeLoginCode(ctx, code, tokens)
+}
+
+// CreateShortLoginCode stores a JWT pair behind a one-time code short enough to be
+// typed by hand, formatted as XXXX-XXXX
+func (s *AuthService) CreateShortLoginCode(ctx context.Context, tokens map[string]string) (string, error) {
+	b := make([]byte, shortCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = shortCodeAlphabet[int(b[i])%len(shortCodeAlphabet)]
+	}
+	code := string(b)
+	if err := s.storeLoginCode(ctx, code, tokens); err != nil {
+		return "", err
+	}
+	return code[:shortCodeLength/2] + "-" + code[shortCodeLength/2:], nil
+}
+
+// storeLoginCode keeps the JWT pair in Redis until the code is exchanged or expires
+func (s *AuthService) storeLoginCode(ctx context.Context, code string, tokens map[string]string) error {
+	b, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	return s.redis.Set(ctx, loginCodeKeyPrefix+code, b, loginCodeDuration).Err()
+}
+
+// ExchangeLoginCode returns the JWT pair stored behind a login code and spends the code.
+// Short codes are accepted in any case, with or without the dash.
+func (s *AuthService) ExchangeLoginCode(ctx context.Context, code string) (map[string]string, error) {
+	if short := normalizeShortCode(code); len(short) == shortCodeLength {
+		code = short
+	}
+
+	b, err := s.redis.GetDel(ctx, loginCodeKeyPrefix+code).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrInvalidLoginCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens map[string]string
+	if err := json.Unmarshal(b, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// ValidateRedirectURL accepts an empty URL, a loopback http URL (RFC 8252) or a
+// URL under one of the auth.redirectURLs prefixes
+func (s *AuthService) ValidateRedirectURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.User != nil || u.Fragment != "" {
+		return ErrInvalidRedirectURL
+	}
+	if u.Scheme == "http" && isLoopback(u.Hostname()) {
+		return nil
+	}
+
+	for _, allowed := range s.redirects {
+		if u.Scheme == allowed.Scheme && strings.EqualFold(u.Host, allowed.Host) && strings.HasPrefix(u.Path, allowed.Path) {
+			return nil
+		}
+	}
+	return ErrInvalidRedirectURL
+}
+
+// parseRedirectURLs parses the auth.redirectURLs allowlist
+func parseRedirectURLs(raw []string) ([]*url.URL, error) {
+	urls := make([]*url.URL, 0, len(raw))
+	for _, r := range raw {
+		u, err := url.Parse(r)
+		if err != nil || !u.IsAbs() || u.Host == "" {
+			return nil, fmt.Errorf("invalid redirect URL in config: %q", r)
+		}
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
+
+// normalizeShortCode removes the separators a user may type in a short login code
+func normalizeShortCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// isLoopback reports whether host is a loopback address or localhost
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// randomString returns n random bytes encoded as unpadded base64url
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
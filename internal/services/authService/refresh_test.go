@@ -0,0 +1,34 @@
+package authService
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/lib/jwt"
+)
+
+func TestStoredRefreshCheck(t *testing.T) {
+	now := time.Now()
+	claims := jwt.RefreshClaims{UserId: 7, RefreshID: "r1", FamilyID: "f1"}
+
+	tests := []struct {
+		name   string
+		stored storedRefresh
+		want   error
+	}{
+		{name: "fresh token rotates", stored: storedRefresh{userID: 7, familyID: "f1"}},
+		{name: "spent token is a reuse", stored: storedRefresh{userID: 7, familyID: "f1", usedAt: &now}, want: ErrRefreshTokenReused},
+		{name: "revoked family", stored: storedRefresh{userID: 7, familyID: "f1", revokedAt: &now}, want: jwt.ErrInvalidRefreshToken},
+		{name: "revoked after reuse", stored: storedRefresh{userID: 7, familyID: "f1", usedAt: &now, revokedAt: &now}, want: jwt.ErrInvalidRefreshToken},
+		{name: "other family", stored: storedRefresh{userID: 7, familyID: "f2"}, want: jwt.ErrInvalidRefreshToken},
+		{name: "other user", stored: storedRefresh{userID: 8, familyID: "f1"}, want: jwt.ErrInvalidRefreshToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.stored.check(claims); !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Errorf("check() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
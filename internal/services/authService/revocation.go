@@ -0,0 +1,164 @@
+package authService
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// revokedKeyPrefix prefixes the Redis keys of revoked access token IDs
+const revokedKeyPrefix = "auth:revoked:"
+
+// validKeyPrefix prefixes the Redis keys of access token IDs Postgres reported as not revoked
+const validKeyPrefix = "auth:valid:"
+
+// validTTL is how long a token found not revoked skips Postgres, which bounds
+// how long a revocation that missed the denylist goes unnoticed
+const validTTL = 30 * time.Second
+
+// revokedToken is a still valid access token of a revoked session
+type revokedToken struct {
+	jti       string
+	expiresAt time.Time
+}
+
+// Logout revokes the session the access token belongs to
+func (s *AuthService) Logout(userID int, familyID string) error {
+	return s.revokeSessions("user_id=$1 AND family_id=$2", userID, familyID)
+}
+
+// LogoutAll revokes every session of the user
+func (s *AuthService) LogoutAll(userID int) error {
+	return s.revokeSessions("user_id=$1", userID)
+}
+
+// revokeSessions revokes the matching tokens in Postgres and adds their access tokens to the denylist
+func (s *AuthService) revokeSessions(where string, args ...interface{}) error {
+	ctx := context.Background()
+	tx, err := s.psql.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	revoked, err := revokeTokens(ctx, tx, where, args...)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	s.denyAccessTokens(ctx, revoked)
+	return nil
+}
+
+// revokeTokens marks the matching tokens revoked and returns the access tokens that have not expired yet
+func revokeTokens(ctx context.Context, tx pgx.Tx, where string, args ...interface{}) ([]revokedToken, error) {
+	rows, err := tx.Query(ctx, `
+		UPDATE tokens SET revoked_at=NOW()
+		WHERE `+where+` AND revoked_at IS NULL
+		RETURNING access_jti, expires_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revoked []revokedToken
+	for rows.Next() {
+		var jti *string
+		var expiresAt time.Time
+		if err := rows.Scan(&jti, &expiresAt); err != nil {
+			return nil, err
+		}
+		if jti != nil && expiresAt.After(time.Now()) {
+			revoked = append(revoked, revokedToken{jti: *jti, expiresAt: expiresAt})
+		}
+	}
+	return revoked, rows.Err()
+}
+
+// denyAccessTokens caches revoked access token IDs in Redis until the tokens expire.
+// Failures are only logged, IsRevoked checks Postgres for tokens missing from the cache.
+func (s *AuthService) denyAccessTokens(ctx context.Context, tokens []revokedToken) {
+	for _, t := range tokens {
+		ttl := time.Until(t.expiresAt)
+		if ttl <= 0 {
+			continue
+		}
+		if err := s.redis.Set(ctx, revokedKeyPrefix+t.jti, 1, ttl).Err(); err != nil {
+			s.Log.Error("Failed to add access token to the denylist", "error", err)
+		}
+		if err := s.redis.Del(ctx, validKeyPrefix+t.jti).Err(); err != nil {
+			s.Log.Error("Failed to forget the cached state of an access token", "error", err)
+		}
+	}
+}
+
+// RestoreDenylist copies the revoked access tokens that have not expired yet from
+// Postgres to Redis, so that the denylist survives a Redis restart
+func (s *AuthService) RestoreDenylist(ctx context.Context) error {
+	rows, err := s.psql.Query(ctx, `
+		SELECT access_jti, expires_at FROM tokens
+		WHERE revoked_at IS NOT NULL AND access_jti IS NOT NULL AND expires_at > NOW()`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var revoked []revokedToken
+	for rows.Next() {
+		var t revokedToken
+		if err := rows.Scan(&t.jti, &t.expiresAt); err != nil {
+			return err
+		}
+		revoked = append(revoked, t)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.denyAccessTokens(ctx, revoked)
+	return nil
+}
+
+// IsRevoked reports whether the access token was revoked by a logout or a refresh token reuse.
+// Postgres is the source of truth: Redis holds the denylist and, for validTTL,
+// the tokens Postgres reported as not revoked; other tokens are looked up in
+// Postgres, since a revocation may have missed Redis while it was down or
+// restarting. Revoked tokens found in Postgres are added back to the denylist.
+func (s *AuthService) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	cached, err := s.redis.MGet(ctx, revokedKeyPrefix+jti, validKeyPrefix+jti).Result()
+	if err == nil && cached[0] != nil {
+		return true, nil
+	}
+	if err == nil && cached[1] != nil {
+		return false, nil
+	}
+	if err != nil {
+		s.Log.Warn("Failed to check the denylist in Redis, falling back to Postgres", "error", err)
+	}
+
+	var revoked bool
+	var expiresAt time.Time
+	err = s.psql.QueryRow(ctx, "SELECT revoked_at IS NOT NULL, expires_at FROM tokens WHERE access_jti=$1", jti).Scan(&revoked, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Unknown tokens were never issued by this server or belong to a deleted user
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if revoked {
+		s.denyAccessTokens(ctx, []revokedToken{{jti: jti, expiresAt: expiresAt}})
+		return true, nil
+	}
+	if ttl := min(validTTL, time.Until(expiresAt)); ttl > 0 {
+		if err := s.redis.Set(ctx, validKeyPrefix+jti, 1, ttl).Err(); err != nil {
+			s.Log.Warn("Failed to cache the state of an access token", "error", err)
+		}
+	}
+	return false, nil
+}
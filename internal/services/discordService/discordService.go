@@ -0,0 +1,354 @@
+package discordService
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/config"
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/discord"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// queueSize bounds the deliveries of one channel waiting for its rate limiter
+	queueSize = 64
+	// workerIdle is how long the worker of a channel waits for deliveries before exiting
+	workerIdle = time.Minute
+	// snippetLength is the body excerpt shown in the embed
+	snippetLength = 500
+	// embedColor is the accent color of email embeds
+	embedColor = 0x5865F2
+	// Discord limits for embed texts
+	maxTitleLength = 256
+	maxFieldLength = 1024
+)
+
+// ErrChannelNotFound is returned when the channel does not exist or belongs to another user
+var ErrChannelNotFound = errors.New("discord channel not found")
+
+// ErrBotChannelForbidden is returned when a user who is not an admin registers
+// a bot channel. The bot posts to any channel it can see, so a channel ID does
+// not prove that the user controls the channel.
+var ErrBotChannelForbidden = errors.New("only admins can register discord bot channels")
+
+// ErrInvalidChannel is returned when a channel has neither or both of a webhook URL and a channel ID
+var ErrInvalidChannel = errors.New("invalid discord channel")
+
+// DiscordService delivers email notifications to Discord. Each channel has its
+// own queue and worker, so that a channel waiting for its rate limit or
+// retrying does not hold up the others.
+type DiscordService struct {
+	psql   *pgxpool.Pool
+	client *discord.Client
+	log    *slog.Logger
+
+	mu sync.Mutex
+	// ctx is set while Start runs, workers are only started then
+	ctx     context.Context
+	queues  map[int]chan delivery
+	workers sync.WaitGroup
+}
+
+// delivery is a message waiting to be sent to a channel
+type delivery struct {
+	channel models.DiscordChannel
+	message discord.Message
+}
+
+// discordSecret is the content of the file at discord.secretPath
+type discordSecret struct {
+	Token string `json:"token"`
+}
+
+// NewDiscordService creates a new DiscordService. Without a bot token only
+// webhook channels can be used.
+func NewDiscordService(psql *pgxpool.Pool, cfg *config.Config, log *slog.Logger) (*DiscordService, error) {
+	interval, err := time.ParseDuration(cfg.Discord.RateInterval)
+	if err != nil {
+		log.Error("Failed to parse Discord rate interval", "error", err)
+		interval = 2 * time.Second
+	}
+
+	var botToken string
+	if cfg.Discord.SecretPath != "" {
+		botToken, err = loadToken(cfg.Discord.SecretPath)
+		if err != nil {
+			log.Error("Failed to load Discord bot token, only webhooks are available", "error", err)
+		}
+	}
+
+	return &DiscordService{
+		psql:   psql,
+		client: discord.NewClient(cfg.Discord.BaseURL, botToken, interval, cfg.Discord.RateBurst, cfg.Discord.MaxRetries),
+		log:    log,
+		queues: make(map[int]chan delivery),
+	}, err
+}
+
+// loadToken reads the bot token from the secret file
+func loadToken(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var secret discordSecret
+	if err := json.Unmarshal(b, &secret); err != nil {
+		return "", err
+	}
+	return secret.Token, nil
+}
+
+// Start sends queued deliveries until the context is cancelled and waits for
+// the channel workers to stop
+func (s *DiscordService) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	for id, queue := range s.queues {
+		s.startWorker(id, queue)
+	}
+	s.mu.Unlock()
+
+	<-ctx.Done()
+	s.mu.Lock()
+	s.ctx = nil
+	s.mu.Unlock()
+	s.workers.Wait()
+}
+
+// startWorker runs the worker of a channel queue. The caller holds s.mu.
+func (s *DiscordService) startWorker(id int, queue chan delivery) {
+	ctx := s.ctx
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		s.work(ctx, id, queue)
+	}()
+}
+
+// work sends the deliveries of one channel in order. It exits once the queue
+// has been idle for workerIdle; enqueue starts a new worker for later deliveries.
+func (s *DiscordService) work(ctx context.Context, id int, queue chan delivery) {
+	idle := time.NewTimer(workerIdle)
+	defer idle.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-queue:
+			if err := s.send(ctx, d); err != nil {
+				s.log.Error("Failed to deliver Discord message", "channel", d.channel.ID, "user", d.channel.UserID, "error", err)
+			}
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(workerIdle)
+		case <-idle.C:
+			s.mu.Lock()
+			if len(queue) == 0 {
+				delete(s.queues, id)
+				s.mu.Unlock()
+				return
+			}
+			s.mu.Unlock()
+			idle.Reset(workerIdle)
+		}
+	}
+}
+
+// send posts a delivery through its webhook or as the bot
+func (s *DiscordService) send(ctx context.Context, d delivery) error {
+	if d.channel.WebhookID != "" {
+		return s.client.ExecuteWebhook(ctx, d.channel.WebhookID, d.channel.WebhookToken, d.message)
+	}
+	return s.client.CreateMessage(ctx, d.channel.ChannelID, d.message)
+}
+
+// enqueue schedules a delivery on the queue of its channel without blocking the caller
+func (s *DiscordService) enqueue(channel models.DiscordChannel, message discord.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queue, ok := s.queues[channel.ID]
+	if !ok {
+		queue = make(chan delivery, queueSize)
+		s.queues[channel.ID] = queue
+		if s.ctx != nil {
+			s.startWorker(channel.ID, queue)
+		}
+	}
+	select {
+	case queue <- delivery{channel: channel, message: message}:
+	default:
+		s.log.Warn("Discord delivery queue is full, dropping message", "channel", channel.ID, "user", channel.UserID)
+	}
+}
+
+// Name identifies the notifier in filter actions
+func (s *DiscordService) Name() string {
+	return "discord"
+}
+
+// Notify sends an email matched by a filter to the user's channels. Channels
+// receiving all emails are skipped, ProcessNewEmails already covers them.
+func (s *DiscordService) Notify(ctx context.Context, userID int, email models.Email, filter models.Filter) error {
+	channels, err := s.queryChannels(ctx, "SELECT "+channelColumns+" FROM discord_channels WHERE user_id=$1 AND NOT all_emails", userID)
+	if err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		s.enqueue(channel, buildMessage(email, filter.Name))
+	}
+	return nil
+}
+
+// ProcessNewEmails sends every new email to the user's channels that receive all emails.
+// It matches the NewEmailsHook signature of the email service.
+func (s *DiscordService) ProcessNewEmails(ctx context.Context, userID int, emails []models.Email) {
+	channels, err := s.queryChannels(ctx, "SELECT "+channelColumns+" FROM discord_channels WHERE user_id=$1 AND all_emails", userID)
+	if err != nil {
+		s.log.Error("Failed to load Discord channels", "user", userID, "error", err)
+		return
+	}
+	for _, channel := range channels {
+		for _, email := range emails {
+			s.enqueue(channel, buildMessage(email, ""))
+		}
+	}
+}
+
+// ListChannels retrieves the user's Discord channels
+func (s *DiscordService) ListChannels(userID int) ([]models.DiscordChannel, error) {
+	return s.queryChannels(context.Background(), "SELECT "+channelColumns+" FROM discord_channels WHERE user_id=$1 ORDER BY id", userID)
+}
+
+// CreateChannel registers a webhook URL or, for admins, a bot channel ID for the user
+func (s *DiscordService) CreateChannel(userID int, admin bool, name, webhookURL, channelID string, allEmails bool) (models.DiscordChannel, error) {
+	channel := models.DiscordChannel{UserID: userID, Name: strings.TrimSpace(name), ChannelID: strings.TrimSpace(channelID), AllEmails: allEmails}
+
+	switch {
+	case webhookURL != "" && channel.ChannelID != "":
+		return channel, fmt.Errorf("%w: set either webhook_url or channel_id", ErrInvalidChannel)
+	case webhookURL != "":
+		var err error
+		channel.WebhookID, channel.WebhookToken, err = discord.ParseWebhookURL(webhookURL)
+		if err != nil {
+			return channel, fmt.Errorf("%w: %s", ErrInvalidChannel, err)
+		}
+	case channel.ChannelID != "":
+		if !s.client.HasBotToken() {
+			return channel, fmt.Errorf("%w: the Discord bot is not configured, use a webhook", ErrInvalidChannel)
+		}
+		if !admin {
+			return channel, ErrBotChannelForbidden
+		}
+	default:
+		return channel, fmt.Errorf("%w: webhook_url or channel_id is required", ErrInvalidChannel)
+	}
+	if channel.Name == "" {
+		channel.Name = "Discord"
+	}
+
+	row := s.psql.QueryRow(context.Background(), `
+		INSERT INTO discord_channels (user_id, name, webhook_id, webhook_token, channel_id, all_emails)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6)
+		RETURNING `+channelColumns,
+		channel.UserID, channel.Name, channel.WebhookID, channel.WebhookToken, channel.ChannelID, channel.AllEmails,
+	)
+	return scanChannel(row)
+}
+
+// DeleteChannel removes one of the user's Discord channels
+func (s *DiscordService) DeleteChannel(userID, channelID int) error {
+	tag, err := s.psql.Exec(context.Background(), "DELETE FROM discord_channels WHERE id=$1 AND user_id=$2", channelID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrChannelNotFound
+	}
+	return nil
+}
+
+const channelColumns = "id, user_id, name, COALESCE(webhook_id, ''), COALESCE(webhook_token, ''), COALESCE(channel_id, ''), all_emails, created_at"
+
+// scanChannel reads a channel row selected with channelColumns
+func scanChannel(row pgx.Row) (models.DiscordChannel, error) {
+	var c models.DiscordChannel
+	err := row.Scan(&c.ID, &c.UserID, &c.Name, &c.WebhookID, &c.WebhookToken, &c.ChannelID, &c.AllEmails, &c.CreatedAt)
+	return c, err
+}
+
+// queryChannels runs a channel query selecting channelColumns
+func (s *DiscordService) queryChannels(ctx context.Context, sql string, args ...interface{}) ([]models.DiscordChannel, error) {
+	rows, err := s.psql.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := []models.DiscordChannel{}
+	for rows.Next() {
+		c, err := scanChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, c)
+	}
+	return channels, rows.Err()
+}
+
+// buildMessage renders an email as a rich embed
+func buildMessage(email models.Email, filterName string) discord.Message {
+	embed := discord.Embed{
+		Title:       truncate(orDefault(email.Subject, "(no subject)"), maxTitleLength),
+		Description: truncate(email.BodyText, snippetLength),
+		Color:       embedColor,
+		Author:      &discord.EmbedAuthor{Name: truncate(email.Sender, maxTitleLength)},
+	}
+	if !email.SendedAt.IsZero() {
+		embed.Timestamp = email.SendedAt.UTC().Format(time.RFC3339)
+	}
+
+	if len(email.Attachment) > 0 {
+		names := make([]string, 0, len(email.Attachment))
+		for _, a := range email.Attachment {
+			names = append(names, a.Filename)
+		}
+		embed.Fields = append(embed.Fields, discord.EmbedField{
+			Name:  fmt.Sprintf("Attachments (%d)", len(names)),
+			Value: truncate(strings.Join(names, "\n"), maxFieldLength),
+		})
+	}
+
+	if filterName != "" {
+		embed.Footer = &discord.EmbedFooter{Text: "Filter: " + truncate(filterName, maxTitleLength)}
+	}
+	return discord.Message{Embeds: []discord.Embed{embed}}
+}
+
+// truncate shortens s to at most n runes
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// orDefault returns fallback when s is empty
+func orDefault(s, fallback string) string {
+	if strings.TrimSpace(s) == "" {
+		return fallback
+	}
+	return s
+}
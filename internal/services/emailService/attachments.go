@@ -0,0 +1,347 @@
+package emailService
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/mailsource"
+	"github.com/17HIERARCH70/SocialManager/internal/storage/blobstore"
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrAttachmentNotFound is returned when the attachment does not exist, belongs
+// to another user or its content is not available
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// attachmentColumns lists the attachment metadata columns in the order scanAttachment reads them
+const attachmentColumns = "a.id, a.email_id, COALESCE(a.file, ''), COALESCE(a.sha256, ''), COALESCE(a.size, 0), COALESCE(a.mime_type, ''), COALESCE(a.filename, ''), COALESCE(a.content_id, ''), a.inline"
+
+// scanAttachment reads a row selected with attachmentColumns
+func scanAttachment(row pgx.Row) (models.Attachment, error) {
+	var a models.Attachment
+	err := row.Scan(&a.ID, &a.EmailID, &a.File, &a.SHA256, &a.Size, &a.MimeType, &a.Filename, &a.ContentID, &a.Inline)
+	return a, err
+}
+
+// ListAttachments retrieves the attachment metadata of an email. A non-nil
+// userID limits the lookup to that user's emails.
+func (s *EmailService) ListAttachments(userID *int, emailID int) ([]models.Attachment, error) {
+	ctx := context.Background()
+
+	var exists bool
+	err := s.psql.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM emails WHERE id=$1 AND ($2::int IS NULL OR user_id=$2))", emailID, userID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrEmailNotFound
+	}
+
+	attachments, err := s.fetchAttachments(ctx, []int{emailID})
+	if err != nil {
+		return nil, err
+	}
+	return attachments[emailID], nil
+}
+
+// pendingAttachment locates the content of an attachment in its mailbox
+type pendingAttachment struct {
+	models.Attachment
+	// SourceID is the attachment ID given by the mail source
+	SourceID  string
+	PartID    string
+	AccountID int
+	MessageID string
+}
+
+// pendingColumns lists the columns scanPending reads, attachmentColumns first
+const pendingColumns = attachmentColumns + ", COALESCE(a.attachment_id, ''), COALESCE(a.part_id, ''), e.account_id, e.email_id"
+
+// scanPending reads a row selected with pendingColumns
+func scanPending(row pgx.Row) (pendingAttachment, error) {
+	var p pendingAttachment
+	err := row.Scan(&p.ID, &p.EmailID, &p.File, &p.SHA256, &p.Size, &p.MimeType, &p.Filename, &p.ContentID, &p.Inline, &p.SourceID, &p.PartID, &p.AccountID, &p.MessageID)
+	return p, err
+}
+
+// OpenAttachment returns the metadata and the content of an attachment,
+// downloading the content from the mailbox first if it has not been yet. A
+// non-nil userID limits the lookup to that user's emails. The caller closes the content.
+func (s *EmailService) OpenAttachment(ctx context.Context, userID *int, id int) (models.Attachment, io.ReadSeekCloser, error) {
+	p, err := scanPending(s.psql.QueryRow(ctx, `
+		SELECT `+pendingColumns+`
+		FROM attachments a JOIN emails e ON e.id = a.email_id
+		WHERE a.id=$1 AND ($2::int IS NULL OR e.user_id=$2)`, id, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p.Attachment, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return p.Attachment, nil, err
+	}
+
+	if p.SHA256 != "" {
+		content, err := s.blobs.Open(ctx, p.SHA256)
+		if !errors.Is(err, blobstore.ErrNotFound) {
+			return p.Attachment, content, err
+		}
+		// The blob may have been pruned while another email was storing the same content
+		s.log.Warn("Attachment blob is missing, fetching it again", "attachment", id, "blob", p.SHA256)
+	}
+
+	account, err := s.authService.GetAccount(p.AccountID)
+	if err != nil {
+		return p.Attachment, nil, err
+	}
+	source, err := s.sourceForAccount(ctx, account)
+	if err != nil {
+		return p.Attachment, nil, err
+	}
+	defer source.Close()
+
+	attachment, err := s.downloadAttachment(ctx, source, p)
+	if errors.Is(err, mailsource.ErrNotFound) {
+		return attachment, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return attachment, nil, err
+	}
+	content, err := s.blobs.Open(ctx, attachment.SHA256)
+	return attachment, content, err
+}
+
+// downloadAttachment fetches the content of an attachment from its mailbox,
+// stores it in the blob store and records its key
+func (s *EmailService) downloadAttachment(ctx context.Context, source mailsource.MailSource, p pendingAttachment) (models.Attachment, error) {
+	data, err := fetchAttachmentData(ctx, source, p)
+	if err != nil {
+		if ctx.Err() == nil {
+			_, _ = s.psql.Exec(context.Background(), "UPDATE attachments SET fetch_attempts = fetch_attempts + 1 WHERE id=$1", p.ID)
+		}
+		s.log.Error("Failed to fetch attachment", "attachment", p.ID, "email_id", p.MessageID, "error", err)
+		return p.Attachment, err
+	}
+
+	key, err := s.blobs.Put(ctx, data)
+	if err != nil {
+		s.log.Error("Failed to store attachment", "attachment", p.ID, "error", err)
+		return p.Attachment, err
+	}
+	_, err = s.psql.Exec(ctx, "UPDATE attachments SET sha256=$2, size=$3, body=NULL WHERE id=$1", p.ID, key, len(data))
+	if err != nil {
+		return p.Attachment, err
+	}
+
+	attachment := p.Attachment
+	attachment.SHA256, attachment.Size = key, int64(len(data))
+	return attachment, nil
+}
+
+// fetchAttachmentData downloads the content of an attachment. Gmail issues new
+// attachment IDs each time a message is fetched and older ones may stop
+// working, so when the stored ID fails the message is fetched again and the
+// attachment found by its part ID, or by its file name and type for
+// attachments stored before part IDs were.
+func fetchAttachmentData(ctx context.Context, source mailsource.MailSource, p pendingAttachment) ([]byte, error) {
+	if p.SourceID != "" {
+		data, err := source.FetchAttachment(ctx, p.MessageID, p.SourceID)
+		if err == nil || ctx.Err() != nil {
+			return data, err
+		}
+	}
+
+	msg, err := source.FetchMessage(ctx, p.MessageID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range msg.Attachments {
+		if p.PartID != "" && a.PartID != p.PartID {
+			continue
+		}
+		if p.PartID == "" && (a.Filename != p.Filename || a.MimeType != p.MimeType) {
+			continue
+		}
+		if a.Data != nil {
+			return a.Data, nil
+		}
+		return source.FetchAttachment(ctx, p.MessageID, a.ID)
+	}
+	return nil, mailsource.ErrNotFound
+}
+
+// fetchAttachments retrieves the attachment metadata of the emails, keyed by email ID
+func (s *EmailService) fetchAttachments(ctx context.Context, emailIDs []int) (map[int][]models.Attachment, error) {
+	rows, err := s.psql.Query(ctx, "SELECT "+attachmentColumns+" FROM attachments a WHERE a.email_id = ANY($1) ORDER BY a.id", emailIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := make(map[int][]models.Attachment)
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments[a.EmailID] = append(attachments[a.EmailID], a)
+	}
+	return attachments, rows.Err()
+}
+
+// withAttachments fills the Attachment field of the emails
+func (s *EmailService) withAttachments(ctx context.Context, emails []models.Email) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	ids := make([]int, len(emails))
+	for i, email := range emails {
+		ids[i] = email.ID
+	}
+	attachments, err := s.fetchAttachments(ctx, ids)
+	if err != nil {
+		return err
+	}
+	owners, err := s.emailOwners(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range emails {
+		emails[i].Attachment = attachments[emails[i].ID]
+		if emails[i].BodySafe == "" {
+			// Stored before bodies were sanitized and not backfilled yet
+			emails[i].BodySafe = s.safeBody(emails[i].Body, emails[i].BodyPlain)
+		}
+		s.replaceContentIDs(&emails[i], owners[emails[i].ID])
+	}
+	return nil
+}
+
+// backfillBatch is the number of attachments moved to the blob store per query
+const backfillBatch = 100
+
+// BackfillAttachmentBlobs moves the attachment contents still stored in the
+// database to the blob store, leaving only their metadata behind. It stops
+// once every attachment is moved or ctx is cancelled.
+func (s *EmailService) BackfillAttachmentBlobs(ctx context.Context) {
+	moved, lastID := 0, 0
+	for ctx.Err() == nil {
+		rows, err := s.psql.Query(ctx, `
+			SELECT id, body FROM attachments
+			WHERE body IS NOT NULL AND sha256 IS NULL AND id > $1
+			ORDER BY id LIMIT $2`, lastID, backfillBatch)
+		if err != nil {
+			s.log.Error("Failed to fetch attachments to backfill", "error", err)
+			return
+		}
+
+		type pending struct {
+			id   int
+			body string
+		}
+		var batch []pending
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.id, &p.body); err != nil {
+				rows.Close()
+				s.log.Error("Failed to read attachment", "error", err)
+				return
+			}
+			batch = append(batch, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			s.log.Error("Failed to fetch attachments to backfill", "error", err)
+			return
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, p := range batch {
+			lastID = p.id
+			data, err := decodeAttachmentBody(p.body)
+			if err != nil {
+				// The row is skipped and keeps its body
+				s.log.Error("Failed to decode attachment", "attachment", p.id, "error", err)
+				continue
+			}
+			key, err := s.blobs.Put(ctx, data)
+			if err != nil {
+				s.log.Error("Failed to store attachment", "attachment", p.id, "error", err)
+				return
+			}
+			_, err = s.psql.Exec(ctx, "UPDATE attachments SET sha256=$2, size=$3, body=NULL WHERE id=$1", p.id, key, len(data))
+			if err != nil {
+				s.log.Error("Failed to update attachment", "attachment", p.id, "error", err)
+				return
+			}
+			moved++
+		}
+	}
+
+	if moved > 0 {
+		s.log.Info("Attachments moved to the blob store", "count", moved)
+	}
+}
+
+// decodeAttachmentBody decodes a body stored by earlier versions, which used
+// the URL-safe base64 of the Gmail API before switching to standard base64
+func decodeAttachmentBody(body string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(body)
+	if err == nil {
+		return data, nil
+	}
+	if data, err := base64.URLEncoding.DecodeString(body); err == nil {
+		return data, nil
+	}
+	return base64.RawURLEncoding.DecodeString(body)
+}
+
+// deleteAttachments runs a DELETE ... RETURNING sha256 statement on the
+// attachments table and returns the blob keys of the deleted rows
+func deleteAttachments(ctx context.Context, tx pgx.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key *string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		if key != nil {
+			keys = append(keys, *key)
+		}
+	}
+	return keys, rows.Err()
+}
+
+// pruneBlobs deletes the blobs no attachment refers to anymore. Failures are
+// logged only, an orphaned blob wastes space but is otherwise harmless.
+func (s *EmailService) pruneBlobs(ctx context.Context, keys []string) {
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		var used bool
+		err := s.psql.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM attachments WHERE sha256=$1)", key).Scan(&used)
+		if err != nil {
+			s.log.Error("Failed to check blob references", "blob", key, "error", err)
+			continue
+		}
+		if used {
+			continue
+		}
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			s.log.Error("Failed to delete blob", "blob", key, "error", err)
+		}
+	}
+}
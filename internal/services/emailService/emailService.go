@@ -2,14 +2,21 @@ package emailService
 
 import (
 	"context"
-	"encoding/base64"
+	"errors"
 	"fmt"
-	"golang.org/x/oauth2"
+	"sync"
 	"time"
 
 	"github.com/17HIERARCH70/SocialManager/internal/config"
 	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/htmltext"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/imageproxy"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/mailsource"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/netguard"
 	"github.com/17HIERARCH70/SocialManager/internal/services/authService"
+	"github.com/17HIERARCH70/SocialManager/internal/storage/blobstore"
+	"github.com/17HIERARCH70/SocialManager/internal/storage/postgresql"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"golang.org/x/exp/slog"
 	"google.golang.org/api/gmail/v1"
@@ -18,354 +25,430 @@ import (
 
 // EmailService handles email-related operations
 type EmailService struct {
-	psql        *pgxpool.Pool
-	authService *authService.AuthService
-	log         *slog.Logger
-	interval    time.Duration
+	psql          *pgxpool.Pool
+	blobs         blobstore.Store
+	authService   *authService.AuthService
+	log           *slog.Logger
+	interval      time.Duration
+	fullSyncLimit int
+	workers       int
+	jitter        time.Duration
+	maxBackoff    time.Duration
+	quotaUnits    int
+	pubsubTopic   string
+	// images proxies the remote images of sanitized bodies, nil when they are blocked
+	images *imageproxy.Proxy
+	// inlineKey signs the URLs of the inline images of bodies
+	inlineKey []byte
+	prefetch  prefetchPolicy
+	hooks     []NewEmailsHook
+	leases    *postgresql.Locker
+
+	mu     sync.Mutex
+	jobs   chan models.LinkedAccount
+	syncs  map[int]*syncState
+	quotas map[int]*mailsource.Quota
 }
 
+// NewEmailsHook is called with the emails that SaveEmailsToDB inserted for a user
+type NewEmailsHook func(ctx context.Context, userID int, emails []models.Email)
+
 // NewEmailService creates a new EmailService
-func NewEmailService(psql *pgxpool.Pool, cfg *config.Config, authService *authService.AuthService, log *slog.Logger) (*EmailService, error) {
+func NewEmailService(psql *pgxpool.Pool, blobs blobstore.Store, cfg *config.Config, authService *authService.AuthService, log *slog.Logger) (*EmailService, error) {
 	interval, err := time.ParseDuration(cfg.Gmail.RefreshTime)
 	if err != nil {
 		log.Error("Failed to parse refresh interval", "error", err)
 		interval = 3 * time.Minute
 	}
+	jitter, err := time.ParseDuration(cfg.Gmail.Jitter)
+	if err != nil {
+		log.Error("Failed to parse sync jitter", "error", err)
+		jitter = 10 * time.Second
+	}
+	maxBackoff, err := time.ParseDuration(cfg.Gmail.MaxBackoff)
+	if err != nil {
+		log.Error("Failed to parse sync max backoff", "error", err)
+		maxBackoff = time.Hour
+	}
+	prefetchInterval, err := time.ParseDuration(cfg.Attachments.PrefetchInterval)
+	if err != nil {
+		log.Error("Failed to parse attachment prefetch interval", "error", err)
+		prefetchInterval = time.Minute
+	}
+
+	images, err := newImageProxy(cfg)
+	if err != nil {
+		log.Error("Failed to configure the image proxy, remote images are blocked", "error", err)
+	}
 
 	return &EmailService{
-		psql:        psql,
-		authService: authService,
-		log:         log,
-		interval:    interval,
+		psql:          psql,
+		blobs:         blobs,
+		authService:   authService,
+		log:           log,
+		interval:      interval,
+		fullSyncLimit: cfg.Gmail.FullSyncLimit,
+		workers:       max(cfg.Gmail.Workers, 1),
+		jitter:        jitter,
+		maxBackoff:    maxBackoff,
+		quotaUnits:    cfg.Gmail.QuotaUnits,
+		pubsubTopic:   cfg.Gmail.PubSubTopic,
+		images:        images,
+		inlineKey:     deriveKey(cfg.Images.ProxyKey, inlineKeyLabel),
+		prefetch: prefetchPolicy{
+			interval: prefetchInterval,
+			maxSize:  cfg.Attachments.PrefetchMaxSize,
+			types:    cfg.Attachments.PrefetchTypes,
+		},
+		leases: postgresql.NewLocker(psql, syncLeaseNamespace),
+		syncs:  make(map[int]*syncState),
+		quotas: make(map[int]*mailsource.Quota),
 	}, nil
 }
 
-// StartEmailPolling starts the email polling process
-func (s *EmailService) StartEmailPolling() {
-	ticker := time.NewTicker(s.interval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			err := s.UpdateAllEmails()
-			if err != nil {
-				s.log.Error("Failed to update emails", "error", err)
-				return
-			}
-		}
-	}
+// OnNewEmails registers a hook that runs after new emails are stored
+func (s *EmailService) OnNewEmails(hook NewEmailsHook) {
+	s.hooks = append(s.hooks, hook)
 }
 
-// UpdateAllEmails updates emails for all users
-func (s *EmailService) UpdateAllEmails() error {
-	users, err := s.FetchAllUsers()
+// UpdateAllEmails updates emails for all linked accounts one after another
+func (s *EmailService) UpdateAllEmails(ctx context.Context) error {
+	accounts, err := s.authService.ListAllAccounts()
 	if err != nil {
-		s.log.Error("Failed to fetch users", "error", err)
+		s.log.Error("Failed to fetch linked accounts", "error", err)
 		return err
 	}
 
-	for _, user := range users {
-		err := s.UpdateEmailsForUser(user.ID)
+	for _, account := range accounts {
+		err := s.UpdateEmailsForAccount(ctx, account)
 		if err != nil {
-			s.log.Error("Failed to update emails for user", "user", user.ID, "error", err)
+			s.log.Error("Failed to update emails for account", "account", account.ID, "user", account.UserID, "error", err)
 		}
 	}
 	return nil
 }
 
-// FetchAllUsers retrieves all users from the database
-func (s *EmailService) FetchAllUsers() ([]models.User, error) {
-	rows, err := s.psql.Query(context.Background(), "SELECT id, google_id, email FROM users")
+// UpdateEmailsForUser updates emails for every mailbox linked to a specific user
+func (s *EmailService) UpdateEmailsForUser(ctx context.Context, userID int) error {
+	accounts, err := s.authService.ListAccounts(userID)
 	if err != nil {
-		return nil, err
+		s.log.Error("Failed to fetch linked accounts", "user", userID, "error", err)
+		return err
 	}
-	defer rows.Close()
 
-	var users []models.User
-	for rows.Next() {
-		var user models.User
-		if err := rows.Scan(&user.ID, &user.GoogleID, &user.Email); err != nil {
-			return nil, err
+	var errs []error
+	for _, account := range accounts {
+		if err := s.UpdateEmailsForAccount(ctx, account); err != nil {
+			errs = append(errs, err)
 		}
-		users = append(users, user)
 	}
-	return users, nil
+	return errors.Join(errs...)
 }
 
-// UpdateEmailsForUser updates emails for a specific user
-func (s *EmailService) UpdateEmailsForUser(userID int) error {
-	// Fetch the token from the database
-	token, err := s.authService.FetchGoogleTokenByUserID(userID)
-	if err != nil {
-		s.log.Error("Failed to fetch Google token", "user", userID, "error", err)
-		return err
-	}
-
-	// Check if the token is expired
-	if time.Now().After(token.Expiry) {
-		// Refresh the token using the refresh token
-		token, err = s.authService.RefreshToken(userID, token)
-		if err != nil {
-			s.log.Error("Failed to refresh token", "user", userID, "error", err)
-			return err
-		}
+// UpdateEmailsForAccount updates emails for a specific linked account. It returns
+// ErrSyncInProgress when the account is already being synced by this or another replica.
+func (s *EmailService) UpdateEmailsForAccount(ctx context.Context, account models.LinkedAccount) error {
+	if !s.beginSync(account.ID) {
+		return ErrSyncInProgress
 	}
+	defer s.endSync(account.ID)
 
-	// Create the Gmail service client using the valid token
-	ctx := context.Background()
-	client := s.authService.OAuthConfig().Client(ctx, token)
-	gmailService, err := gmail.NewService(ctx, option.WithHTTPClient(client))
+	// The sync stops once the lease is lost, another replica may take it over
+	ctx, release, err := s.acquireLease(ctx, account.ID)
 	if err != nil {
-		s.log.Error("Failed to create Gmail service", "user", userID, "error", err)
 		return err
 	}
+	defer release()
 
-	// Fetch the user's email address from the database
-	userEmail, err := s.FetchUserEmailByID(userID)
+	source, err := s.sourceForAccount(ctx, account)
 	if err != nil {
-		s.log.Error("Failed to fetch user email", "user", userID, "error", err)
-		return err
-	}
-	// Fetch emails from Gmail
-	emails, err := s.FetchEmailsFromGmail(gmailService, userEmail)
-	if err != nil {
-		s.log.Error("Failed to fetch emails from Gmail", "user", userID, "error", err)
 		return err
 	}
+	defer source.Close()
 
-	// Save emails to the database
-	err = s.SaveEmailsToDB(token, userID, emails)
+	// Apply the mailbox changes since the last sync
+	err = s.syncMailbox(ctx, source, account)
 	if err != nil {
-		s.log.Error("Failed to save emails to DB", "user", userID, "error", err)
+		s.log.Error("Failed to sync mailbox", "account", account.ID, "user", account.UserID, "error", err)
 		return err
 	}
 
 	return nil
 }
 
-// FetchUserEmailByID retrieves the user's email address by their ID
-func (s *EmailService) FetchUserEmailByID(userID int) (string, error) {
-	row := s.psql.QueryRow(context.Background(), "SELECT email FROM users WHERE id=$1", userID)
-	var email string
-	err := row.Scan(&email)
-	return email, err
-}
-
-// FetchEmailsFromGmail retrieves emails from Gmail
-func (s *EmailService) FetchEmailsFromGmail(service *gmail.Service, userEmail string) ([]*gmail.Message, error) {
-	// Determine the start time for the interval
-	startTime := time.Now().Add(-s.interval - 1*time.Minute).Unix()
-
-	// Form the query to fetch unread messages in the last interval+1 minutes
-	query := fmt.Sprintf("is:unread after:%d", startTime)
-	call := service.Users.Messages.List(userEmail).Q(query)
-	res, err := call.Do()
-	if err != nil {
-		return nil, err
-	}
+// sourceForAccount connects to the mailbox of a linked account. Gmail tokens
+// are refreshed first if they have expired.
+func (s *EmailService) sourceForAccount(ctx context.Context, account models.LinkedAccount) (mailsource.MailSource, error) {
+	switch account.Provider {
+	case models.ProviderGmail:
+		token, err := s.authService.AccountToken(account)
+		if err != nil {
+			s.log.Error("Failed to fetch Google token", "account", account.ID, "error", err)
+			return nil, err
+		}
 
-	var emails []*gmail.Message
-	for _, m := range res.Messages {
-		msg, err := service.Users.Messages.Get(userEmail, m.Id).Format("full").Do()
+		// Create the Gmail service client using the valid token
+		client := s.authService.OAuthConfig().Client(ctx, token)
+		gmailService, err := gmail.NewService(ctx, option.WithHTTPClient(client))
 		if err != nil {
+			s.log.Error("Failed to create Gmail service", "account", account.ID, "error", err)
 			return nil, err
 		}
-		emails = append(emails, msg)
-		// Mark the message as read
-		modifyCall := service.Users.Messages.Modify(userEmail, m.Id, &gmail.ModifyMessageRequest{
-			RemoveLabelIds: []string{"UNREAD"},
+		return mailsource.NewGmail(gmailService, account.Address, s.quota(account.ID)), nil
+	case models.ProviderIMAP:
+		source, err := mailsource.DialIMAP(ctx, mailsource.IMAPConfig{
+			Host:     account.IMAPHost,
+			Port:     account.IMAPPort,
+			TLS:      account.IMAPTLS,
+			Username: account.IMAPUsername,
+			Password: account.IMAPPassword,
+			Control:  netguard.Control,
 		})
-		_, err = modifyCall.Do()
 		if err != nil {
+			s.log.Error("Failed to connect to IMAP server", "account", account.ID, "host", account.IMAPHost, "error", err)
 			return nil, err
 		}
+		return source, nil
 	}
-	return emails, nil
+	return nil, fmt.Errorf("unknown mail provider %q", account.Provider)
 }
 
-// SaveEmailsToDB saves emails to the database
-func (s *EmailService) SaveEmailsToDB(token *oauth2.Token, userID int, messages []*gmail.Message) error {
-	tx, err := s.psql.Begin(context.Background())
+// SaveEmailsToDB saves emails of a linked account to the database and passes
+// the new ones to the hooks. Attachment contents returned with the message go
+// to the blob store; the others are only recorded with their source ID and
+// downloaded on first use or by the prefetcher.
+func (s *EmailService) SaveEmailsToDB(ctx context.Context, account models.LinkedAccount, messages []*mailsource.Message) error {
+	inserted, err := s.saveEmails(ctx, account, messages)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback(context.Background())
 
+	if len(inserted) > 0 {
+		for _, hook := range s.hooks {
+			hook(ctx, account.UserID, inserted)
+		}
+	}
+	return nil
+}
+
+// saveEmails stores the messages of an account that are not stored yet and
+// returns the emails it inserted, without running the hooks
+func (s *EmailService) saveEmails(ctx context.Context, account models.LinkedAccount, messages []*mailsource.Message) ([]models.Email, error) {
+	tx, err := s.psql.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var inserted []models.Email
 	for _, msg := range messages {
-		body := s.extractBody(msg.Payload.Parts)
-		sender := s.extractHeader(msg.Payload.Headers, "From")
-		subject := s.extractHeader(msg.Payload.Headers, "Subject")
-		sendedAt := s.extractSendedAt(msg.Payload.Headers)
-
-		_, err := tx.Exec(context.Background(), `
-			INSERT INTO emails (user_id, email_id, subject, body, sender, sended_at)
-			VALUES ($1, $2, $3, $4, $5, $6)
-			ON CONFLICT (email_id) DO NOTHING`,
-			userID, msg.Id, subject, body, sender, sendedAt,
-		)
+		structure := mimeStructure(msg.Structure)
+		email := models.Email{
+			AccountID:  account.ID,
+			EmailID:    msg.ID,
+			Subject:    msg.Subject,
+			Body:       msg.HTMLBody,
+			BodyPlain:  msg.TextBody,
+			BodyText:   bodyText(msg),
+			BodySafe:   s.safeBody(msg.HTMLBody, msg.TextBody),
+			Sender:     msg.From,
+			To:         nonNil(msg.To),
+			Cc:         nonNil(msg.Cc),
+			ReplyTo:    nonNil(msg.ReplyTo),
+			MessageID:  msg.MessageID,
+			InReplyTo:  msg.InReplyTo,
+			References: nonNil(msg.References),
+			IsRead:     !msg.HasLabel(mailsource.LabelUnread),
+			Tags:       []string{},
+			Structure:  &structure,
+			SendedAt:   msg.Date,
+		}
+		email.Snippet = htmltext.Snippet(email.BodyText, snippetLength)
+		email.ThreadID, err = resolveThread(ctx, tx, account.UserID, account.ID, messageThreadRef(msg))
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		for _, part := range msg.Payload.Parts {
-			if part.Filename != "" {
-				attachmentData := part.Body.Data
-				if part.Body.AttachmentId != "" {
-					attachmentData, err = s.fetchAttachment(token, msg.Id, part.Body.AttachmentId)
-					if err != nil {
-						s.log.Error("Failed to fetch attachment", "email_id", msg.Id, "error", err)
-						return err
-					}
-				}
+		err := tx.QueryRow(ctx, `
+			INSERT INTO emails (user_id, account_id, email_id, subject, body, body_plain, body_text, body_safe, snippet, sender,
+				to_addresses, cc_addresses, reply_to, message_id, in_reply_to, message_references, thread_id, sended_at, label_ids, is_read, mime_structure)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+			ON CONFLICT (account_id, email_id) DO NOTHING
+			RETURNING id, created_at`,
+			account.UserID, account.ID, email.EmailID, email.Subject, email.Body, email.BodyPlain, email.BodyText, email.BodySafe, email.Snippet, email.Sender,
+			email.To, email.Cc, email.ReplyTo, email.MessageID, email.InReplyTo, email.References, email.ThreadID, email.SendedAt, labelIDs(msg), email.IsRead, email.Structure,
+		).Scan(&email.ID, &email.CreatedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Already stored, with its attachments
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
 
-				_, err := tx.Exec(context.Background(), `
-					INSERT INTO attachments (email_id, attachment_id, body, mime_type, filename)
-					VALUES ((SELECT id FROM emails WHERE email_id=$1), $2, $3, $4, $5)
-					ON CONFLICT (email_id, filename, mime_type) DO NOTHING`,
-					msg.Id, part.Body.AttachmentId, attachmentData, part.MimeType, part.Filename,
-				)
+		for _, attachment := range msg.Attachments {
+			var key *string
+			size := attachment.Size
+			if attachment.Data != nil {
+				stored, err := s.blobs.Put(ctx, attachment.Data)
 				if err != nil {
-					return err
+					s.log.Error("Failed to store attachment", "email_id", msg.ID, "error", err)
+					return nil, err
 				}
+				key, size = &stored, int64(len(attachment.Data))
 			}
-		}
-	}
 
-	return tx.Commit(context.Background())
-}
+			a := models.Attachment{
+				EmailID:   email.ID,
+				Size:      size,
+				MimeType:  attachment.MimeType,
+				Filename:  attachment.Filename,
+				ContentID: attachment.ContentID,
+				Inline:    attachment.Inline,
+			}
+			err = tx.QueryRow(ctx, `
+				INSERT INTO attachments (email_id, attachment_id, part_id, sha256, size, mime_type, filename, content_id, inline)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9)
+				ON CONFLICT (email_id, part_id) DO NOTHING
+				RETURNING id`,
+				email.ID, attachment.ID, attachment.PartID, key, size, attachment.MimeType, attachment.Filename, attachment.ContentID, attachment.Inline,
+			).Scan(&a.ID)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return nil, err
+			}
+			if key != nil {
+				a.SHA256 = *key
+			}
+			email.Attachment = append(email.Attachment, a)
+		}
 
-// fetchAttachment retrieves the attachment data
-func (s *EmailService) fetchAttachment(token *oauth2.Token, messageID, attachmentID string) (string, error) {
-	client := s.authService.OAuthConfig().Client(context.Background(), token)
-	gmailService, err := gmail.NewService(context.Background(), option.WithHTTPClient(client))
-	if err != nil {
-		s.log.Error("Failed to create Gmail service", "error", err)
-		return "", err
+		inserted = append(inserted, email)
 	}
 
-	attachment, err := gmailService.Users.Messages.Attachments.Get("me", messageID, attachmentID).Do()
-	if err != nil {
-		s.log.Error("Failed to fetch attachment", "error", err)
-		return "", err
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
 	}
+	return inserted, nil
+}
 
-	data, err := base64.URLEncoding.DecodeString(attachment.Data)
-	if err != nil {
-		s.log.Error("Failed to decode attachment data", "error", err)
-		return "", err
+// bodyText returns the plain text indexed for search, taken from the HTML body
+// when there is one
+func bodyText(msg *mailsource.Message) string {
+	if msg.HTMLBody != "" {
+		return htmltext.ToText(msg.HTMLBody)
 	}
+	return msg.TextBody
+}
 
-	return base64.StdEncoding.EncodeToString(data), nil
+// mimeStructure converts the part tree of a message for storage
+func mimeStructure(p mailsource.Part) models.MIMEPart {
+	part := models.MIMEPart{
+		PartID:      p.PartID,
+		MimeType:    p.MimeType,
+		Charset:     p.Charset,
+		Filename:    p.Filename,
+		ContentID:   p.ContentID,
+		Disposition: p.Disposition,
+		Size:        p.Size,
+	}
+	for _, child := range p.Parts {
+		part.Parts = append(part.Parts, mimeStructure(child))
+	}
+	return part
 }
 
-// extractBody extracts the body of the email
-func (s *EmailService) extractBody(parts []*gmail.MessagePart) string {
-	for _, part := range parts {
-		if len(part.Parts) > 0 {
-			return s.extractBody(part.Parts)
-		} else {
-			if part.MimeType == "text/html" {
-				data, err := base64.URLEncoding.DecodeString(part.Body.Data)
-				if err == nil {
-					return string(data)
-				}
-			}
-		}
+// nonNil returns the values of a header as a non-nil slice, stored as an empty array
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
 	}
-	return ""
+	return values
 }
 
-// extractHeader extracts the header of the email
-func (s *EmailService) extractHeader(headers []*gmail.MessagePartHeader, name string) string {
-	for _, header := range headers {
-		if header.Name == name {
-			return header.Value
-		}
+// labelIDs returns the labels of the message as a non-nil slice
+func labelIDs(msg *mailsource.Message) []string {
+	if msg.Labels == nil {
+		return []string{}
 	}
-	return ""
+	return msg.Labels
 }
 
-// extractSendedAt extracts the SendedAt information of the email
-func (s *EmailService) extractSendedAt(headers []*gmail.MessagePartHeader) time.Time {
-	for _, header := range headers {
-		if header.Name == "Date" {
-			parsedTime, err := time.Parse(time.RFC1123Z, header.Value)
-			if err == nil {
-				return parsedTime
-			}
-		}
+// ErrUserNotFound is returned when no user has the email address
+var ErrUserNotFound = errors.New("user not found")
+
+// GetUserIDByEmail retrieves the user ID by email address from the database
+func (s *EmailService) GetUserIDByEmail(email string) (int, error) {
+	row := s.psql.QueryRow(context.Background(), "SELECT id FROM users WHERE email=$1", email)
+	var userID int
+	err := row.Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrUserNotFound
 	}
-	return time.Now()
+	return userID, err
 }
 
-// GetEmailsByUserID retrieves emails by user ID from the database
-func (s *EmailService) GetEmailsByUserID(userID int) ([]models.Email, error) {
-	rows, err := s.psql.Query(context.Background(), "SELECT id, email_id, subject, body, sender FROM emails WHERE user_id=$1", userID)
+// OwnsAddress reports whether the address is the user's login or one of their linked mailboxes
+func (s *EmailService) OwnsAddress(userID int, address string) (bool, error) {
+	var owned bool
+	err := s.psql.QueryRow(context.Background(), `
+		SELECT EXISTS (SELECT 1 FROM users WHERE id=$1 AND lower(email)=lower($2))
+			OR EXISTS (SELECT 1 FROM linked_accounts WHERE user_id=$1 AND lower(address)=lower($2))`,
+		userID, address).Scan(&owned)
+	return owned, err
+}
+
+// DeleteEmailByID deletes an email by its Gmail ID from the database. A non-nil
+// userID limits the deletion to that user's mailbox.
+func (s *EmailService) DeleteEmailByID(userID *int, emailID string) error {
+	tx, err := s.psql.Begin(context.Background())
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback(context.Background())
 
-	var emails []models.Email
-	for rows.Next() {
-		var email models.Email
-		err := rows.Scan(&email.ID, &email.EmailID, &email.Subject, &email.Body, &email.Sender)
-		if err != nil {
-			return nil, err
-		}
-		emails = append(emails, email)
+	blobs, err := deleteAttachments(context.Background(), tx, "DELETE FROM attachments WHERE email_id IN (SELECT id FROM emails WHERE email_id=$1 AND ($2::int IS NULL OR user_id=$2)) RETURNING sha256", emailID, userID)
+	if err != nil {
+		return err
 	}
-	return emails, nil
-}
 
-// GetAllEmails retrieves all emails from the database
-func (s *EmailService) GetAllEmails() ([]models.Email, error) {
-	rows, err := s.psql.Query(context.Background(), "SELECT id, email_id, subject, body, sender FROM emails")
+	tag, err := tx.Exec(context.Background(), "DELETE FROM emails WHERE email_id=$1 AND ($2::int IS NULL OR user_id=$2)", emailID, userID)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-
-	var emails []models.Email
-	for rows.Next() {
-		var email models.Email
-		err := rows.Scan(&email.ID, &email.EmailID, &email.Subject, &email.Body, &email.Sender)
-		if err != nil {
-			return nil, err
-		}
-		emails = append(emails, email)
+	if tag.RowsAffected() == 0 {
+		return ErrEmailNotFound
 	}
-	return emails, nil
-}
 
-// GetUserIDByEmail retrieves the user ID by email address from the database
-func (s *EmailService) GetUserIDByEmail(email string) (int, error) {
-	row := s.psql.QueryRow(context.Background(), "SELECT id FROM users WHERE email=$1", email)
-	var userID int
-	err := row.Scan(&userID)
-	return userID, err
+	if err := tx.Commit(context.Background()); err != nil {
+		return err
+	}
+	s.pruneBlobs(context.Background(), blobs)
+	return nil
 }
 
-// DeleteEmailByID deletes an email by its ID from the database
-func (s *EmailService) DeleteEmailByID(emailID string) error {
+// UnlinkAccount disconnects a mailbox from the user and deletes its emails
+// along with the blobs no other email refers to
+func (s *EmailService) UnlinkAccount(userID, accountID int) error {
 	tx, err := s.psql.Begin(context.Background())
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(context.Background())
 
-	_, err = tx.Exec(context.Background(), "DELETE FROM attachments WHERE email_id=(SELECT id FROM emails WHERE email_id=$1)", emailID)
+	blobs, err := deleteAttachments(context.Background(), tx, "DELETE FROM attachments WHERE email_id IN (SELECT id FROM emails WHERE account_id=$1 AND user_id=$2) RETURNING sha256", accountID, userID)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(context.Background(), "DELETE FROM emails WHERE email_id=$1", emailID)
-	if err != nil {
+	if err := s.authService.UnlinkAccount(context.Background(), tx, userID, accountID); err != nil {
 		return err
 	}
 
-	return tx.Commit(context.Background())
+	if err := tx.Commit(context.Background()); err != nil {
+		return err
+	}
+	s.pruneBlobs(context.Background(), blobs)
+	return nil
 }
 
 // DeleteAllEmailsByUserID deletes all emails by user ID from the database
@@ -376,7 +459,7 @@ func (s *EmailService) DeleteAllEmailsByUserID(userID int) error {
 	}
 	defer tx.Rollback(context.Background())
 
-	_, err = tx.Exec(context.Background(), "DELETE FROM attachments WHERE email_id IN (SELECT id FROM emails WHERE user_id=$1)", userID)
+	blobs, err := deleteAttachments(context.Background(), tx, "DELETE FROM attachments WHERE email_id IN (SELECT id FROM emails WHERE user_id=$1) RETURNING sha256", userID)
 	if err != nil {
 		return err
 	}
@@ -386,5 +469,9 @@ func (s *EmailService) DeleteAllEmailsByUserID(userID int) error {
 		return err
 	}
 
-	return tx.Commit(context.Background())
+	if err := tx.Commit(context.Background()); err != nil {
+		return err
+	}
+	s.pruneBlobs(context.Background(), blobs)
+	return nil
 }
@@ -0,0 +1,65 @@
+package emailService
+
+import (
+	"context"
+
+	"github.com/17HIERARCH70/SocialManager/internal/lib/mailsource"
+)
+
+// BackfillDecodedHeaders decodes the RFC 2047 encoded words left in the
+// subjects and senders of emails stored before headers were decoded. It stops
+// once every email is done or ctx is cancelled.
+func (s *EmailService) BackfillDecodedHeaders(ctx context.Context) {
+	done, lastID := 0, 0
+	for ctx.Err() == nil {
+		rows, err := s.psql.Query(ctx, `
+			SELECT id, subject, sender FROM emails
+			WHERE (subject LIKE '%=?%?=%' OR sender LIKE '%=?%?=%') AND id > $1
+			ORDER BY id LIMIT $2`, lastID, backfillBatch)
+		if err != nil {
+			s.log.Error("Failed to fetch emails to decode", "error", err)
+			return
+		}
+
+		type pending struct {
+			id              int
+			subject, sender string
+		}
+		var batch []pending
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.id, &p.subject, &p.sender); err != nil {
+				rows.Close()
+				s.log.Error("Failed to read email", "error", err)
+				return
+			}
+			batch = append(batch, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			s.log.Error("Failed to fetch emails to decode", "error", err)
+			return
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, p := range batch {
+			lastID = p.id
+			subject, sender := mailsource.DecodeHeader(p.subject), mailsource.DecodeHeader(p.sender)
+			if subject == p.subject && sender == p.sender {
+				continue
+			}
+			_, err := s.psql.Exec(ctx, "UPDATE emails SET subject=$2, sender=$3 WHERE id=$1", p.id, subject, sender)
+			if err != nil {
+				s.log.Error("Failed to update email", "id", p.id, "error", err)
+				return
+			}
+			done++
+		}
+	}
+
+	if done > 0 {
+		s.log.Info("Email headers decoded", "count", done)
+	}
+}
@@ -0,0 +1,124 @@
+package emailService
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/htmlsafe"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// inlineURLLifetime is the minimum time a signed inline image URL stays valid
+	inlineURLLifetime = 24 * time.Hour
+	// inlineURLStep rounds the expiry of inline image URLs, so that a body
+	// keeps the same URLs for a while and browsers can cache the images
+	inlineURLStep = 12 * time.Hour
+	// inlineKeyLabel derives the key signing inline image URLs from the proxy key
+	inlineKeyLabel = "socialmanager inline image URLs"
+)
+
+// ErrInvalidInlineURL is returned for an inline image URL that was not signed
+// by this server or has expired
+var ErrInvalidInlineURL = errors.New("invalid or expired inline image URL")
+
+// deriveKey derives a key for one purpose from a secret, so that the secret
+// itself is never used by two mechanisms
+func deriveKey(secret, label string) []byte {
+	key := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, []byte(label)), key); err != nil {
+		// HKDF only fails past 255 hashes of output
+		panic(err)
+	}
+	return key
+}
+
+// inlineURL returns the signed URL an inline image of an email body is loaded
+// from. img tags send no access token, so the signature authorizes the request
+// for the owner of the email.
+func (s *EmailService) inlineURL(userID int, a models.Attachment) string {
+	expires := time.Now().Add(inlineURLLifetime + inlineURLStep).Truncate(inlineURLStep).Unix()
+	return fmt.Sprintf("/api/attachments/%d/inline?email=%d&user=%d&expires=%d&sig=%s",
+		a.ID, a.EmailID, userID, expires, s.signInline(userID, a.EmailID, a.ID, expires))
+}
+
+// signInline returns the hex HMAC-SHA256 of an owner, an email, an attachment and an expiry
+func (s *EmailService) signInline(userID, emailID, id int, expires int64) string {
+	mac := hmac.New(sha256.New, s.inlineKey)
+	fmt.Fprintf(mac, "%d:%d:%d:%d", userID, emailID, id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// emailOwners returns the users owning the emails, keyed by email ID
+func (s *EmailService) emailOwners(ctx context.Context, emailIDs []int) (map[int]int, error) {
+	rows, err := s.psql.Query(ctx, "SELECT id, user_id FROM emails WHERE id = ANY($1)", emailIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	owners := make(map[int]int)
+	for rows.Next() {
+		var id, userID int
+		if err := rows.Scan(&id, &userID); err != nil {
+			return nil, err
+		}
+		owners[id] = userID
+	}
+	return owners, rows.Err()
+}
+
+// replaceContentIDs points the cid: images of the bodies of an email owned by
+// the user at the signed URLs of its inline attachments
+func (s *EmailService) replaceContentIDs(email *models.Email, userID int) {
+	urls := make(map[string]string)
+	for _, a := range email.Attachment {
+		if a.ContentID != "" && inlineImage(a.MimeType) {
+			urls[a.ContentID] = s.inlineURL(userID, a)
+		}
+	}
+	email.Body = htmlsafe.ReplaceContentIDs(email.Body, urls)
+	email.BodySafe = htmlsafe.ReplaceContentIDs(email.BodySafe, urls)
+}
+
+// OpenInlineAttachment returns an inline image of an email through a URL
+// signed by inlineURL. Other attachments cannot be opened this way.
+func (s *EmailService) OpenInlineAttachment(ctx context.Context, id int, email, user, expires, sig string) (models.Attachment, io.ReadSeekCloser, error) {
+	emailID, errEmail := strconv.Atoi(email)
+	userID, errUser := strconv.Atoi(user)
+	exp, errExp := strconv.ParseInt(expires, 10, 64)
+	now := time.Now()
+	// inlineURL never signs further ahead than lifetime plus step
+	if errEmail != nil || errUser != nil || errExp != nil ||
+		now.Unix() > exp || exp > now.Add(inlineURLLifetime+inlineURLStep).Unix() ||
+		!hmac.Equal([]byte(s.signInline(userID, emailID, id, exp)), []byte(strings.ToLower(sig))) {
+		return models.Attachment{}, nil, ErrInvalidInlineURL
+	}
+
+	attachment, content, err := s.OpenAttachment(ctx, &userID, id)
+	if err != nil {
+		return attachment, nil, err
+	}
+	if attachment.EmailID != emailID || attachment.ContentID == "" || !inlineImage(attachment.MimeType) {
+		content.Close()
+		return attachment, nil, ErrAttachmentNotFound
+	}
+	return attachment, content, nil
+}
+
+// inlineImage reports whether content of the MIME type is shown inline, which
+// excludes SVG images as they can run scripts when opened directly
+func inlineImage(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	return err == nil && strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml"
+}
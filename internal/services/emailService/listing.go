@@ -0,0 +1,259 @@
+package emailService
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// DefaultPageSize is used when the listing query does not set a limit
+	DefaultPageSize = 50
+	// MaxPageSize caps the number of emails returned in one page
+	MaxPageSize = 500
+	// DefaultSort orders emails from the newest to the oldest
+	DefaultSort = "-sended_at"
+)
+
+// ErrInvalidSort is returned for an unknown sort field
+var ErrInvalidSort = errors.New("invalid sort field")
+
+// ErrInvalidCursor is returned when the cursor is malformed or belongs to another sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// emailColumns lists the email columns in the order scanEmail reads them
+const emailColumns = `e.id, e.account_id, COALESCE(e.thread_id, 0), e.email_id, e.subject, e.body, e.body_plain,
+	COALESCE(e.body_safe, ''), e.snippet, e.mime_structure, e.sender, e.to_addresses, e.cc_addresses, e.reply_to,
+	e.message_id, e.in_reply_to, e.message_references, e.is_read, e.tags, COALESCE(e.sended_at, e.created_at), e.created_at`
+
+// scanEmail reads a row selected with emailColumns, followed by extra columns read into dest
+func scanEmail(row pgx.Row, email *models.Email, dest ...interface{}) error {
+	columns := []interface{}{&email.ID, &email.AccountID, &email.ThreadID, &email.EmailID, &email.Subject, &email.Body, &email.BodyPlain,
+		&email.BodySafe, &email.Snippet, &email.Structure, &email.Sender, &email.To, &email.Cc, &email.ReplyTo,
+		&email.MessageID, &email.InReplyTo, &email.References, &email.IsRead, &email.Tags, &email.SendedAt, &email.CreatedAt}
+	return row.Scan(append(columns, dest...)...)
+}
+
+// sortColumns maps the public sort fields to their SQL expressions
+var sortColumns = map[string]string{
+	"sended_at": "COALESCE(e.sended_at, e.created_at)",
+	"id":        "e.id",
+	"sender":    "e.sender",
+	"subject":   "e.subject",
+}
+
+// emailCursor is the position after the last email of a page
+type emailCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v,omitempty"`
+	ID    int    `json:"id"`
+}
+
+// queryBuilder collects WHERE conditions together with their positional arguments
+type queryBuilder struct {
+	conds []string
+	args  []interface{}
+}
+
+// arg registers a query argument and returns its placeholder
+func (b *queryBuilder) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// where adds a condition to the query
+func (b *queryBuilder) where(cond string) {
+	b.conds = append(b.conds, cond)
+}
+
+// clause renders the collected conditions as a WHERE clause
+func (b *queryBuilder) clause() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conds, " AND ")
+}
+
+// ListEmails retrieves one page of emails matching the query, the total number of
+// matching emails and the cursor of the next page
+func (s *EmailService) ListEmails(query models.EmailQuery) (models.EmailPage, error) {
+	ctx := context.Background()
+
+	sort := query.Sort
+	if sort == "" {
+		sort = DefaultSort
+	}
+	sortField, desc := parseSort(sort)
+	sortExpr, ok := sortColumns[sortField]
+	if !ok {
+		return models.EmailPage{}, ErrInvalidSort
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	b := &queryBuilder{}
+	s.applyEmailFilters(b, query)
+
+	var total int
+	err := s.psql.QueryRow(ctx, "SELECT COUNT(*) FROM emails e"+b.clause(), b.args...).Scan(&total)
+	if err != nil {
+		return models.EmailPage{}, err
+	}
+
+	if query.Cursor != "" {
+		cursor, err := decodeCursor(query.Cursor)
+		if err != nil || cursor.Sort != sort {
+			return models.EmailPage{}, ErrInvalidCursor
+		}
+		if err := applyCursor(b, sortField, sortExpr, desc, cursor); err != nil {
+			return models.EmailPage{}, err
+		}
+	}
+
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+
+	order := fmt.Sprintf(" ORDER BY %s %s, e.id %s", sortExpr, direction, direction)
+	if sortField == "id" {
+		order = fmt.Sprintf(" ORDER BY e.id %s", direction)
+	}
+
+	sql := "SELECT " + emailColumns + " FROM emails e" + b.clause() + order + " LIMIT " + b.arg(limit+1)
+
+	rows, err := s.psql.Query(ctx, sql, b.args...)
+	if err != nil {
+		return models.EmailPage{}, err
+	}
+	defer rows.Close()
+
+	emails := make([]models.Email, 0, limit)
+	for rows.Next() {
+		var email models.Email
+		err := scanEmail(rows, &email)
+		if err != nil {
+			return models.EmailPage{}, err
+		}
+		emails = append(emails, email)
+	}
+	if err := rows.Err(); err != nil {
+		return models.EmailPage{}, err
+	}
+
+	page := models.EmailPage{Emails: emails, Total: total}
+	if len(emails) > limit {
+		page.Emails = emails[:limit]
+		page.NextCursor = encodeCursor(sort, sortField, page.Emails[limit-1])
+	}
+	if err := s.withAttachments(ctx, page.Emails); err != nil {
+		return models.EmailPage{}, err
+	}
+	return page, nil
+}
+
+// applyEmailFilters adds the filter conditions of the query to the builder
+func (s *EmailService) applyEmailFilters(b *queryBuilder, query models.EmailQuery) {
+	if query.UserID != nil {
+		b.where("e.user_id = " + b.arg(*query.UserID))
+	}
+	if query.AccountID != nil {
+		b.where("e.account_id = " + b.arg(*query.AccountID))
+	}
+	if query.Sender != "" {
+		b.where("e.sender ILIKE " + b.arg("%"+escapeLike(query.Sender)+"%"))
+	}
+	if query.Subject != "" {
+		b.where("e.subject ILIKE " + b.arg("%"+escapeLike(query.Subject)+"%"))
+	}
+	if query.SendedAfter != nil {
+		b.where("e.sended_at >= " + b.arg(*query.SendedAfter))
+	}
+	if query.SendedBefore != nil {
+		b.where("e.sended_at < " + b.arg(*query.SendedBefore))
+	}
+	if query.HasAttachment != nil {
+		exists := "EXISTS (SELECT 1 FROM attachments a WHERE a.email_id = e.id)"
+		if !*query.HasAttachment {
+			exists = "NOT " + exists
+		}
+		b.where(exists)
+	}
+	if query.IsRead != nil {
+		b.where("e.is_read = " + b.arg(*query.IsRead))
+	}
+}
+
+// applyCursor restricts the listing to the emails after the cursor position
+func applyCursor(b *queryBuilder, sortField, sortExpr string, desc bool, cursor emailCursor) error {
+	op := ">"
+	if desc {
+		op = "<"
+	}
+
+	switch sortField {
+	case "id":
+		b.where(fmt.Sprintf("e.id %s %s", op, b.arg(cursor.ID)))
+	case "sended_at":
+		value, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return ErrInvalidCursor
+		}
+		b.where(fmt.Sprintf("(%s, e.id) %s (%s::timestamp, %s)", sortExpr, op, b.arg(value), b.arg(cursor.ID)))
+	default:
+		b.where(fmt.Sprintf("(%s, e.id) %s (%s, %s)", sortExpr, op, b.arg(cursor.Value), b.arg(cursor.ID)))
+	}
+	return nil
+}
+
+// parseSort splits a sort parameter such as "-sended_at" into the field and direction
+func parseSort(sort string) (string, bool) {
+	if strings.HasPrefix(sort, "-") {
+		return sort[1:], true
+	}
+	return strings.TrimPrefix(sort, "+"), false
+}
+
+// encodeCursor builds the opaque cursor pointing after the given email
+func encodeCursor(sort, sortField string, last models.Email) string {
+	cursor := emailCursor{Sort: sort, ID: last.ID}
+	switch sortField {
+	case "sended_at":
+		cursor.Value = last.SendedAt.Format(time.RFC3339Nano)
+	case "sender":
+		cursor.Value = last.Sender
+	case "subject":
+		cursor.Value = last.Subject
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses an opaque cursor
+func decodeCursor(s string) (emailCursor, error) {
+	var cursor emailCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
+
+// escapeLike escapes the LIKE wildcards in a user-supplied substring
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
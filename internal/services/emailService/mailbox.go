@@ -0,0 +1,176 @@
+package emailService
+
+import (
+	"context"
+	"errors"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/mailsource"
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrEmailNotFound is returned when the email does not exist or belongs to another user
+var ErrEmailNotFound = errors.New("email not found")
+
+// GetEmail retrieves one of the user's emails by its local ID
+func (s *EmailService) GetEmail(userID, id int) (models.Email, error) {
+	var email models.Email
+	err := scanEmail(s.psql.QueryRow(context.Background(),
+		"SELECT "+emailColumns+", e.body_text FROM emails e WHERE e.id=$1 AND e.user_id=$2", id, userID,
+	), &email, &email.BodyText)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return email, ErrEmailNotFound
+	}
+	if err != nil {
+		return email, err
+	}
+
+	emails := []models.Email{email}
+	err = s.withAttachments(context.Background(), emails)
+	return emails[0], err
+}
+
+// MarkEmailRead marks one of the user's emails as read in its mailbox
+// and records the new state locally
+func (s *EmailService) MarkEmailRead(userID, id int) error {
+	ctx := context.Background()
+	email, err := s.GetEmail(userID, id)
+	if err != nil {
+		return err
+	}
+	if email.IsRead {
+		return nil
+	}
+
+	source, err := s.sourceForEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	err = source.MarkState(ctx, []string{email.EmailID}, mailsource.State{Read: true})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.psql.Exec(ctx, `
+		UPDATE emails SET is_read=TRUE, label_ids=array_remove(label_ids, 'UNREAD')
+		WHERE id=$1`, id)
+	return err
+}
+
+// TrashEmail moves one of the user's emails to the trash of its mailbox and deletes the local copy
+func (s *EmailService) TrashEmail(ctx context.Context, userID, id int) error {
+	return s.TrashEmails(ctx, userID, []int{id})
+}
+
+// TrashEmails moves emails of the user to the trash of their mailboxes and
+// deletes the local copies. The emails of one account are moved in a single
+// request, on the connection of the running sync when called from a new email
+// hook. ErrEmailNotFound is returned, before anything is moved, when one of the
+// emails does not exist or belongs to another user.
+func (s *EmailService) TrashEmails(ctx context.Context, userID int, ids []int) error {
+	rows, err := s.psql.Query(ctx, "SELECT id, account_id, email_id FROM emails WHERE user_id=$1 AND id = ANY($2)", userID, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := make(map[int]bool)
+	localIDs := make(map[int][]int)
+	sourceIDs := make(map[int][]string)
+	for rows.Next() {
+		var id, accountID int
+		var sourceID string
+		if err := rows.Scan(&id, &accountID, &sourceID); err != nil {
+			return err
+		}
+		found[id] = true
+		localIDs[accountID] = append(localIDs[accountID], id)
+		sourceIDs[accountID] = append(sourceIDs[accountID], sourceID)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return ErrEmailNotFound
+		}
+	}
+
+	for accountID := range localIDs {
+		if err := s.trashAccountEmails(ctx, accountID, localIDs[accountID], sourceIDs[accountID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trashAccountEmails moves emails of one account to the trash and deletes them locally
+func (s *EmailService) trashAccountEmails(ctx context.Context, accountID int, ids []int, sourceIDs []string) error {
+	source := syncSourceFrom(ctx, accountID)
+	if source == nil {
+		account, err := s.authService.GetAccount(accountID)
+		if err != nil {
+			return err
+		}
+		if source, err = s.sourceForAccount(ctx, account); err != nil {
+			return err
+		}
+		defer source.Close()
+	}
+	err := source.MarkState(ctx, sourceIDs, mailsource.State{Trash: true})
+	if err != nil && !errors.Is(err, mailsource.ErrNotFound) {
+		return err
+	}
+
+	tx, err := s.psql.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	blobs, err := deleteAttachments(ctx, tx, "DELETE FROM attachments WHERE email_id = ANY($1) RETURNING sha256", ids)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM emails WHERE id = ANY($1)", ids); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	s.pruneBlobs(ctx, blobs)
+	return nil
+}
+
+// syncSourceKey is the context key of the source a sync passes to the new email hooks
+type syncSourceKey struct{}
+
+// syncSource is the open source of the account being synced
+type syncSource struct {
+	accountID int
+	source    mailsource.MailSource
+}
+
+// withSyncSource lets the hooks running under ctx reuse the source of the account's sync
+func withSyncSource(ctx context.Context, accountID int, source mailsource.MailSource) context.Context {
+	return context.WithValue(ctx, syncSourceKey{}, syncSource{accountID: accountID, source: source})
+}
+
+// syncSourceFrom returns the source of the sync running under ctx when it
+// belongs to the account, or nil
+func syncSourceFrom(ctx context.Context, accountID int) mailsource.MailSource {
+	if s, ok := ctx.Value(syncSourceKey{}).(syncSource); ok && s.accountID == accountID {
+		return s.source
+	}
+	return nil
+}
+
+// sourceForEmail connects to the linked account an email came from
+func (s *EmailService) sourceForEmail(ctx context.Context, email models.Email) (mailsource.MailSource, error) {
+	account, err := s.authService.GetAccount(email.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	return s.sourceForAccount(ctx, account)
+}
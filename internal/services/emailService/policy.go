@@ -0,0 +1,58 @@
+package emailService
+
+import (
+	"context"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/mailsource"
+)
+
+// applyIngestionPolicy applies the owner's ingestion policy to freshly stored messages of an account
+func (s *EmailService) applyIngestionPolicy(ctx context.Context, source mailsource.MailSource, account models.LinkedAccount, messages []*mailsource.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	policy, err := s.fetchIngestionPolicy(ctx, account.UserID)
+	if err != nil {
+		return err
+	}
+
+	var state mailsource.State
+	switch policy {
+	case models.IngestionPolicyMarkRead:
+		state.Read = true
+	case models.IngestionPolicyArchive:
+		state.Archive = true
+	case models.IngestionPolicyLabel:
+		state.Label = models.IngestedLabelName
+	default:
+		return nil
+	}
+
+	// Full syncs also import mail that was in the mailbox before it was linked,
+	// which the policy leaves as it is
+	ids := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Received.After(account.CreatedAt) {
+			ids = append(ids, msg.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// The resulting label changes reach the emails table through the next sync
+	if err := source.MarkState(ctx, ids, state); err != nil {
+		s.log.Error("Failed to apply ingestion policy", "account", account.ID, "policy", policy, "error", err)
+		return err
+	}
+	return nil
+}
+
+// fetchIngestionPolicy retrieves the ingestion policy of the user
+func (s *EmailService) fetchIngestionPolicy(ctx context.Context, userID int) (string, error) {
+	var policy string
+	err := s.psql.QueryRow(ctx, "SELECT ingestion_policy FROM users WHERE id=$1", userID).Scan(&policy)
+	return policy, err
+}
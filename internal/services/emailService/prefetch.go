@@ -0,0 +1,133 @@
+package emailService
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/lib/mailsource"
+)
+
+const (
+	// prefetchBatch is the number of attachments prefetched per round
+	prefetchBatch = 200
+	// maxFetchAttempts stops prefetching attachments that keep failing, they
+	// are still fetched when requested
+	maxFetchAttempts = 3
+)
+
+// prefetchPolicy selects the attachments downloaded ahead of any request
+type prefetchPolicy struct {
+	interval time.Duration
+	maxSize  int64
+	types    []string
+}
+
+// typeFilter returns the MIME types the policy prefetches, lower-cased: exact
+// types, and LIKE patterns for the families given by a prefix ending in "/".
+// all is true when the policy prefetches every type.
+func (p prefetchPolicy) typeFilter() (all bool, exact, families []string) {
+	if len(p.types) == 0 {
+		return true, nil, nil
+	}
+	exact, families = []string{}, []string{}
+	escape := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	for _, t := range p.types {
+		t = strings.ToLower(t)
+		if strings.HasSuffix(t, "/") {
+			families = append(families, escape.Replace(t)+"%")
+		} else {
+			exact = append(exact, t)
+		}
+	}
+	return false, exact, families
+}
+
+// StartAttachmentPrefetch downloads the attachments allowed by the prefetch
+// policy each interval until ctx is cancelled. It does nothing when the
+// interval is zero.
+func (s *EmailService) StartAttachmentPrefetch(ctx context.Context) {
+	if s.prefetch.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.prefetch.interval)
+	defer ticker.Stop()
+
+	for {
+		s.prefetchAttachments(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// prefetchAttachments downloads one batch of attachments, connecting once to
+// each mailbox involved
+func (s *EmailService) prefetchAttachments(ctx context.Context) {
+	// The policy is applied in the query, attachments it skips would otherwise
+	// fill every batch
+	allTypes, exact, families := s.prefetch.typeFilter()
+	rows, err := s.psql.Query(ctx, `
+		SELECT `+pendingColumns+`
+		FROM attachments a JOIN emails e ON e.id = a.email_id
+		WHERE a.sha256 IS NULL AND a.fetch_attempts < $1 AND COALESCE(a.size, 0) <= $2
+			AND ($3 OR lower(a.mime_type) = ANY($4) OR lower(a.mime_type) LIKE ANY($5))
+		ORDER BY a.id DESC LIMIT $6`, maxFetchAttempts, s.prefetch.maxSize, allTypes, exact, families, prefetchBatch)
+	if err != nil {
+		s.log.Error("Failed to fetch attachments to prefetch", "error", err)
+		return
+	}
+	byAccount := make(map[int][]pendingAttachment)
+	for rows.Next() {
+		p, err := scanPending(rows)
+		if err != nil {
+			rows.Close()
+			s.log.Error("Failed to read attachment", "error", err)
+			return
+		}
+		byAccount[p.AccountID] = append(byAccount[p.AccountID], p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		s.log.Error("Failed to fetch attachments to prefetch", "error", err)
+		return
+	}
+
+	fetched := 0
+	for accountID, pending := range byAccount {
+		if ctx.Err() != nil {
+			return
+		}
+		account, err := s.authService.GetAccount(accountID)
+		if err != nil {
+			s.log.Error("Failed to fetch linked account", "account", accountID, "error", err)
+			continue
+		}
+		source, err := s.sourceForAccount(ctx, account)
+		if err != nil {
+			continue
+		}
+		fetched += s.prefetchFrom(ctx, source, pending)
+		source.Close()
+	}
+	if fetched > 0 {
+		s.log.Info("Attachments prefetched", "count", fetched)
+	}
+}
+
+// prefetchFrom downloads attachments of one mailbox and returns how many succeeded
+func (s *EmailService) prefetchFrom(ctx context.Context, source mailsource.MailSource, pending []pendingAttachment) int {
+	fetched := 0
+	for _, p := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		if _, err := s.downloadAttachment(ctx, source, p); err == nil {
+			fetched++
+		}
+	}
+	return fetched
+}
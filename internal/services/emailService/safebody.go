@@ -0,0 +1,119 @@
+package emailService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/config"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/htmlsafe"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/htmltext"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/imageproxy"
+)
+
+// ErrImagesBlocked is returned by ProxyImage when remote images are blocked
+var ErrImagesBlocked = errors.New("remote images are blocked")
+
+// Remote image modes of the images configuration
+const (
+	remoteImagesProxy = "proxy"
+	remoteImagesBlock = "block"
+)
+
+// proxyKeyLabel derives the key signing proxied image URLs from the proxy key
+const proxyKeyLabel = "socialmanager image proxy URLs"
+
+// newImageProxy creates the proxy of remote images, or returns nil when they are blocked
+func newImageProxy(cfg *config.Config) (*imageproxy.Proxy, error) {
+	switch cfg.Images.Remote {
+	case remoteImagesBlock:
+		return nil, nil
+	case remoteImagesProxy:
+	default:
+		return nil, fmt.Errorf("unknown remote image mode %q", cfg.Images.Remote)
+	}
+
+	timeout, err := time.ParseDuration(cfg.Images.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image proxy timeout: %w", err)
+	}
+	return imageproxy.New(string(deriveKey(cfg.Images.ProxyKey, proxyKeyLabel)), cfg.Images.MaxSize, timeout), nil
+}
+
+// safeBody returns the sanitized HTML of a body, built from the plain text
+// alternative when the email has no HTML part
+func (s *EmailService) safeBody(html, text string) string {
+	if html == "" {
+		return htmlsafe.FromText(text)
+	}
+	var images htmlsafe.ImageRewriter
+	if s.images != nil {
+		images = s.images.Rewrite
+	}
+	return htmlsafe.Sanitize(html, images)
+}
+
+// ProxyImage fetches a remote image referenced by a sanitized body. The URL
+// must carry the signature the sanitizer gave it.
+func (s *EmailService) ProxyImage(ctx context.Context, src, sig string) (*imageproxy.Image, error) {
+	if s.images == nil {
+		return nil, ErrImagesBlocked
+	}
+	return s.images.Fetch(ctx, src, sig)
+}
+
+// BackfillSafeBodies sanitizes the bodies and builds the snippets of emails
+// stored before bodies were sanitized. It stops once every email is done or
+// ctx is cancelled.
+func (s *EmailService) BackfillSafeBodies(ctx context.Context) {
+	done, lastID := 0, 0
+	for ctx.Err() == nil {
+		rows, err := s.psql.Query(ctx, `
+			SELECT id, body, body_plain, COALESCE(body_text, '') FROM emails
+			WHERE body_safe IS NULL AND id > $1
+			ORDER BY id LIMIT $2`, lastID, backfillBatch)
+		if err != nil {
+			s.log.Error("Failed to fetch emails to sanitize", "error", err)
+			return
+		}
+
+		type pending struct {
+			id                int
+			body, plain, text string
+		}
+		var batch []pending
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.id, &p.body, &p.plain, &p.text); err != nil {
+				rows.Close()
+				s.log.Error("Failed to read email", "error", err)
+				return
+			}
+			batch = append(batch, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			s.log.Error("Failed to fetch emails to sanitize", "error", err)
+			return
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, p := range batch {
+			lastID = p.id
+			_, err := s.psql.Exec(ctx, "UPDATE emails SET body_safe=$2, snippet=$3 WHERE id=$1",
+				p.id, s.safeBody(p.body, p.plain), htmltext.Snippet(p.text, snippetLength))
+			if err != nil {
+				s.log.Error("Failed to update email", "id", p.id, "error", err)
+				return
+			}
+			done++
+		}
+	}
+
+	if done > 0 {
+		s.log.Info("Email bodies sanitized", "count", done)
+	}
+}
@@ -0,0 +1,248 @@
+package emailService
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/mailsource"
+)
+
+// ErrSyncInProgress is returned when the previous sync of an account has not finished yet
+var ErrSyncInProgress = errors.New("sync already in progress")
+
+// syncLeaseNamespace scopes the advisory locks that make sure each account is
+// synced by a single replica at a time
+const syncLeaseNamespace = 0x534d4c // "SML"
+
+// syncState is the schedule of one linked account
+type syncState struct {
+	queued  bool
+	running bool
+	// rerun queues the account again when a notification arrived during its sync
+	rerun    bool
+	failures int
+	// nextRun delays the account after failed syncs
+	nextRun time.Time
+}
+
+// StartEmailPolling syncs every linked account each interval on a bounded pool
+// of workers. It keeps running through errors and returns once ctx is cancelled
+// and the running syncs have stopped.
+func (s *EmailService) StartEmailPolling(ctx context.Context) {
+	jobs := make(chan models.LinkedAccount, s.workers)
+	s.mu.Lock()
+	s.jobs = jobs
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.syncWorker(ctx, jobs)
+		}()
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.scheduleSyncs(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.jobs = nil
+			close(jobs)
+			s.mu.Unlock()
+			wg.Wait()
+			if err := s.leases.Close(context.Background()); err != nil {
+				s.log.Error("Failed to close the sync lease connections", "error", err)
+			}
+			s.log.Info("Email polling stopped")
+			return
+		case <-ticker.C:
+			s.scheduleSyncs(ctx)
+		}
+	}
+}
+
+// scheduleSyncs queues the accounts that are due. When the queue is full the
+// remaining accounts wait for the next round.
+func (s *EmailService) scheduleSyncs(ctx context.Context) {
+	accounts, err := s.authService.ListAllAccounts()
+	if err != nil {
+		s.log.Error("Failed to fetch linked accounts", "error", err)
+		return
+	}
+
+	skipped := 0
+	for _, account := range accounts {
+		if ctx.Err() != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.enqueue(account) == errQueueFull {
+			skipped++
+		}
+		s.mu.Unlock()
+	}
+	if skipped > 0 {
+		s.log.Warn("Sync queue is full, accounts postponed to the next round", "skipped", skipped)
+	}
+}
+
+// errQueueFull is returned by enqueue when every worker is busy and the queue is full
+var errQueueFull = errors.New("sync queue is full")
+
+// enqueue queues an account without blocking. Accounts still queued or running,
+// or waiting out a backoff, are skipped; s.mu must be held.
+func (s *EmailService) enqueue(account models.LinkedAccount) error {
+	state := s.state(account.ID)
+	if s.jobs == nil || state.queued || state.running || time.Now().Before(state.nextRun) {
+		return nil
+	}
+
+	select {
+	case s.jobs <- account:
+		state.queued = true
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// syncWorker syncs queued accounts after a random delay until the queue is closed
+func (s *EmailService) syncWorker(ctx context.Context, jobs <-chan models.LinkedAccount) {
+	for account := range jobs {
+		if s.jitter > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Duration(rand.Int63n(int64(s.jitter)))):
+			}
+		}
+		if ctx.Err() != nil {
+			s.mu.Lock()
+			s.state(account.ID).queued = false
+			s.mu.Unlock()
+			continue
+		}
+
+		err := s.UpdateEmailsForAccount(ctx, account)
+		if errors.Is(err, ErrSyncInProgress) || ctx.Err() != nil {
+			continue
+		}
+		s.recordSyncResult(account, err)
+	}
+}
+
+// requestSync queues an account out of schedule, or once more after its running
+// sync when one is in progress
+func (s *EmailService) requestSync(account models.LinkedAccount) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state := s.state(account.ID); state.running {
+		state.rerun = true
+		return
+	}
+	if err := s.enqueue(account); err != nil {
+		// The polling round picks the account up later
+		s.log.Warn("Failed to queue requested sync", "account", account.ID, "error", err)
+	}
+}
+
+// recordSyncResult resets the backoff of an account after a successful sync and
+// doubles it after a failed one, up to maxBackoff
+func (s *EmailService) recordSyncResult(account models.LinkedAccount, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state(account.ID)
+	if state.rerun {
+		state.rerun = false
+		defer s.enqueue(account)
+	}
+	if err == nil {
+		state.failures = 0
+		state.nextRun = time.Time{}
+		return
+	}
+
+	state.failures++
+	backoff := s.maxBackoff
+	if state.failures < 20 {
+		backoff = min(s.interval<<state.failures, s.maxBackoff)
+	}
+	state.nextRun = time.Now().Add(backoff)
+	s.log.Warn("Sync failed, backing off", "account", account.ID, "user", account.UserID, "failures", state.failures, "retry_in", backoff)
+}
+
+// beginSync marks the account as running unless it already is
+func (s *EmailService) beginSync(accountID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state(accountID)
+	if state.running {
+		return false
+	}
+	state.running = true
+	state.queued = false
+	return true
+}
+
+// acquireLease takes the cluster-wide lease of an account. It returns
+// ErrSyncInProgress when another replica holds it, and otherwise a context
+// cancelled once the lease is lost together with a function releasing it. A
+// replica that dies loses its leases with their database connections.
+func (s *EmailService) acquireLease(ctx context.Context, accountID int) (context.Context, func(), error) {
+	lease, err := s.leases.TryLock(ctx, int32(accountID))
+	if err != nil {
+		s.log.Error("Failed to take sync lease", "account", accountID, "error", err)
+		return nil, nil, err
+	}
+	if lease == nil {
+		s.log.Debug("Account is synced by another replica", "account", accountID)
+		return nil, nil, ErrSyncInProgress
+	}
+	return lease.Context(), func() {
+		// The sync context may already be cancelled, the lease must still be released
+		if err := lease.Release(context.Background()); err != nil {
+			s.log.Error("Failed to release sync lease", "account", accountID, "error", err)
+		}
+	}, nil
+}
+
+// endSync marks the account as idle
+func (s *EmailService) endSync(accountID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state(accountID).running = false
+}
+
+// state returns the schedule of an account, s.mu must be held
+func (s *EmailService) state(accountID int) *syncState {
+	state, ok := s.syncs[accountID]
+	if !ok {
+		state = &syncState{}
+		s.syncs[accountID] = state
+	}
+	return state
+}
+
+// quota returns the Gmail API quota bucket shared by all syncs of an account
+func (s *EmailService) quota(accountID int) *mailsource.Quota {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.quotas[accountID]
+	if !ok {
+		q = mailsource.NewQuota(s.quotaUnits)
+		s.quotas[accountID] = q
+	}
+	return q
+}
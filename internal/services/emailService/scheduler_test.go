@@ -0,0 +1,107 @@
+package emailService
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"golang.org/x/exp/slog"
+)
+
+// newScheduler returns a service with only the scheduling state, queueing into jobs
+func newScheduler(jobs chan models.LinkedAccount) *EmailService {
+	return &EmailService{
+		log:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		interval:   time.Minute,
+		maxBackoff: time.Hour,
+		jobs:       jobs,
+		syncs:      make(map[int]*syncState),
+	}
+}
+
+func TestRecordSyncResultBackoff(t *testing.T) {
+	s := newScheduler(nil)
+	account := models.LinkedAccount{ID: 1, UserID: 2}
+	failed := errors.New("sync failed")
+
+	tests := []struct {
+		err  error
+		want time.Duration
+	}{
+		{err: failed, want: 2 * time.Minute},
+		{err: failed, want: 4 * time.Minute},
+		{err: failed, want: 8 * time.Minute},
+		{err: failed, want: 16 * time.Minute},
+		{err: failed, want: 32 * time.Minute},
+		{err: failed, want: time.Hour},
+		{err: failed, want: time.Hour},
+		{err: nil},
+		{err: failed, want: 2 * time.Minute},
+	}
+	for i, tt := range tests {
+		before := time.Now()
+		s.recordSyncResult(account, tt.err)
+		state := s.state(account.ID)
+		if tt.err == nil {
+			if state.failures != 0 || !state.nextRun.IsZero() {
+				t.Errorf("after success %d: failures = %d, nextRun = %v, want reset", i, state.failures, state.nextRun)
+			}
+			continue
+		}
+		if got := state.nextRun.Sub(before); got < tt.want || got > tt.want+time.Second {
+			t.Errorf("after failure %d: backoff = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestRecordSyncResultBackoffOverflow(t *testing.T) {
+	s := newScheduler(nil)
+	account := models.LinkedAccount{ID: 1}
+	for i := 0; i < 70; i++ {
+		s.recordSyncResult(account, errors.New("sync failed"))
+	}
+	if got := time.Until(s.state(account.ID).nextRun); got <= 0 || got > time.Hour {
+		t.Errorf("backoff after 70 failures = %v, want at most the maximum of %v", got, time.Hour)
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	jobs := make(chan models.LinkedAccount, 1)
+	s := newScheduler(jobs)
+	first, second := models.LinkedAccount{ID: 1}, models.LinkedAccount{ID: 2}
+
+	if err := s.enqueue(first); err != nil || len(jobs) != 1 {
+		t.Fatalf("enqueue() = %v with %d queued, want the account queued", err, len(jobs))
+	}
+	if err := s.enqueue(first); err != nil || len(jobs) != 1 {
+		t.Errorf("enqueue() of a queued account = %v with %d queued, want it skipped", err, len(jobs))
+	}
+	if err := s.enqueue(second); !errors.Is(err, errQueueFull) {
+		t.Errorf("enqueue() into a full queue = %v, want errQueueFull", err)
+	}
+
+	<-jobs
+	if !s.beginSync(first.ID) || s.beginSync(first.ID) {
+		t.Fatal("beginSync() did not mark the account running once")
+	}
+	if err := s.enqueue(first); err != nil || len(jobs) != 0 {
+		t.Errorf("enqueue() of a running account = %v with %d queued, want it skipped", err, len(jobs))
+	}
+
+	// A sync requested while running is queued again once it finishes
+	s.requestSync(first)
+	s.state(first.ID).running = false
+	s.recordSyncResult(first, errors.New("sync failed"))
+	if len(jobs) != 0 {
+		t.Error("an account backing off was queued again")
+	}
+
+	s.state(first.ID).nextRun = time.Time{}
+	s.state(first.ID).rerun = true
+	s.recordSyncResult(first, nil)
+	if len(jobs) != 1 {
+		t.Error("a sync requested while running was not queued again")
+	}
+}
@@ -0,0 +1,120 @@
+package emailService
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/searchquery"
+)
+
+// ts_headline wraps matches in control characters that highlightSnippet turns
+// into <mark> tags once the text is escaped, since the body is untrusted
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// headlineOptions configure the highlighted snippets returned by a search
+const headlineOptions = "StartSel=\"" + highlightStart + "\", StopSel=\"" + highlightStop + "\", MaxFragments=2, MaxWords=30, MinWords=10, FragmentDelimiter=\" … \""
+
+// markerFreeBody is the body text without the marker characters, so that an
+// email cannot forge highlights
+const markerFreeBody = "translate(e.body_text, chr(2) || chr(3), '')"
+
+// highlightMarks replaces the ts_headline markers with <mark> tags
+var highlightMarks = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+// snippetLength is the snippet size used when the query has no free text
+const snippetLength = 200
+
+// SearchEmails runs a full-text search over the stored emails. The results are
+// ordered by rank, or by date when the query only contains operators. userID
+// restricts the search to one user's mailbox and accountID to one linked account
+// when they are not nil.
+func (s *EmailService) SearchEmails(userID, accountID *int, query searchquery.Query, limit, offset int) ([]models.SearchResult, int, error) {
+	ctx := context.Background()
+
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	b := &queryBuilder{}
+	from := "emails e"
+	rank := "0::real"
+	snippet := fmt.Sprintf("left(%s, %d)", markerFreeBody, snippetLength)
+	order := "COALESCE(e.sended_at, e.created_at) DESC, e.id DESC"
+
+	if query.Text != "" {
+		from = fmt.Sprintf("emails e, websearch_to_tsquery('simple', %s) q", b.arg(query.Text))
+		b.where("e.search_vector @@ q")
+		rank = "ts_rank(e.search_vector, q)"
+		snippet = fmt.Sprintf("ts_headline('simple', %s, q, '%s')", markerFreeBody, headlineOptions)
+		order = "rank DESC, " + order
+	}
+
+	if userID != nil {
+		b.where("e.user_id = " + b.arg(*userID))
+	}
+	if accountID != nil {
+		b.where("e.account_id = " + b.arg(*accountID))
+	}
+	for _, sender := range query.From {
+		b.where("e.sender ILIKE " + b.arg("%"+escapeLike(sender)+"%"))
+	}
+	for _, subject := range query.Subject {
+		b.where("e.subject ILIKE " + b.arg("%"+escapeLike(subject)+"%"))
+	}
+	if query.HasAttachment {
+		b.where("EXISTS (SELECT 1 FROM attachments a WHERE a.email_id = e.id)")
+	}
+	if query.IsRead != nil {
+		b.where("e.is_read = " + b.arg(*query.IsRead))
+	}
+	if query.After != nil {
+		b.where("e.sended_at >= " + b.arg(*query.After))
+	}
+	if query.Before != nil {
+		b.where("e.sended_at < " + b.arg(*query.Before))
+	}
+
+	var total int
+	err := s.psql.QueryRow(ctx, "SELECT COUNT(*) FROM "+from+b.clause(), b.args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sql := fmt.Sprintf(`SELECT %s, %s AS rank, %s
+		FROM %s%s
+		ORDER BY %s
+		LIMIT %s OFFSET %s`,
+		emailColumns, rank, snippet, from, b.clause(), order, b.arg(limit), b.arg(offset))
+
+	rows, err := s.psql.Query(ctx, sql, b.args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results := make([]models.SearchResult, 0, limit)
+	for rows.Next() {
+		var r models.SearchResult
+		err := scanEmail(rows, &r.Email, &r.Rank, &r.Snippet)
+		if err != nil {
+			return nil, 0, err
+		}
+		r.Snippet = highlightSnippet(r.Snippet)
+		results = append(results, r)
+	}
+	return results, total, rows.Err()
+}
+
+// highlightSnippet escapes a snippet for HTML and marks its matches
+func highlightSnippet(snippet string) string {
+	return highlightMarks.Replace(html.EscapeString(snippet))
+}
@@ -0,0 +1,241 @@
+package emailService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/mailcompose"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/mailsource"
+	"github.com/17HIERARCH70/SocialManager/internal/services/authService"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	// ErrSendUnsupported is returned when the account cannot send mail, as only Gmail accounts can
+	ErrSendUnsupported = errors.New("sending is only supported for Gmail accounts")
+	// ErrSendNotPermitted is returned when the account declined the permission to
+	// send or was linked before sending was allowed, and has to be linked again
+	ErrSendNotPermitted = errors.New("the account has not granted the permission to send mail, link it again")
+	// ErrInvalidOutgoing is returned for an email without valid recipients or content
+	ErrInvalidOutgoing = errors.New("invalid email")
+)
+
+// SendEmail sends a new email from one of the user's Gmail accounts, the first
+// one unless out.AccountID is set, and records it locally
+func (s *EmailService) SendEmail(ctx context.Context, userID int, out models.OutgoingEmail) (models.Email, error) {
+	account, err := s.sendingAccount(userID, out.AccountID)
+	if err != nil {
+		return models.Email{}, err
+	}
+
+	draft := outgoingDraft(account, out)
+	return s.send(ctx, account, draft, "")
+}
+
+// ReplyToEmail answers one of the user's emails from the account it was
+// received in, in the same thread. Recipients and subject default to those of
+// the original email.
+func (s *EmailService) ReplyToEmail(ctx context.Context, userID, id int, out models.OutgoingEmail) (models.Email, error) {
+	original, err := s.GetEmail(userID, id)
+	if err != nil {
+		return models.Email{}, err
+	}
+	account, err := s.sendingAccount(userID, original.AccountID)
+	if err != nil {
+		return models.Email{}, err
+	}
+
+	if len(out.To) == 0 && len(out.Cc) == 0 && len(out.Bcc) == 0 {
+		out.To, out.Cc = replyRecipients(original, account.Address, out.ReplyAll)
+	}
+	if out.Subject == "" {
+		out.Subject = original.Subject
+		if !strings.HasPrefix(strings.ToLower(out.Subject), "re:") {
+			out.Subject = "Re: " + out.Subject
+		}
+	}
+
+	draft := outgoingDraft(account, out)
+	if original.MessageID != "" {
+		draft.InReplyTo = original.MessageID
+		draft.References = append(original.References[:len(original.References):len(original.References)], original.MessageID)
+	}
+
+	threadID, err := s.sourceThreadID(ctx, original.ThreadID)
+	if err != nil {
+		return models.Email{}, err
+	}
+	return s.send(ctx, account, draft, threadID)
+}
+
+// sendingAccount returns the account of the user to send from, the first
+// Gmail account when accountID is zero
+func (s *EmailService) sendingAccount(userID, accountID int) (models.LinkedAccount, error) {
+	if accountID != 0 {
+		account, err := s.authService.GetAccount(accountID)
+		if err != nil {
+			return account, err
+		}
+		if account.UserID != userID {
+			return models.LinkedAccount{}, authService.ErrAccountNotFound
+		}
+		return account, nil
+	}
+
+	accounts, err := s.authService.ListAccounts(userID)
+	if err != nil {
+		return models.LinkedAccount{}, err
+	}
+	for _, account := range accounts {
+		if account.Provider == models.ProviderGmail {
+			return account, nil
+		}
+	}
+	return models.LinkedAccount{}, authService.ErrAccountNotFound
+}
+
+// outgoingDraft returns the draft of an outgoing email sent from the account
+func outgoingDraft(account models.LinkedAccount, out models.OutgoingEmail) mailcompose.Draft {
+	draft := mailcompose.Draft{
+		From:    account.Address,
+		To:      out.To,
+		Cc:      out.Cc,
+		Bcc:     out.Bcc,
+		Subject: out.Subject,
+		Text:    out.Body,
+		HTML:    out.HTML,
+	}
+	for _, a := range out.Attachments {
+		draft.Attachments = append(draft.Attachments, mailcompose.File{Filename: a.Filename, MimeType: a.MimeType, Data: a.Content})
+	}
+	return draft
+}
+
+// replyRecipients returns the recipients of a reply to the email: its Reply-To
+// or sender, joined by its other recipients for a reply to all. A reply to an
+// email the user sent goes to the original recipients.
+func replyRecipients(original models.Email, own string, all bool) ([]string, []string) {
+	own = addressOf(own)
+	to := original.ReplyTo
+	if len(to) == 0 {
+		to = []string{original.Sender}
+	}
+	if addressOf(original.Sender) == own {
+		to = original.To
+	}
+
+	seen := map[string]bool{own: true}
+	pick := func(entries []string) []string {
+		var picked []string
+		for _, entry := range entries {
+			address := addressOf(entry)
+			if address == "" || seen[address] {
+				continue
+			}
+			seen[address] = true
+			picked = append(picked, entry)
+		}
+		return picked
+	}
+
+	to = pick(to)
+	if !all {
+		return to, nil
+	}
+	to = append(to, pick(original.To)...)
+	return to, pick(original.Cc)
+}
+
+// sourceThreadID returns the thread ID the mail source gave to a local thread,
+// empty when the thread is not known to the source
+func (s *EmailService) sourceThreadID(ctx context.Context, threadID int) (string, error) {
+	if threadID == 0 {
+		return "", nil
+	}
+	var key string
+	err := s.psql.QueryRow(ctx, "SELECT thread_key FROM threads WHERE id=$1", threadID).Scan(&key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	id, found := strings.CutPrefix(key, "source:")
+	if !found {
+		return "", nil
+	}
+	return id, nil
+}
+
+// send delivers the draft through the account's mailbox and records the sent email
+func (s *EmailService) send(ctx context.Context, account models.LinkedAccount, draft mailcompose.Draft, threadID string) (models.Email, error) {
+	if account.Provider != models.ProviderGmail {
+		return models.Email{}, ErrSendUnsupported
+	}
+	raw, messageID, err := mailcompose.Build(draft)
+	if err != nil {
+		return models.Email{}, fmt.Errorf("%w: %w", ErrInvalidOutgoing, err)
+	}
+
+	source, err := s.sourceForAccount(ctx, account)
+	if err != nil {
+		return models.Email{}, err
+	}
+	defer source.Close()
+	sender, ok := source.(mailsource.Sender)
+	if !ok {
+		return models.Email{}, ErrSendUnsupported
+	}
+
+	id, err := sender.Send(ctx, raw, threadID)
+	if errors.Is(err, mailsource.ErrSendNotPermitted) {
+		return models.Email{}, ErrSendNotPermitted
+	}
+	if err != nil {
+		return models.Email{}, err
+	}
+	s.log.Info("Email sent", "account", account.ID, "user", account.UserID, "email_id", id)
+
+	email, err := s.recordSent(ctx, source, account, id)
+	if err != nil {
+		// The email is gone, failing here would only invite sending it twice;
+		// the next sync stores it
+		s.log.Error("Failed to record sent email", "account", account.ID, "email_id", id, "error", err)
+		return models.Email{
+			AccountID: account.ID,
+			EmailID:   id,
+			Subject:   draft.Subject,
+			Sender:    draft.From,
+			To:        nonNil(draft.To),
+			Cc:        nonNil(draft.Cc),
+			MessageID: messageID,
+			InReplyTo: draft.InReplyTo,
+			Tags:      []string{},
+		}, nil
+	}
+	return email, nil
+}
+
+// recordSent downloads a sent message and stores it like a synced one. The
+// new email hooks are not run: filters and notifications are for received mail.
+func (s *EmailService) recordSent(ctx context.Context, source mailsource.MailSource, account models.LinkedAccount, id string) (models.Email, error) {
+	msg, err := source.FetchMessage(ctx, id)
+	if err != nil {
+		return models.Email{}, err
+	}
+	if _, err := s.saveEmails(ctx, account, []*mailsource.Message{msg}); err != nil {
+		return models.Email{}, err
+	}
+
+	var email models.Email
+	err = scanEmail(s.psql.QueryRow(ctx, "SELECT "+emailColumns+" FROM emails e WHERE e.account_id=$1 AND e.email_id=$2", account.ID, id), &email)
+	if err != nil {
+		return email, err
+	}
+	emails := []models.Email{email}
+	err = s.withAttachments(ctx, emails)
+	return emails[0], err
+}
@@ -0,0 +1,49 @@
+package emailService
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+)
+
+func TestReplyRecipients(t *testing.T) {
+	const own = "Me <me@example.org>"
+	received := models.Email{
+		Sender: "Alice <alice@example.org>",
+		To:     []string{"me@example.org", "Bob <bob@example.org>"},
+		Cc:     []string{"Carol <carol@example.org>", "ALICE@example.org"},
+	}
+	withReplyTo := received
+	withReplyTo.ReplyTo = []string{"List <list@example.org>"}
+	sent := models.Email{
+		Sender: "me@example.org",
+		To:     []string{"Bob <bob@example.org>"},
+		Cc:     []string{"carol@example.org", "Me <ME@example.org>"},
+	}
+
+	tests := []struct {
+		name     string
+		original models.Email
+		all      bool
+		to, cc   string
+	}{
+		{name: "reply", original: received, to: "Alice <alice@example.org>"},
+		{name: "reply to all", original: received, all: true, to: "Alice <alice@example.org>|Bob <bob@example.org>", cc: "Carol <carol@example.org>"},
+		{name: "reply-to header", original: withReplyTo, to: "List <list@example.org>"},
+		{name: "reply-to header to all", original: withReplyTo, all: true, to: "List <list@example.org>|Bob <bob@example.org>", cc: "Carol <carol@example.org>|ALICE@example.org"},
+		{name: "own email", original: sent, to: "Bob <bob@example.org>"},
+		{name: "own email to all", original: sent, all: true, to: "Bob <bob@example.org>", cc: "carol@example.org"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			to, cc := replyRecipients(tt.original, own, tt.all)
+			if got := strings.Join(to, "|"); got != tt.to {
+				t.Errorf("to = %q, want %q", got, tt.to)
+			}
+			if got := strings.Join(cc, "|"); got != tt.cc {
+				t.Errorf("cc = %q, want %q", got, tt.cc)
+			}
+		})
+	}
+}
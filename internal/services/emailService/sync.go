@@ -0,0 +1,223 @@
+package emailService
+
+import (
+	"context"
+	"errors"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/mailsource"
+	"github.com/jackc/pgx/v4"
+)
+
+// syncMailbox brings the local copy of a linked mailbox up to date, using the
+// stored sync cursor when possible and falling back to a full resync otherwise
+func (s *EmailService) syncMailbox(ctx context.Context, source mailsource.MailSource, account models.LinkedAccount) error {
+	cursor, err := s.fetchSyncCursor(ctx, account.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.log.Info("No sync cursor stored, running full sync", "account", account.ID)
+		return s.fullSync(ctx, source, account, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.incrementalSync(ctx, source, account, cursor)
+	if errors.Is(err, mailsource.ErrCursorExpired) {
+		s.log.Warn("Sync cursor expired, running full sync", "account", account.ID, "cursor", cursor)
+		return s.fullSync(ctx, source, account, false)
+	}
+	return err
+}
+
+// fullSync downloads up to fullSyncLimit of the newest messages, removes local
+// emails that no longer exist in the mailbox and records the new sync cursor.
+// The initial sync of an account imports its history, which is not new mail
+// and so does not run the new email hooks.
+func (s *EmailService) fullSync(ctx context.Context, source mailsource.MailSource, account models.LinkedAccount, initial bool) error {
+	listing, err := source.List(ctx, s.fullSyncLimit)
+	if err != nil {
+		return err
+	}
+
+	known, err := s.fetchKnownEmailIDs(ctx, account.ID)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, id := range listing.IDs {
+		if !known[id] {
+			missing = append(missing, id)
+		}
+	}
+
+	if err := s.ingestMessages(ctx, source, account, missing, initial); err != nil {
+		return err
+	}
+
+	// Only a complete listing tells which local emails were deleted remotely
+	if !listing.Truncated {
+		if err := s.deleteEmailsByGmailIDs(ctx, account.ID, vanished(known, listing.IDs)); err != nil {
+			return err
+		}
+	}
+
+	return s.saveSyncCursor(ctx, account.ID, listing.Cursor)
+}
+
+// incrementalSync applies the mailbox changes recorded since the cursor
+func (s *EmailService) incrementalSync(ctx context.Context, source mailsource.MailSource, account models.LinkedAccount, cursor string) error {
+	changes, err := source.Changes(ctx, cursor)
+	if err != nil {
+		return err
+	}
+
+	if err := s.ingestMessages(ctx, source, account, changes.Added, false); err != nil {
+		return err
+	}
+
+	for id, labelIDs := range changes.Labels {
+		if err := s.updateEmailLabels(ctx, account.ID, id, labelIDs); err != nil {
+			return err
+		}
+	}
+
+	removed := changes.Deleted
+	if changes.Present != nil {
+		known, err := s.fetchKnownEmailIDs(ctx, account.ID)
+		if err != nil {
+			return err
+		}
+		removed = vanished(known, changes.Present)
+	}
+	if err := s.deleteEmailsByGmailIDs(ctx, account.ID, removed); err != nil {
+		return err
+	}
+
+	if len(changes.Added) > 0 || len(removed) > 0 || len(changes.Labels) > 0 {
+		s.log.Info("Mailbox synced", "account", account.ID, "added", len(changes.Added), "deleted", len(removed), "relabeled", len(changes.Labels))
+	}
+
+	return s.saveSyncCursor(ctx, account.ID, changes.Cursor)
+}
+
+// ingestMessages downloads, stores and applies the ingestion policy to new
+// messages. Messages of an initial sync are stored without running the hooks.
+func (s *EmailService) ingestMessages(ctx context.Context, source mailsource.MailSource, account models.LinkedAccount, ids []string, initial bool) error {
+	messages, err := s.fetchMessages(ctx, source, ids)
+	if err != nil {
+		return err
+	}
+	if initial {
+		_, err = s.saveEmails(ctx, account, messages)
+	} else {
+		err = s.SaveEmailsToDB(withSyncSource(ctx, account.ID, source), account, messages)
+	}
+	if err != nil {
+		return err
+	}
+	return s.applyIngestionPolicy(ctx, source, account, messages)
+}
+
+// fetchMessages downloads the messages with the given IDs, skipping drafts
+// and messages that were deleted before they could be fetched
+func (s *EmailService) fetchMessages(ctx context.Context, source mailsource.MailSource, ids []string) ([]*mailsource.Message, error) {
+	var messages []*mailsource.Message
+	for _, id := range ids {
+		msg, err := source.FetchMessage(ctx, id)
+		if errors.Is(err, mailsource.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if msg.HasLabel(mailsource.LabelDraft) {
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// fetchSyncCursor retrieves the sync cursor of the account
+func (s *EmailService) fetchSyncCursor(ctx context.Context, accountID int) (string, error) {
+	var cursor string
+	err := s.psql.QueryRow(ctx, "SELECT sync_cursor FROM linked_accounts WHERE id=$1 AND sync_cursor IS NOT NULL", accountID).Scan(&cursor)
+	return cursor, err
+}
+
+// saveSyncCursor stores the cursor the next sync of the account starts from
+func (s *EmailService) saveSyncCursor(ctx context.Context, accountID int, cursor string) error {
+	_, err := s.psql.Exec(ctx, "UPDATE linked_accounts SET sync_cursor=$2, synced_at=NOW() WHERE id=$1", accountID, cursor)
+	return err
+}
+
+// fetchKnownEmailIDs returns the source IDs of all emails stored for the account
+func (s *EmailService) fetchKnownEmailIDs(ctx context.Context, accountID int) (map[string]bool, error) {
+	rows, err := s.psql.Query(ctx, "SELECT email_id FROM emails WHERE account_id=$1", accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	known := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		known[id] = true
+	}
+	return known, rows.Err()
+}
+
+// updateEmailLabels replaces the stored labels and read state of an email
+func (s *EmailService) updateEmailLabels(ctx context.Context, accountID int, emailID string, labelIDs []string) error {
+	if labelIDs == nil {
+		labelIDs = []string{}
+	}
+	_, err := s.psql.Exec(ctx, "UPDATE emails SET label_ids=$3, is_read=NOT ('UNREAD' = ANY($3)) WHERE account_id=$1 AND email_id=$2", accountID, emailID, labelIDs)
+	return err
+}
+
+// deleteEmailsByGmailIDs deletes the account's emails with the given source IDs
+func (s *EmailService) deleteEmailsByGmailIDs(ctx context.Context, accountID int, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	tx, err := s.psql.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	blobs, err := deleteAttachments(ctx, tx, "DELETE FROM attachments WHERE email_id IN (SELECT id FROM emails WHERE account_id=$1 AND email_id = ANY($2)) RETURNING sha256", accountID, ids)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM emails WHERE account_id=$1 AND email_id = ANY($2)", accountID, ids); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	s.pruneBlobs(ctx, blobs)
+	return nil
+}
+
+// vanished returns the known IDs missing from the IDs present in the mailbox
+func vanished(known map[string]bool, present []string) []string {
+	set := make(map[string]bool, len(present))
+	for _, id := range present {
+		set[id] = true
+	}
+	var deleted []string
+	for id := range known {
+		if !set[id] {
+			deleted = append(deleted, id)
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,398 @@
+package emailService
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/mailsource"
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrThreadNotFound is returned when the thread does not exist, has no emails
+// left or belongs to another user
+var ErrThreadNotFound = errors.New("thread not found")
+
+// threadRef holds what links a message to its conversation
+type threadRef struct {
+	// SourceThreadID is the thread ID given by the mail source, if it has threads
+	SourceThreadID string
+	// EmailID is the source ID of the message
+	EmailID    string
+	MessageID  string
+	InReplyTo  string
+	References []string
+}
+
+// messageThreadRef returns the thread links of a downloaded message
+func messageThreadRef(msg *mailsource.Message) threadRef {
+	return threadRef{
+		SourceThreadID: msg.ThreadID,
+		EmailID:        msg.ID,
+		MessageID:      msg.MessageID,
+		InReplyTo:      msg.InReplyTo,
+		References:     msg.References,
+	}
+}
+
+// key identifies the conversation of the message within its account: the
+// thread of the source when it has one, otherwise the first message ID of the
+// conversation, so that replies and the message they answer share the key
+// whatever order they arrive in
+func (r threadRef) key() string {
+	switch {
+	case r.SourceThreadID != "":
+		return "source:" + r.SourceThreadID
+	case len(r.References) > 0:
+		return "msgid:" + r.References[0]
+	case r.InReplyTo != "":
+		return "msgid:" + r.InReplyTo
+	case r.MessageID != "":
+		return "msgid:" + r.MessageID
+	}
+	return "email:" + r.EmailID
+}
+
+// related returns the message IDs the message refers to
+func (r threadRef) related() []string {
+	ids := r.References
+	if r.InReplyTo != "" {
+		ids = append(ids[:len(ids):len(ids)], r.InReplyTo)
+	}
+	return ids
+}
+
+// queryRower runs single-row queries, on the pool or within a transaction
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// resolveThread returns the thread of a message, creating it for the first
+// message of a conversation. A message whose key is not known yet joins the
+// thread of a stored message it refers to.
+func resolveThread(ctx context.Context, q queryRower, userID, accountID int, ref threadRef) (int, error) {
+	key := ref.key()
+
+	var id int
+	err := q.QueryRow(ctx, "SELECT id FROM threads WHERE account_id=$1 AND thread_key=$2", accountID, key).Scan(&id)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return id, err
+	}
+
+	if related := ref.related(); len(related) > 0 {
+		err := q.QueryRow(ctx, `
+			SELECT thread_id FROM emails
+			WHERE account_id=$1 AND message_id = ANY($2) AND thread_id IS NOT NULL
+			ORDER BY id DESC LIMIT 1`, accountID, related).Scan(&id)
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return id, err
+		}
+	}
+
+	err = q.QueryRow(ctx, `
+		INSERT INTO threads (user_id, account_id, thread_key) VALUES ($1, $2, $3)
+		ON CONFLICT (account_id, thread_key) DO UPDATE SET thread_key = EXCLUDED.thread_key
+		RETURNING id`, userID, accountID, key).Scan(&id)
+	return id, err
+}
+
+// ListThreads retrieves one page of threads, the most recently active first,
+// and the total number of matching threads. userID restricts the listing to
+// one user's mailbox and accountID to one linked account when they are not
+// nil; unread keeps only threads with unread emails.
+func (s *EmailService) ListThreads(userID, accountID *int, unread bool, limit, offset int) ([]models.Thread, int, error) {
+	ctx := context.Background()
+
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	b := &queryBuilder{}
+	if userID != nil {
+		b.where("t.user_id = " + b.arg(*userID))
+	}
+	if accountID != nil {
+		b.where("t.account_id = " + b.arg(*accountID))
+	}
+	having := ""
+	if unread {
+		having = " HAVING COUNT(*) FILTER (WHERE NOT e.is_read) > 0"
+	}
+	from := " FROM threads t JOIN emails e ON e.thread_id = t.id" + b.clause() + " GROUP BY t.id" + having
+
+	var total int
+	err := s.psql.QueryRow(ctx, "SELECT COUNT(*) FROM (SELECT t.id"+from+") matched", b.args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.psql.Query(ctx, `
+		SELECT t.id, t.user_id, t.account_id, COUNT(*), COUNT(*) FILTER (WHERE NOT e.is_read),
+			MAX(COALESCE(e.sended_at, e.created_at)) AS last_message_at,
+			(array_agg(e.subject ORDER BY COALESCE(e.sended_at, e.created_at), e.id))[1],
+			(array_agg(e.snippet ORDER BY COALESCE(e.sended_at, e.created_at) DESC, e.id DESC))[1]`+
+		from+" ORDER BY last_message_at DESC, t.id DESC LIMIT "+b.arg(limit)+" OFFSET "+b.arg(offset), b.args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	threads := make([]models.Thread, 0, limit)
+	for rows.Next() {
+		var t models.Thread
+		err := rows.Scan(&t.ID, &t.UserID, &t.AccountID, &t.MessageCount, &t.UnreadCount, &t.LastMessageAt, &t.Subject, &t.Snippet)
+		if err != nil {
+			return nil, 0, err
+		}
+		threads = append(threads, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	if err := s.withParticipants(ctx, threads); err != nil {
+		return nil, 0, err
+	}
+	return threads, total, nil
+}
+
+// withParticipants fills the Participants field of the threads
+func (s *EmailService) withParticipants(ctx context.Context, threads []models.Thread) error {
+	if len(threads) == 0 {
+		return nil
+	}
+	ids := make([]int, len(threads))
+	for i, t := range threads {
+		ids[i] = t.ID
+	}
+
+	rows, err := s.psql.Query(ctx, `
+		SELECT e.thread_id, e.sender, e.to_addresses, e.cc_addresses FROM emails e
+		WHERE e.thread_id = ANY($1)
+		ORDER BY COALESCE(e.sended_at, e.created_at), e.id`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	participants := make(map[int]*participantList)
+	for rows.Next() {
+		var email models.Email
+		if err := rows.Scan(&email.ThreadID, &email.Sender, &email.To, &email.Cc); err != nil {
+			return err
+		}
+		list, ok := participants[email.ThreadID]
+		if !ok {
+			list = &participantList{seen: make(map[string]bool)}
+			participants[email.ThreadID] = list
+		}
+		list.add(email)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range threads {
+		threads[i].Participants = []string{}
+		if list, ok := participants[threads[i].ID]; ok {
+			threads[i].Participants = list.entries
+		}
+	}
+	return nil
+}
+
+// GetThread retrieves a thread with its emails, the oldest first. A non-nil
+// userID limits the lookup to that user's threads.
+func (s *EmailService) GetThread(userID *int, id int) (models.Thread, error) {
+	ctx := context.Background()
+
+	var t models.Thread
+	err := s.psql.QueryRow(ctx, "SELECT id, user_id, account_id FROM threads WHERE id=$1 AND ($2::int IS NULL OR user_id=$2)", id, userID).
+		Scan(&t.ID, &t.UserID, &t.AccountID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return t, ErrThreadNotFound
+	}
+	if err != nil {
+		return t, err
+	}
+
+	rows, err := s.psql.Query(ctx, "SELECT "+emailColumns+" FROM emails e WHERE e.thread_id=$1 ORDER BY COALESCE(e.sended_at, e.created_at), e.id", id)
+	if err != nil {
+		return t, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var email models.Email
+		if err := scanEmail(rows, &email); err != nil {
+			return t, err
+		}
+		t.Messages = append(t.Messages, email)
+	}
+	if err := rows.Err(); err != nil {
+		return t, err
+	}
+	if len(t.Messages) == 0 {
+		return t, ErrThreadNotFound
+	}
+	if err := s.withAttachments(ctx, t.Messages); err != nil {
+		return t, err
+	}
+
+	list := &participantList{seen: make(map[string]bool)}
+	for _, email := range t.Messages {
+		list.add(email)
+		if !email.IsRead {
+			t.UnreadCount++
+		}
+	}
+	first, last := t.Messages[0], t.Messages[len(t.Messages)-1]
+	t.Subject, t.Snippet, t.LastMessageAt = first.Subject, last.Snippet, last.SendedAt
+	t.MessageCount = len(t.Messages)
+	t.Participants = list.entries
+	return t, nil
+}
+
+// participantList collects the senders and recipients of a thread once per
+// address, in the order they first appear
+type participantList struct {
+	entries []string
+	seen    map[string]bool
+}
+
+// add records the sender and the recipients of an email
+func (l *participantList) add(email models.Email) {
+	entries := append([]string{email.Sender}, email.To...)
+	for _, entry := range append(entries, email.Cc...) {
+		address := addressOf(entry)
+		if address == "" || l.seen[address] {
+			continue
+		}
+		l.seen[address] = true
+		l.entries = append(l.entries, entry)
+	}
+}
+
+// addressOf returns the lower-cased address of a "Name <address>" entry
+func addressOf(entry string) string {
+	if start := strings.LastIndexByte(entry, '<'); start >= 0 {
+		if end := strings.IndexByte(entry[start:], '>'); end > 0 {
+			entry = entry[start+1 : start+end]
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(entry))
+}
+
+// threadBackfillBatch is the number of emails assigned to threads per query
+const threadBackfillBatch = 500
+
+// BackfillThreads assigns the emails stored before threads existed to their
+// threads. The thread IDs of Gmail messages are looked up first so that old
+// and new messages of a conversation share the key of the Gmail thread. It
+// stops once every email has a thread or ctx is cancelled.
+func (s *EmailService) BackfillThreads(ctx context.Context) {
+	done, lastID := 0, 0
+	for ctx.Err() == nil {
+		rows, err := s.psql.Query(ctx, `
+			SELECT id, user_id, account_id, email_id, message_id, in_reply_to, message_references FROM emails
+			WHERE thread_id IS NULL AND id > $1
+			ORDER BY id LIMIT $2`, lastID, threadBackfillBatch)
+		if err != nil {
+			s.log.Error("Failed to fetch emails to thread", "error", err)
+			return
+		}
+
+		type pending struct {
+			id, userID, accountID int
+			ref                   threadRef
+		}
+		var batch []pending
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.id, &p.userID, &p.accountID, &p.ref.EmailID, &p.ref.MessageID, &p.ref.InReplyTo, &p.ref.References); err != nil {
+				rows.Close()
+				s.log.Error("Failed to read email", "error", err)
+				return
+			}
+			batch = append(batch, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			s.log.Error("Failed to fetch emails to thread", "error", err)
+			return
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		byAccount := make(map[int][]*threadRef)
+		for i := range batch {
+			byAccount[batch[i].accountID] = append(byAccount[batch[i].accountID], &batch[i].ref)
+		}
+		for accountID, refs := range byAccount {
+			s.fillSourceThreads(ctx, accountID, refs)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		for _, p := range batch {
+			lastID = p.id
+			threadID, err := resolveThread(ctx, s.psql, p.userID, p.accountID, p.ref)
+			if err != nil {
+				s.log.Error("Failed to resolve thread", "id", p.id, "error", err)
+				return
+			}
+			if _, err := s.psql.Exec(ctx, "UPDATE emails SET thread_id=$2 WHERE id=$1", p.id, threadID); err != nil {
+				s.log.Error("Failed to update email", "id", p.id, "error", err)
+				return
+			}
+			done++
+		}
+	}
+
+	if done > 0 {
+		s.log.Info("Emails assigned to threads", "count", done)
+	}
+}
+
+// fillSourceThreads sets the source thread IDs of messages of an account whose
+// source groups messages in threads. Messages the source no longer has, or
+// that it fails to look up, keep the keys of their headers.
+func (s *EmailService) fillSourceThreads(ctx context.Context, accountID int, refs []*threadRef) {
+	account, err := s.authService.GetAccount(accountID)
+	if err != nil {
+		s.log.Warn("Failed to fetch linked account, threading its emails by headers", "account", accountID, "error", err)
+		return
+	}
+	if account.Provider != models.ProviderGmail {
+		return
+	}
+	source, err := s.sourceForAccount(ctx, account)
+	if err != nil {
+		s.log.Warn("Failed to connect to mailbox, threading its emails by headers", "account", accountID, "error", err)
+		return
+	}
+	defer source.Close()
+	threader, ok := source.(mailsource.Threader)
+	if !ok {
+		return
+	}
+
+	for _, ref := range refs {
+		id, err := threader.ThreadID(ctx, ref.EmailID)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, mailsource.ErrNotFound) {
+				s.log.Warn("Failed to fetch thread of email", "account", accountID, "email_id", ref.EmailID, "error", err)
+			}
+			continue
+		}
+		ref.SourceThreadID = id
+	}
+}
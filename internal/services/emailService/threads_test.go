@@ -0,0 +1,75 @@
+package emailService
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestThreadRefKey(t *testing.T) {
+	tests := []struct {
+		name string
+		ref  threadRef
+		want string
+	}{
+		{
+			name: "source thread wins",
+			ref:  threadRef{SourceThreadID: "18c1", EmailID: "m1", MessageID: "<a@x>", References: []string{"<root@x>"}},
+			want: "source:18c1",
+		},
+		{
+			name: "first reference",
+			ref:  threadRef{EmailID: "m2", MessageID: "<c@x>", InReplyTo: "<b@x>", References: []string{"<root@x>", "<b@x>"}},
+			want: "msgid:<root@x>",
+		},
+		{
+			name: "in-reply-to without references",
+			ref:  threadRef{EmailID: "m3", MessageID: "<c@x>", InReplyTo: "<root@x>"},
+			want: "msgid:<root@x>",
+		},
+		{
+			name: "first message",
+			ref:  threadRef{EmailID: "m4", MessageID: "<root@x>"},
+			want: "msgid:<root@x>",
+		},
+		{
+			name: "no headers",
+			ref:  threadRef{EmailID: "m5"},
+			want: "email:m5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ref.key(); got != tt.want {
+				t.Errorf("key() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThreadRefRelated(t *testing.T) {
+	refs := []string{"<root@x>", "<b@x>"}
+	ref := threadRef{InReplyTo: "<c@x>", References: refs}
+	if got := strings.Join(ref.related(), " "); got != "<root@x> <b@x> <c@x>" {
+		t.Errorf("related() = %q", got)
+	}
+	// The references of the message are left untouched
+	if len(refs) != 2 || refs[1] != "<b@x>" {
+		t.Errorf("related() changed the references to %q", refs)
+	}
+}
+
+func TestAddressOf(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "Alice <Alice@Example.org>", want: "alice@example.org"},
+		{in: `"Smith, <John>" <john@example.org>`, want: "john@example.org"},
+		{in: " bob@example.org ", want: "bob@example.org"},
+		{in: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := addressOf(tt.in); got != tt.want {
+			t.Errorf("addressOf(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package emailService
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/gmailpush"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/mailsource"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// watchCheckInterval is how often expiring Gmail watches are looked for
+	watchCheckInterval = time.Hour
+	// watchRenewBefore renews a watch this long before it expires; Gmail
+	// recommends calling users.watch at least once a day
+	watchRenewBefore = 6 * 24 * time.Hour
+)
+
+// StartWatchRenewal registers Gmail push notifications for every Gmail account
+// and renews them before they expire, until ctx is cancelled. It does nothing
+// when no Pub/Sub topic is configured.
+func (s *EmailService) StartWatchRenewal(ctx context.Context) {
+	if s.pubsubTopic == "" {
+		return
+	}
+
+	ticker := time.NewTicker(watchCheckInterval)
+	defer ticker.Stop()
+
+	s.renewWatches(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.renewWatches(ctx)
+		}
+	}
+}
+
+// renewWatches watches the Gmail accounts whose watch is missing or expires soon
+func (s *EmailService) renewWatches(ctx context.Context) {
+	accounts, err := s.authService.ListAllAccounts()
+	if err != nil {
+		s.log.Error("Failed to fetch linked accounts", "error", err)
+		return
+	}
+
+	for _, account := range accounts {
+		if ctx.Err() != nil {
+			return
+		}
+		if account.Provider != models.ProviderGmail {
+			continue
+		}
+
+		var expiresAt *time.Time
+		err := s.psql.QueryRow(ctx, "SELECT watch_expires_at FROM linked_accounts WHERE id=$1", account.ID).Scan(&expiresAt)
+		if err != nil {
+			s.log.Error("Failed to fetch watch expiration", "account", account.ID, "error", err)
+			continue
+		}
+		if expiresAt != nil && time.Until(*expiresAt) > watchRenewBefore {
+			continue
+		}
+
+		if err := s.watchAccount(ctx, account); err != nil {
+			s.log.Error("Failed to watch Gmail account", "account", account.ID, "error", err)
+		}
+	}
+}
+
+// watchAccount registers the push notifications of a Gmail account
+func (s *EmailService) watchAccount(ctx context.Context, account models.LinkedAccount) error {
+	source, err := s.sourceForAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	gmailSource, ok := source.(*mailsource.Gmail)
+	if !ok {
+		return nil
+	}
+	expiresAt, err := gmailSource.Watch(ctx, s.pubsubTopic)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.psql.Exec(ctx, "UPDATE linked_accounts SET watch_expires_at=$2 WHERE id=$1", account.ID, expiresAt)
+	if err == nil {
+		s.log.Info("Gmail watch renewed", "account", account.ID, slog.Time("expires_at", expiresAt))
+	}
+	return err
+}
+
+// HandleGmailNotification queues an incremental sync of the mailbox a push
+// notification is about. Notifications older than the stored cursor are ignored.
+func (s *EmailService) HandleGmailNotification(ctx context.Context, n gmailpush.Notification) error {
+	accounts, err := s.authService.FindAccountsByAddress(models.ProviderGmail, n.EmailAddress)
+	if err != nil {
+		return err
+	}
+	if len(accounts) == 0 {
+		s.log.Warn("Gmail notification for an unknown mailbox", "address", n.EmailAddress, "message_id", n.MessageID)
+		return nil
+	}
+
+	for _, account := range accounts {
+		cursor, err := s.fetchSyncCursor(ctx, account.ID)
+		if err == nil {
+			if synced, err := strconv.ParseUint(cursor, 10, 64); err == nil && n.HistoryID <= synced {
+				continue
+			}
+		}
+		s.requestSync(account)
+	}
+	return nil
+}
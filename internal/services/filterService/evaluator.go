@@ -0,0 +1,137 @@
+package filterService
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+)
+
+// regexCache keeps compiled condition patterns between evaluations
+var regexCache sync.Map
+
+// Matches reports whether the email satisfies the filter conditions. A filter
+// without conditions matches every email.
+func Matches(filter models.Filter, email models.Email) bool {
+	if len(filter.Conditions) == 0 {
+		return true
+	}
+
+	for _, cond := range filter.Conditions {
+		ok := conditionMatches(cond, email)
+		if filter.MatchAll && !ok {
+			return false
+		}
+		if !filter.MatchAll && ok {
+			return true
+		}
+	}
+	return filter.MatchAll
+}
+
+// conditionMatches evaluates a single condition against the email
+func conditionMatches(cond models.FilterCondition, email models.Email) bool {
+	var values []string
+	switch cond.Field {
+	case models.FilterFieldSender:
+		values = []string{email.Sender}
+	case models.FilterFieldSubject:
+		values = []string{email.Subject}
+	case models.FilterFieldBody:
+		values = []string{email.BodyText}
+	case models.FilterFieldAttachment:
+		for _, a := range email.Attachment {
+			values = append(values, a.Filename+" "+a.MimeType)
+		}
+	}
+
+	matched := false
+	for _, value := range values {
+		if valueMatches(cond, value) {
+			matched = true
+			break
+		}
+	}
+	return matched != cond.Negate
+}
+
+// valueMatches applies the condition operator to one field value
+func valueMatches(cond models.FilterCondition, value string) bool {
+	switch cond.Operator {
+	case models.FilterOperatorContains:
+		value = strings.ToLower(value)
+		for _, keyword := range cond.Keywords {
+			if strings.Contains(value, strings.ToLower(keyword)) {
+				return true
+			}
+		}
+	case models.FilterOperatorRegex:
+		re, err := compile(cond.Pattern)
+		return err == nil && re.MatchString(value)
+	}
+	return false
+}
+
+// compile returns the compiled pattern, reusing earlier compilations
+func compile(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
+
+// Validate checks that the filter only uses known fields, operators and actions
+func Validate(filter models.Filter) error {
+	if strings.TrimSpace(filter.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidFilter)
+	}
+	if len(filter.Actions) == 0 {
+		return fmt.Errorf("%w: at least one action is required", ErrInvalidFilter)
+	}
+
+	for i, cond := range filter.Conditions {
+		switch cond.Field {
+		case models.FilterFieldSender, models.FilterFieldSubject, models.FilterFieldBody, models.FilterFieldAttachment:
+		default:
+			return fmt.Errorf("%w: condition %d has unknown field %q", ErrInvalidFilter, i, cond.Field)
+		}
+
+		switch cond.Operator {
+		case models.FilterOperatorContains:
+			if len(cond.Keywords) == 0 {
+				return fmt.Errorf("%w: condition %d needs keywords", ErrInvalidFilter, i)
+			}
+		case models.FilterOperatorRegex:
+			if _, err := regexp.Compile(cond.Pattern); err != nil || cond.Pattern == "" {
+				return fmt.Errorf("%w: condition %d has an invalid pattern", ErrInvalidFilter, i)
+			}
+		default:
+			return fmt.Errorf("%w: condition %d has unknown operator %q", ErrInvalidFilter, i, cond.Operator)
+		}
+	}
+
+	for i, action := range filter.Actions {
+		switch action.Type {
+		case models.FilterActionNotify:
+		case models.FilterActionDelete:
+			// A filter without conditions matches every email
+			if len(filter.Conditions) == 0 {
+				return fmt.Errorf("%w: action %d deletes emails, which needs at least one condition", ErrInvalidFilter, i)
+			}
+		case models.FilterActionTag:
+			if strings.TrimSpace(action.Tag) == "" {
+				return fmt.Errorf("%w: action %d needs a tag", ErrInvalidFilter, i)
+			}
+		default:
+			return fmt.Errorf("%w: action %d has unknown type %q", ErrInvalidFilter, i, action.Type)
+		}
+	}
+	return nil
+}
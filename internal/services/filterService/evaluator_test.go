@@ -0,0 +1,147 @@
+package filterService
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+)
+
+func TestMatches(t *testing.T) {
+	email := models.Email{
+		Sender:   "Alice <alice@example.org>",
+		Subject:  "Invoice 2024-03",
+		BodyText: "Please find the invoice attached.",
+		Attachment: []models.Attachment{
+			{Filename: "invoice.pdf", MimeType: "application/pdf"},
+		},
+	}
+	contains := func(field string, keywords ...string) models.FilterCondition {
+		return models.FilterCondition{Field: field, Operator: models.FilterOperatorContains, Keywords: keywords}
+	}
+	regex := func(field, pattern string) models.FilterCondition {
+		return models.FilterCondition{Field: field, Operator: models.FilterOperatorRegex, Pattern: pattern}
+	}
+	negate := func(c models.FilterCondition) models.FilterCondition {
+		c.Negate = true
+		return c
+	}
+
+	tests := []struct {
+		name       string
+		matchAll   bool
+		conditions []models.FilterCondition
+		want       bool
+	}{
+		{name: "no conditions", want: true},
+		{name: "sender keyword ignores case", conditions: []models.FilterCondition{contains(models.FilterFieldSender, "ALICE@")}, want: true},
+		{name: "any keyword", conditions: []models.FilterCondition{contains(models.FilterFieldSubject, "receipt", "invoice")}, want: true},
+		{name: "no keyword", conditions: []models.FilterCondition{contains(models.FilterFieldBody, "meeting")}},
+		{name: "subject regex", conditions: []models.FilterCondition{regex(models.FilterFieldSubject, `^Invoice \d{4}-\d{2}$`)}, want: true},
+		{name: "invalid regex", conditions: []models.FilterCondition{regex(models.FilterFieldSubject, `(`)}},
+		{name: "attachment type", conditions: []models.FilterCondition{contains(models.FilterFieldAttachment, "application/pdf")}, want: true},
+		{name: "attachment name", conditions: []models.FilterCondition{regex(models.FilterFieldAttachment, `\.docx$`)}},
+		{name: "negated", conditions: []models.FilterCondition{negate(contains(models.FilterFieldSender, "bob@"))}, want: true},
+		{name: "negated match", conditions: []models.FilterCondition{negate(contains(models.FilterFieldSender, "alice@"))}},
+		{name: "unknown field", conditions: []models.FilterCondition{contains("header", "x")}},
+		{
+			name:     "all of",
+			matchAll: true,
+			conditions: []models.FilterCondition{
+				contains(models.FilterFieldSender, "alice"),
+				contains(models.FilterFieldSubject, "invoice"),
+			},
+			want: true,
+		},
+		{
+			name:     "all of with one miss",
+			matchAll: true,
+			conditions: []models.FilterCondition{
+				contains(models.FilterFieldSender, "alice"),
+				contains(models.FilterFieldSubject, "meeting"),
+			},
+		},
+		{
+			name: "any of with one hit",
+			conditions: []models.FilterCondition{
+				contains(models.FilterFieldSender, "bob"),
+				contains(models.FilterFieldBody, "invoice"),
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := models.Filter{MatchAll: tt.matchAll, Conditions: tt.conditions}
+			if got := Matches(f, email); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesAttachmentWithoutAttachments(t *testing.T) {
+	f := models.Filter{Conditions: []models.FilterCondition{
+		{Field: models.FilterFieldAttachment, Operator: models.FilterOperatorContains, Keywords: []string{"pdf"}, Negate: true},
+	}}
+	if !Matches(f, models.Email{}) {
+		t.Error("Matches() of a negated attachment condition on an email without attachments = false, want true")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	sender := models.FilterCondition{Field: models.FilterFieldSender, Operator: models.FilterOperatorContains, Keywords: []string{"alice"}}
+	notify := models.FilterAction{Type: models.FilterActionNotify}
+	del := models.FilterAction{Type: models.FilterActionDelete}
+
+	tests := []struct {
+		name    string
+		filter  models.Filter
+		wantErr bool
+	}{
+		{name: "valid", filter: models.Filter{Name: "f", Conditions: []models.FilterCondition{sender}, Actions: []models.FilterAction{notify}}},
+		{name: "notify without conditions", filter: models.Filter{Name: "f", Actions: []models.FilterAction{notify}}},
+		{name: "delete with conditions", filter: models.Filter{Name: "f", Conditions: []models.FilterCondition{sender}, Actions: []models.FilterAction{del}}},
+		{name: "delete without conditions", filter: models.Filter{Name: "f", Actions: []models.FilterAction{notify, del}}, wantErr: true},
+		{name: "missing name", filter: models.Filter{Name: " ", Conditions: []models.FilterCondition{sender}, Actions: []models.FilterAction{notify}}, wantErr: true},
+		{name: "missing actions", filter: models.Filter{Name: "f", Conditions: []models.FilterCondition{sender}}, wantErr: true},
+		{
+			name:    "unknown field",
+			filter:  models.Filter{Name: "f", Conditions: []models.FilterCondition{{Field: "header", Operator: models.FilterOperatorContains, Keywords: []string{"x"}}}, Actions: []models.FilterAction{notify}},
+			wantErr: true,
+		},
+		{
+			name:    "contains without keywords",
+			filter:  models.Filter{Name: "f", Conditions: []models.FilterCondition{{Field: models.FilterFieldSubject, Operator: models.FilterOperatorContains}}, Actions: []models.FilterAction{notify}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid pattern",
+			filter:  models.Filter{Name: "f", Conditions: []models.FilterCondition{{Field: models.FilterFieldSubject, Operator: models.FilterOperatorRegex, Pattern: "("}}, Actions: []models.FilterAction{notify}},
+			wantErr: true,
+		},
+		{
+			name:    "empty pattern",
+			filter:  models.Filter{Name: "f", Conditions: []models.FilterCondition{{Field: models.FilterFieldSubject, Operator: models.FilterOperatorRegex}}, Actions: []models.FilterAction{notify}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown operator",
+			filter:  models.Filter{Name: "f", Conditions: []models.FilterCondition{{Field: models.FilterFieldSubject, Operator: "equals"}}, Actions: []models.FilterAction{notify}},
+			wantErr: true,
+		},
+		{name: "tag without name", filter: models.Filter{Name: "f", Conditions: []models.FilterCondition{sender}, Actions: []models.FilterAction{{Type: models.FilterActionTag}}}, wantErr: true},
+		{name: "unknown action", filter: models.Filter{Name: "f", Conditions: []models.FilterCondition{sender}, Actions: []models.FilterAction{{Type: "forward"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidFilter) {
+				t.Errorf("Validate() = %v, want ErrInvalidFilter", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package filterService
+
+import (
+	"context"
+	"errors"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"golang.org/x/exp/slog"
+)
+
+// ErrFilterNotFound is returned when the filter does not exist or belongs to another user
+var ErrFilterNotFound = errors.New("filter not found")
+
+// ErrInvalidFilter is returned when a filter fails validation
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Notifier delivers emails matched by a filter with the notify action
+type Notifier interface {
+	// Name identifies the notifier in the channel of a notify action
+	Name() string
+	Notify(ctx context.Context, userID int, email models.Email, filter models.Filter) error
+}
+
+// Mailbox carries out the delete action in the mailbox the email came from, so
+// that the next full sync does not import it again
+type Mailbox interface {
+	TrashEmails(ctx context.Context, userID int, ids []int) error
+}
+
+// FilterService manages user filters and applies them to new emails
+type FilterService struct {
+	psql      *pgxpool.Pool
+	mailbox   Mailbox
+	log       *slog.Logger
+	notifiers []Notifier
+}
+
+// NewFilterService creates a new FilterService
+func NewFilterService(psql *pgxpool.Pool, mailbox Mailbox, log *slog.Logger) *FilterService {
+	return &FilterService{
+		psql:    psql,
+		mailbox: mailbox,
+		log:     log,
+	}
+}
+
+// AddNotifier registers a notifier used by the notify action
+func (s *FilterService) AddNotifier(n Notifier) {
+	s.notifiers = append(s.notifiers, n)
+}
+
+const filterColumns = "id, user_id, name, enabled, priority, match_all, stop_processing, conditions, actions, created_at, updated_at"
+
+// scanFilter reads a filter row selected with filterColumns
+func scanFilter(row pgx.Row) (models.Filter, error) {
+	var f models.Filter
+	err := row.Scan(&f.ID, &f.UserID, &f.Name, &f.Enabled, &f.Priority, &f.MatchAll, &f.StopProcessing, &f.Conditions, &f.Actions, &f.CreatedAt, &f.UpdatedAt)
+	return f, err
+}
+
+// ListFilters retrieves the filters of the user in evaluation order
+func (s *FilterService) ListFilters(userID int) ([]models.Filter, error) {
+	return s.queryFilters(context.Background(), "SELECT "+filterColumns+" FROM filters WHERE user_id=$1 ORDER BY priority, id", userID)
+}
+
+// GetFilter retrieves a filter of the user by its ID
+func (s *FilterService) GetFilter(userID, filterID int) (models.Filter, error) {
+	row := s.psql.QueryRow(context.Background(), "SELECT "+filterColumns+" FROM filters WHERE id=$1 AND user_id=$2", filterID, userID)
+	f, err := scanFilter(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return f, ErrFilterNotFound
+	}
+	return f, err
+}
+
+// CreateFilter validates and stores a new filter
+func (s *FilterService) CreateFilter(f models.Filter) (models.Filter, error) {
+	if err := Validate(f); err != nil {
+		return f, err
+	}
+	normalize(&f)
+
+	row := s.psql.QueryRow(context.Background(), `
+		INSERT INTO filters (user_id, name, enabled, priority, match_all, stop_processing, conditions, actions)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+filterColumns,
+		f.UserID, f.Name, f.Enabled, f.Priority, f.MatchAll, f.StopProcessing, f.Conditions, f.Actions,
+	)
+	return scanFilter(row)
+}
+
+// UpdateFilter validates and replaces an existing filter of the user
+func (s *FilterService) UpdateFilter(f models.Filter) (models.Filter, error) {
+	if err := Validate(f); err != nil {
+		return f, err
+	}
+	normalize(&f)
+
+	row := s.psql.QueryRow(context.Background(), `
+		UPDATE filters
+		SET name=$3, enabled=$4, priority=$5, match_all=$6, stop_processing=$7, conditions=$8, actions=$9
+		WHERE id=$1 AND user_id=$2
+		RETURNING `+filterColumns,
+		f.ID, f.UserID, f.Name, f.Enabled, f.Priority, f.MatchAll, f.StopProcessing, f.Conditions, f.Actions,
+	)
+	updated, err := scanFilter(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return f, ErrFilterNotFound
+	}
+	return updated, err
+}
+
+// DeleteFilter deletes a filter of the user
+func (s *FilterService) DeleteFilter(userID, filterID int) error {
+	tag, err := s.psql.Exec(context.Background(), "DELETE FROM filters WHERE id=$1 AND user_id=$2", filterID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFilterNotFound
+	}
+	return nil
+}
+
+// ProcessNewEmails runs the user's enabled filters over newly stored emails.
+// It matches the NewEmailsHook signature of the email service.
+func (s *FilterService) ProcessNewEmails(ctx context.Context, userID int, emails []models.Email) {
+	filters, err := s.queryFilters(ctx, "SELECT "+filterColumns+" FROM filters WHERE user_id=$1 AND enabled ORDER BY priority, id", userID)
+	if err != nil {
+		s.log.Error("Failed to load filters", "user", userID, "error", err)
+		return
+	}
+	if len(filters) == 0 {
+		return
+	}
+
+	// Deleted emails are moved to the trash together, in one mailbox request
+	var trash []int
+	for _, email := range emails {
+		for _, f := range filters {
+			if !Matches(f, email) {
+				continue
+			}
+
+			s.log.Debug("Filter matched", "user", userID, "filter", f.ID, "email_id", email.EmailID)
+			deleted, err := s.applyActions(ctx, userID, &email, f)
+			if err != nil {
+				s.log.Error("Failed to apply filter actions", "user", userID, "filter", f.ID, "email_id", email.EmailID, "error", err)
+			}
+			if deleted {
+				trash = append(trash, email.ID)
+			}
+			if deleted || f.StopProcessing {
+				break
+			}
+		}
+	}
+
+	if len(trash) > 0 {
+		if err := s.mailbox.TrashEmails(ctx, userID, trash); err != nil {
+			s.log.Error("Failed to delete filtered emails", "user", userID, "emails", len(trash), "error", err)
+		}
+	}
+}
+
+// applyActions performs the filter actions in order and reports whether the
+// email is to be deleted, which ends the actions
+func (s *FilterService) applyActions(ctx context.Context, userID int, email *models.Email, f models.Filter) (bool, error) {
+	for _, action := range f.Actions {
+		switch action.Type {
+		case models.FilterActionTag:
+			_, err := s.psql.Exec(ctx, `
+				UPDATE emails SET tags = array_append(tags, $2)
+				WHERE id=$1 AND NOT ($2 = ANY(tags))`,
+				email.ID, action.Tag,
+			)
+			if err != nil {
+				return false, err
+			}
+			email.Tags = append(email.Tags, action.Tag)
+		case models.FilterActionNotify:
+			s.notify(ctx, userID, *email, f, action.Channel)
+		case models.FilterActionDelete:
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// notify hands the email to the notifiers selected by the channel
+func (s *FilterService) notify(ctx context.Context, userID int, email models.Email, f models.Filter, channel string) {
+	delivered := false
+	for _, n := range s.notifiers {
+		if channel != "" && channel != n.Name() {
+			continue
+		}
+		delivered = true
+		if err := n.Notify(ctx, userID, email, f); err != nil {
+			s.log.Error("Failed to notify", "notifier", n.Name(), "user", userID, "email_id", email.EmailID, "error", err)
+		}
+	}
+	if !delivered {
+		s.log.Warn("No notifier available", "channel", channel, "user", userID, "filter", f.ID)
+	}
+}
+
+// queryFilters runs a filter query selecting filterColumns
+func (s *FilterService) queryFilters(ctx context.Context, sql string, args ...interface{}) ([]models.Filter, error) {
+	rows, err := s.psql.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	filters := []models.Filter{}
+	for rows.Next() {
+		f, err := scanFilter(rows)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, rows.Err()
+}
+
+// normalize replaces nil slices so that they are stored as empty JSON arrays
+func normalize(f *models.Filter) {
+	if f.Conditions == nil {
+		f.Conditions = []models.FilterCondition{}
+	}
+	if f.Actions == nil {
+		f.Actions = []models.FilterAction{}
+	}
+}
@@ -0,0 +1,493 @@
+package telegramService
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/17HIERARCH70/SocialManager/internal/config"
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/searchquery"
+	"github.com/17HIERARCH70/SocialManager/internal/lib/telegram"
+	"github.com/17HIERARCH70/SocialManager/internal/services/emailService"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// linkCodeTTL is how long a link code can be redeemed
+	linkCodeTTL = 10 * time.Minute
+	// linkCodeAlphabet avoids characters that are easy to confuse
+	linkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	linkCodeLength   = 8
+	// maxPollTimeout keeps long polling below common proxy timeouts
+	maxPollTimeout = 50 * time.Second
+	// listSize is the number of emails shown by /inbox, /unread and /search
+	listSize = 10
+	// maxBodyLength keeps /read replies below the 4096 character message limit
+	maxBodyLength = 3500
+	// snippetLength is the body excerpt included in notifications
+	snippetLength = 300
+)
+
+// ErrNotLinked is returned when the user has no linked Telegram chat
+var ErrNotLinked = errors.New("telegram chat is not linked")
+
+// TelegramService runs the Telegram bot and delivers filter notifications
+type TelegramService struct {
+	psql         *pgxpool.Pool
+	emailService *emailService.EmailService
+	client       *telegram.Client
+	pollTimeout  time.Duration
+	log          *slog.Logger
+}
+
+// telegramSecret is the content of the file at telegram.secretPath
+type telegramSecret struct {
+	Token string `json:"token"`
+}
+
+// NewTelegramService creates a new TelegramService. The bot stays disabled when
+// no token is configured.
+func NewTelegramService(psql *pgxpool.Pool, cfg *config.Config, emailService *emailService.EmailService, log *slog.Logger) (*TelegramService, error) {
+	pollTimeout, err := time.ParseDuration(cfg.Telegram.RefreshTime)
+	if err != nil {
+		log.Error("Failed to parse Telegram refresh interval", "error", err)
+		pollTimeout = 30 * time.Second
+	}
+
+	s := &TelegramService{
+		psql:         psql,
+		emailService: emailService,
+		pollTimeout:  min(pollTimeout, maxPollTimeout),
+		log:          log,
+	}
+
+	if cfg.Telegram.SecretPath == "" {
+		log.Warn("Telegram secret path is not configured, bot disabled")
+		return s, nil
+	}
+	token, err := loadToken(cfg.Telegram.SecretPath)
+	if err != nil {
+		return s, err
+	}
+	s.client = telegram.NewClient(cfg.Telegram.BaseURL, token, cfg.Telegram.MaxRetries)
+
+	return s, nil
+}
+
+// loadToken reads the bot token from the secret file
+func loadToken(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var secret telegramSecret
+	if err := json.Unmarshal(b, &secret); err != nil {
+		return "", err
+	}
+	if secret.Token == "" {
+		return "", errors.New("telegram secret has no token")
+	}
+	return secret.Token, nil
+}
+
+// Enabled reports whether a bot token is configured
+func (s *TelegramService) Enabled() bool {
+	return s.client != nil
+}
+
+// Start long-polls the Bot API for commands until the context is cancelled
+func (s *TelegramService) Start(ctx context.Context) {
+	if !s.Enabled() {
+		return
+	}
+
+	var offset int64
+	for {
+		updates, err := s.client.GetUpdates(ctx, offset, s.pollTimeout)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.log.Error("Failed to get Telegram updates", "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			if update.Message != nil && update.Message.Text != "" {
+				s.handleMessage(ctx, update.Message)
+			}
+		}
+	}
+}
+
+// CreateLinkCode issues a one-time code that links a Telegram chat to the user
+func (s *TelegramService) CreateLinkCode(userID int) (string, time.Time, error) {
+	code, err := randomCode()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(linkCodeTTL)
+
+	ctx := context.Background()
+	_, err = s.psql.Exec(ctx, "DELETE FROM telegram_link_codes WHERE user_id=$1 OR expires_at < NOW()", userID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	_, err = s.psql.Exec(ctx, "INSERT INTO telegram_link_codes (code, user_id, expires_at) VALUES ($1, $2, $3)", code, userID, expiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return code, expiresAt, nil
+}
+
+// Unlink detaches the Telegram chat from the user
+func (s *TelegramService) Unlink(userID int) error {
+	tag, err := s.psql.Exec(context.Background(), "UPDATE users SET telegram_id=NULL WHERE id=$1 AND telegram_id IS NOT NULL", userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotLinked
+	}
+	return nil
+}
+
+// Name identifies the notifier in filter actions
+func (s *TelegramService) Name() string {
+	return "telegram"
+}
+
+// Notify pushes an email matched by a filter to the user's linked chat
+func (s *TelegramService) Notify(ctx context.Context, userID int, email models.Email, filter models.Filter) error {
+	if !s.Enabled() {
+		return nil
+	}
+
+	chatID, err := s.chatByUser(ctx, userID)
+	if errors.Is(err, ErrNotLinked) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("📬 <b>%s</b>\nFrom: %s\nFilter: %s\n\n%s\n\n/read_%d",
+		escape(email.Subject), escape(email.Sender), escape(filter.Name),
+		escape(truncate(email.BodyText, snippetLength)), email.ID)
+	return s.client.SendMessage(ctx, chatID, text)
+}
+
+// handleMessage dispatches a bot command
+func (s *TelegramService) handleMessage(ctx context.Context, msg *telegram.Message) {
+	command, arg := parseCommand(msg.Text)
+
+	var reply string
+	var err error
+	if command == "start" || command == "link" {
+		reply, err = s.link(ctx, msg.Chat.ID, arg)
+	} else {
+		userID, lookupErr := s.userByChat(ctx, msg.Chat.ID)
+		switch {
+		case errors.Is(lookupErr, ErrNotLinked):
+			reply = "This chat is not linked yet. Create a link code in SocialManager and send /start <code>."
+		case lookupErr != nil:
+			err = lookupErr
+		default:
+			reply, err = s.runCommand(ctx, userID, command, arg)
+		}
+	}
+
+	if err != nil {
+		s.log.Error("Failed to handle Telegram command", "command", command, "chat", msg.Chat.ID, "error", err)
+		reply = "Something went wrong, please try again later."
+	}
+	if reply == "" {
+		return
+	}
+	if err := s.client.SendMessage(ctx, msg.Chat.ID, reply); err != nil {
+		s.log.Error("Failed to send Telegram message", "chat", msg.Chat.ID, "error", err)
+	}
+}
+
+// runCommand executes a command of a linked user and returns the reply
+func (s *TelegramService) runCommand(ctx context.Context, userID int, command, arg string) (string, error) {
+	switch command {
+	case "inbox":
+		return s.listEmails(userID, nil)
+	case "unread":
+		unread := false
+		return s.listEmails(userID, &unread)
+	case "read":
+		return s.readEmail(userID, arg)
+	case "delete":
+		return s.deleteEmail(ctx, userID, arg)
+	case "reply":
+		return s.replyEmail(ctx, userID, arg)
+	case "search":
+		return s.search(userID, arg)
+	case "unlink":
+		if err := s.Unlink(userID); err != nil {
+			return "", err
+		}
+		return "This chat is no longer linked.", nil
+	default:
+		return helpText, nil
+	}
+}
+
+const helpText = `Commands:
+/inbox - latest emails
+/unread - latest unread emails
+/read <id> - show an email and mark it read
+/delete <id> - move an email to the trash
+/reply <id> <text> - answer an email
+/search <query> - search, e.g. /search from:alice has:attachment
+/unlink - stop receiving emails here`
+
+// link redeems a link code and binds the chat to its user
+func (s *TelegramService) link(ctx context.Context, chatID int64, code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return "Welcome to SocialManager! Create a link code in the app and send /start <code>.\n\n" + helpText, nil
+	}
+
+	tx, err := s.psql.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int
+	err = tx.QueryRow(ctx, "DELETE FROM telegram_link_codes WHERE code=$1 AND expires_at > NOW() RETURNING user_id", code).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "This link code is invalid or has expired.", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	chat := strconv.FormatInt(chatID, 10)
+	_, err = tx.Exec(ctx, "UPDATE users SET telegram_id=NULL WHERE telegram_id=$1", chat)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(ctx, "UPDATE users SET telegram_id=$2 WHERE id=$1", userID, chat)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
+
+	return "Chat linked! New emails matching your filters will arrive here.\n\n" + helpText, nil
+}
+
+// listEmails renders the newest emails of the user
+func (s *TelegramService) listEmails(userID int, isRead *bool) (string, error) {
+	page, err := s.emailService.ListEmails(models.EmailQuery{UserID: &userID, IsRead: isRead, Limit: listSize})
+	if err != nil {
+		return "", err
+	}
+	if len(page.Emails) == 0 {
+		return "No emails.", nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Showing %d of %d emails\n\n", len(page.Emails), page.Total)
+	for _, email := range page.Emails {
+		writeEmailLine(&b, email, "")
+	}
+	return b.String(), nil
+}
+
+// readEmail renders an email and marks it read
+func (s *TelegramService) readEmail(userID int, arg string) (string, error) {
+	id, err := strconv.Atoi(strings.TrimSpace(arg))
+	if err != nil {
+		return "Usage: /read <id>", nil
+	}
+
+	email, err := s.emailService.GetEmail(userID, id)
+	if errors.Is(err, emailService.ErrEmailNotFound) {
+		return "Email not found.", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.emailService.MarkEmailRead(userID, id); err != nil {
+		s.log.Error("Failed to mark email read", "user", userID, "email", id, "error", err)
+	}
+
+	return fmt.Sprintf("<b>%s</b>\nFrom: %s\nDate: %s\n\n%s\n\n/reply_%d &lt;text&gt; · /delete_%d",
+		escape(email.Subject), escape(email.Sender), email.SendedAt.Format(time.RFC1123),
+		escape(truncate(email.BodyText, maxBodyLength)), email.ID, email.ID), nil
+}
+
+// deleteEmail moves an email to the trash
+func (s *TelegramService) deleteEmail(ctx context.Context, userID int, arg string) (string, error) {
+	id, err := strconv.Atoi(strings.TrimSpace(arg))
+	if err != nil {
+		return "Usage: /delete <id>", nil
+	}
+
+	err = s.emailService.TrashEmail(ctx, userID, id)
+	if errors.Is(err, emailService.ErrEmailNotFound) {
+		return "Email not found.", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return "Email moved to the trash.", nil
+}
+
+// replyEmail answers an email with the text following its ID
+func (s *TelegramService) replyEmail(ctx context.Context, userID int, arg string) (string, error) {
+	idArg, text := arg, ""
+	if i := strings.IndexAny(arg, " \n"); i >= 0 {
+		idArg, text = arg[:i], strings.TrimSpace(arg[i+1:])
+	}
+	id, err := strconv.Atoi(idArg)
+	if err != nil || text == "" {
+		return "Usage: /reply <id> <text>", nil
+	}
+
+	_, err = s.emailService.ReplyToEmail(ctx, userID, id, models.OutgoingEmail{Body: text})
+	switch {
+	case errors.Is(err, emailService.ErrEmailNotFound):
+		return "Email not found.", nil
+	case errors.Is(err, emailService.ErrSendUnsupported), errors.Is(err, emailService.ErrSendNotPermitted),
+		errors.Is(err, emailService.ErrInvalidOutgoing):
+		return escape(err.Error()), nil
+	case err != nil:
+		return "", err
+	}
+	return "Reply sent.", nil
+}
+
+// search renders the best matches of a search query
+func (s *TelegramService) search(userID int, arg string) (string, error) {
+	query, err := searchquery.Parse(arg)
+	if err != nil {
+		return escape(err.Error()), nil
+	}
+	if query.IsEmpty() {
+		return "Usage: /search <query>", nil
+	}
+
+	results, total, err := s.emailService.SearchEmails(&userID, nil, query, listSize, 0)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "Nothing found.", nil
+	}
+
+	// Snippets are escaped HTML with <mark> tags, which Telegram does not support
+	highlight := strings.NewReplacer("<mark>", "<b>", "</mark>", "</b>")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d emails\n\n", total)
+	for _, r := range results {
+		writeEmailLine(&b, r.Email, highlight.Replace(strings.ReplaceAll(r.Snippet, "\n", " ")))
+	}
+	return b.String(), nil
+}
+
+// writeEmailLine renders one email of a list
+func writeEmailLine(b *strings.Builder, email models.Email, snippet string) {
+	marker := ""
+	if !email.IsRead {
+		marker = "• "
+	}
+	fmt.Fprintf(b, "%s<b>%s</b>\n%s · %s\n", marker, escape(email.Subject), escape(email.Sender), email.SendedAt.Format("02 Jan 15:04"))
+	if snippet != "" {
+		fmt.Fprintf(b, "%s\n", snippet)
+	}
+	fmt.Fprintf(b, "/read_%d\n\n", email.ID)
+}
+
+// userByChat returns the user linked to the chat
+func (s *TelegramService) userByChat(ctx context.Context, chatID int64) (int, error) {
+	var userID int
+	err := s.psql.QueryRow(ctx, "SELECT id FROM users WHERE telegram_id=$1", strconv.FormatInt(chatID, 10)).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotLinked
+	}
+	return userID, err
+}
+
+// chatByUser returns the chat linked to the user
+func (s *TelegramService) chatByUser(ctx context.Context, userID int) (int64, error) {
+	var chat *string
+	err := s.psql.QueryRow(ctx, "SELECT telegram_id FROM users WHERE id=$1", userID).Scan(&chat)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && chat == nil) {
+		return 0, ErrNotLinked
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(*chat, 10, 64)
+}
+
+// parseCommand splits "/read 42", "/read_42" or "/read@bot 42" into the command
+// and its argument; "/reply_42 text" keeps the text after the ID
+func parseCommand(text string) (string, string) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return "", text
+	}
+
+	command, arg := text[1:], ""
+	if i := strings.IndexAny(command, " \n"); i >= 0 {
+		command, arg = command[:i], command[i+1:]
+	}
+	command, _, _ = strings.Cut(command, "@")
+	if name, id, found := strings.Cut(command, "_"); found {
+		command, arg = name, id+" "+arg
+	}
+	return strings.ToLower(command), strings.TrimSpace(arg)
+}
+
+// randomCode generates a link code
+func randomCode() (string, error) {
+	b := make([]byte, linkCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = linkCodeAlphabet[int(b[i])%len(linkCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// escape escapes text for the HTML parse mode
+func escape(s string) string {
+	return html.EscapeString(s)
+}
+
+// truncate shortens s to at most n runes
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
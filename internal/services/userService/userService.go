@@ -0,0 +1,57 @@
+package userService
+
+import (
+	"context"
+	"errors"
+
+	"github.com/17HIERARCH70/SocialManager/internal/domain/models"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"golang.org/x/exp/slog"
+)
+
+// ErrUserNotFound is returned when the requested user does not exist
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrInvalidIngestionPolicy is returned for an unknown ingestion policy
+var ErrInvalidIngestionPolicy = errors.New("invalid ingestion policy")
+
+// UserService handles user settings
+type UserService struct {
+	psql *pgxpool.Pool
+	log  *slog.Logger
+}
+
+// NewUserService creates a new UserService
+func NewUserService(psql *pgxpool.Pool, log *slog.Logger) *UserService {
+	return &UserService{
+		psql: psql,
+		log:  log,
+	}
+}
+
+// GetIngestionPolicy retrieves the ingestion policy of the user
+func (s *UserService) GetIngestionPolicy(userID int) (string, error) {
+	var policy string
+	err := s.psql.QueryRow(context.Background(), "SELECT ingestion_policy FROM users WHERE id=$1", userID).Scan(&policy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	return policy, err
+}
+
+// SetIngestionPolicy changes the ingestion policy of the user
+func (s *UserService) SetIngestionPolicy(userID int, policy string) error {
+	if !models.ValidIngestionPolicy(policy) {
+		return ErrInvalidIngestionPolicy
+	}
+
+	tag, err := s.psql.Exec(context.Background(), "UPDATE users SET ingestion_policy=$2 WHERE id=$1", userID, policy)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// Package blobstore keeps content-addressed blobs on the local filesystem or in an S3-compatible bucket
+package blobstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/17HIERARCH70/SocialManager/internal/config"
+)
+
+// ErrNotFound is returned when no blob is stored under a key
+var ErrNotFound = errors.New("blobstore: blob not found")
+
+// errInvalidKey is returned for keys that are not a hex SHA-256
+var errInvalidKey = errors.New("blobstore: invalid key")
+
+// Store keeps immutable blobs under the hex SHA-256 of their content, so
+// identical content is stored once whoever uploads it
+type Store interface {
+	// Put stores data and returns its key. Storing existing content does nothing.
+	Put(ctx context.Context, data []byte) (string, error)
+	// Open returns the content of the blob, or ErrNotFound. Seeking lets
+	// readers serve byte ranges without reading the whole blob.
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete removes the blob, a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// Key returns the key data is stored under
+func Key(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// validKey reports whether key is a lowercase hex SHA-256. Keys become paths,
+// so anything else is rejected.
+func validKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range key {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// InitializeBlobStore creates the blob store selected by the configuration
+func InitializeBlobStore(cfg *config.Config) (Store, error) {
+	switch cfg.Blobs.Backend {
+	case "", "fs":
+		return NewFS(cfg.Blobs.Path)
+	case "s3":
+		return NewS3(S3Options{
+			Endpoint:  cfg.Blobs.S3.Endpoint,
+			Region:    cfg.Blobs.S3.Region,
+			Bucket:    cfg.Blobs.S3.Bucket,
+			Prefix:    cfg.Blobs.S3.Prefix,
+			AccessKey: cfg.Blobs.S3.AccessKey,
+			SecretKey: cfg.Blobs.S3.SecretKey,
+			PathStyle: cfg.Blobs.S3.PathStyle,
+		}, nil)
+	}
+	return nil, fmt.Errorf("unknown blob store backend %q", cfg.Blobs.Backend)
+}
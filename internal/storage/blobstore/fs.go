@@ -0,0 +1,90 @@
+package blobstore
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FS stores blobs as files under a root directory, fanned out by the first
+// bytes of the key to keep directories small
+type FS struct {
+	root string
+}
+
+// NewFS creates a filesystem store, creating root if needed
+func NewFS(root string) (*FS, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, err
+	}
+	return &FS{root: root}, nil
+}
+
+// Put writes data to a temporary file and renames it into place, so readers
+// never see a partial blob
+func (f *FS) Put(ctx context.Context, data []byte) (string, error) {
+	key := Key(data)
+	path := f.path(key)
+	if _, err := os.Stat(path); err == nil {
+		return key, nil
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, key+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Open opens the file of the blob
+func (f *FS) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	if !validKey(key) {
+		return nil, errInvalidKey
+	}
+	file, err := os.Open(f.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Delete removes the file of the blob
+func (f *FS) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return errInvalidKey
+	}
+	err := os.Remove(f.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// path returns the file of a blob, e.g. root/ab/cd/abcd...
+func (f *FS) path(key string) string {
+	return filepath.Join(f.root, key[:2], key[2:4], key)
+}
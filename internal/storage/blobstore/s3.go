@@ -0,0 +1,303 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// s3Timeout bounds the requests that do not stream a blob
+const s3Timeout = time.Minute
+
+// S3Options holds the location and credentials of an S3-compatible bucket
+type S3Options struct {
+	// Endpoint is the base URL of the service, e.g. https://s3.eu-central-1.amazonaws.com
+	// or http://localhost:9000 for MinIO
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses the bucket in the path instead of the host name
+	PathStyle bool
+}
+
+// S3 stores blobs as objects of an S3-compatible bucket. Requests are signed
+// with AWS Signature Version 4.
+type S3 struct {
+	opts     S3Options
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3 creates an S3 store. A nil client uses http.DefaultClient.
+func NewS3(opts S3Options, client *http.Client) (*S3, error) {
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("blobstore: invalid S3 endpoint %q", opts.Endpoint)
+	}
+	if opts.Bucket == "" {
+		return nil, errors.New("blobstore: S3 bucket is not set")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3{opts: opts, endpoint: endpoint, client: client, now: time.Now}, nil
+}
+
+// Put uploads data unless an object with the same key already exists
+func (s *S3) Put(ctx context.Context, data []byte) (string, error) {
+	key := Key(data)
+
+	exists, err := s.exists(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return key, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s3Timeout)
+	defer cancel()
+	res, err := s.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", s.responseError(res)
+	}
+	return key, nil
+}
+
+// Open streams the object of the blob. Only its size is requested up front,
+// the content is requested by the first read, from the offset of the last seek.
+func (s *S3) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	if !validKey(key) {
+		return nil, errInvalidKey
+	}
+	size, err := s.stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Object{s: s, ctx: ctx, key: key, size: size}, nil
+}
+
+// Delete removes the object of the blob
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return errInvalidKey
+	}
+	ctx, cancel := context.WithTimeout(ctx, s3Timeout)
+	defer cancel()
+	res, err := s.do(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return s.responseError(res)
+}
+
+// get requests the object of a blob from offset on
+func (s *S3) get(ctx context.Context, key string, offset int64) (*http.Response, error) {
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	res, err := s.doWithHeader(ctx, http.MethodGet, key, nil, header)
+	if err != nil {
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return res, nil
+	case http.StatusNotFound:
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+	defer res.Body.Close()
+	return nil, s.responseError(res)
+}
+
+// exists reports whether the object of a blob exists
+func (s *S3) exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.stat(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// stat returns the size of the object of a blob, or ErrNotFound
+func (s *S3) stat(ctx context.Context, key string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s3Timeout)
+	defer cancel()
+	res, err := s.do(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.ContentLength, nil
+	case http.StatusNotFound:
+		return 0, ErrNotFound
+	}
+	return 0, s.responseError(res)
+}
+
+// do sends a signed request for the object of a blob
+func (s *S3) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	return s.doWithHeader(ctx, method, key, body, nil)
+}
+
+// doWithHeader sends a signed request with extra unsigned headers
+func (s *S3) doWithHeader(ctx context.Context, method, key string, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	s.sign(req, Key(body))
+	return s.client.Do(req)
+}
+
+// objectURL returns the URL of the object storing a blob
+func (s *S3) objectURL(key string) string {
+	u := *s.endpoint
+	object := strings.TrimSuffix(u.Path, "/") + "/"
+	if s.opts.PathStyle {
+		object += s.opts.Bucket + "/"
+	} else {
+		u.Host = s.opts.Bucket + "." + u.Host
+	}
+	u.Path = object + s.opts.Prefix + key
+	return u.String()
+}
+
+// sign adds the Signature Version 4 authorization of req, whose body hashes to payloadHash
+func (s *S3) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + s.opts.Region + "/s3/aws4_request"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := []byte("AWS4" + s.opts.SecretKey)
+	for _, part := range strings.Split(scope, "/") {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.opts.AccessKey, scope, signedHeaders, signature))
+}
+
+// responseError turns an unexpected S3 response into an error carrying the start of its body
+func (s *S3) responseError(res *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	return fmt.Errorf("blobstore: S3 %s %s: %s: %s", res.Request.Method, res.Request.URL.Path, res.Status, bytes.TrimSpace(msg))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Object reads an object sequentially and reopens it at the new offset after a seek
+type s3Object struct {
+	s      *S3
+	ctx    context.Context
+	key    string
+	size   int64
+	offset int64
+	// body reads the object from offset on, nil before the first read and after a seek
+	body io.ReadCloser
+}
+
+// Read reads from the current offset, requesting the object on the first read
+// and again after a seek
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		res, err := o.s.get(o.ctx, o.key, o.offset)
+		if err != nil {
+			return 0, err
+		}
+		o.body = res.Body
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+// Seek moves the offset without any request
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	}
+	if offset < 0 {
+		return 0, errors.New("blobstore: negative seek offset")
+	}
+	if offset != o.offset && o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	o.offset = offset
+	return offset, nil
+}
+
+// Close releases the open response
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	return o.body.Close()
+}
@@ -0,0 +1,190 @@
+package postgresql
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// leaseCheckInterval is how often a held lease checks its connection
+	leaseCheckInterval = 30 * time.Second
+	// leaseCheckTimeout bounds a single check of the connection
+	leaseCheckTimeout = 10 * time.Second
+	// maxIdleLockConns bounds the connections kept for later leases
+	maxIdleLockConns = 4
+)
+
+// Locker takes session-level advisory locks, each on a connection of its own,
+// so that locks held during long operations do not pin connections of the pool
+// and a failing lock never takes the others down with it. Postgres releases the
+// locks when the connection closes, which hands the leases of a replica that
+// died over to the others.
+type Locker struct {
+	cfg       *pgx.ConnConfig
+	namespace int32
+
+	mu   sync.Mutex
+	idle []*pgx.Conn
+}
+
+// Lease is a lock taken by a Locker. Its context is cancelled as soon as the
+// lock may have been lost, so work done under the lease can stop.
+type Lease struct {
+	locker *Locker
+	key    int32
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	conn *pgx.Conn
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewLocker creates a locker connecting with the settings of the pool. Keys are
+// scoped by namespace so that unrelated locks never collide.
+func NewLocker(pool *pgxpool.Pool, namespace int32) *Locker {
+	return &Locker{cfg: pool.Config().ConnConfig, namespace: namespace}
+}
+
+// TryLock takes the lock of key without waiting. It returns nil when another
+// session holds the lock. The context of the lease derives from ctx.
+func (l *Locker) TryLock(ctx context.Context, key int32) (*Lease, error) {
+	conn, err := l.take(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var locked bool
+	err = conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1, $2)", l.namespace, key).Scan(&locked)
+	if err != nil {
+		// The connection is in an unknown state and may hold the lock
+		conn.Close(context.Background())
+		return nil, err
+	}
+	if !locked {
+		l.put(conn)
+		return nil, nil
+	}
+
+	lease := &Lease{locker: l, key: key, conn: conn, stop: make(chan struct{}), done: make(chan struct{})}
+	lease.ctx, lease.cancel = context.WithCancel(ctx)
+	go lease.watch()
+	return lease, nil
+}
+
+// Close closes the idle connections. Held leases are closed by their Release.
+func (l *Locker) Close(ctx context.Context) error {
+	l.mu.Lock()
+	idle := l.idle
+	l.idle = nil
+	l.mu.Unlock()
+
+	var err error
+	for _, conn := range idle {
+		if cerr := conn.Close(ctx); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// take returns an idle connection, opening a new one when there is none
+func (l *Locker) take(ctx context.Context) (*pgx.Conn, error) {
+	l.mu.Lock()
+	for len(l.idle) > 0 {
+		conn := l.idle[len(l.idle)-1]
+		l.idle = l.idle[:len(l.idle)-1]
+		if !conn.IsClosed() {
+			l.mu.Unlock()
+			return conn, nil
+		}
+	}
+	l.mu.Unlock()
+	return pgx.ConnectConfig(ctx, l.cfg)
+}
+
+// put keeps a connection holding no lock for a later lease
+func (l *Locker) put(conn *pgx.Conn) {
+	l.mu.Lock()
+	if len(l.idle) < maxIdleLockConns && !conn.IsClosed() {
+		l.idle = append(l.idle, conn)
+		conn = nil
+	}
+	l.mu.Unlock()
+	if conn != nil {
+		conn.Close(context.Background())
+	}
+}
+
+// Context returns the context of the lease, cancelled when the lease is
+// released or its connection fails
+func (le *Lease) Context() context.Context {
+	return le.ctx
+}
+
+// Release releases the lock. A connection that fails to unlock is closed,
+// which releases the lock of this lease and no other.
+func (le *Lease) Release(ctx context.Context) error {
+	close(le.stop)
+	<-le.done
+	le.cancel()
+
+	le.mu.Lock()
+	conn := le.conn
+	le.conn = nil
+	le.mu.Unlock()
+	if conn == nil {
+		// The lock went away with the connection
+		return nil
+	}
+
+	_, err := conn.Exec(ctx, "SELECT pg_advisory_unlock($1, $2)", le.locker.namespace, le.key)
+	if err != nil {
+		conn.Close(context.Background())
+		return err
+	}
+	le.locker.put(conn)
+	return nil
+}
+
+// watch checks the connection of the lease until it is released, and cancels
+// the lease once the connection fails
+func (le *Lease) watch() {
+	defer close(le.done)
+	ticker := time.NewTicker(leaseCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-le.stop:
+			return
+		case <-ticker.C:
+			if le.check() {
+				continue
+			}
+			le.cancel()
+			return
+		}
+	}
+}
+
+// check reports whether the connection of the lease is still alive. A failed
+// connection is closed so that the lock is not left behind on it.
+func (le *Lease) check() bool {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), leaseCheckTimeout)
+	defer cancel()
+	if err := le.conn.Ping(ctx); err != nil {
+		le.conn.Close(context.Background())
+		le.conn = nil
+		return false
+	}
+	return true
+}
@@ -0,0 +1,25 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/17HIERARCH70/SocialManager/internal/config"
+	"github.com/go-redis/redis/v8"
+)
+
+// InitializeRedis creates a Redis client and checks the connection. The client is
+// returned even when the server is unreachable, it reconnects on the next command.
+func InitializeRedis(cfg *config.Config) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.Database,
+	})
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return client, fmt.Errorf("error connecting to redis: %w", err)
+	}
+
+	return client, nil
+}
@@ -0,0 +1,10 @@
+-- Последний обработанный historyId Gmail для каждого пользователя
+CREATE TABLE gmail_sync_state (
+                                  user_id INT PRIMARY KEY,
+                                  history_id BIGINT NOT NULL,
+                                  synced_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                  CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Метки Gmail, чтобы изменения из users.history.list отражались в письмах
+ALTER TABLE emails ADD COLUMN label_ids TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,9 @@
+-- Триггер update_timestamp из 001 ожидает колонку updated_at
+ALTER TABLE users ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+-- Что делать с письмом в Gmail после сохранения: none, mark_read, archive, label
+ALTER TABLE users ADD COLUMN ingestion_policy VARCHAR(32) NOT NULL DEFAULT 'none';
+
+-- Состояние прочтения письма, синхронизируется с меткой UNREAD
+ALTER TABLE emails ADD COLUMN is_read BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE emails SET is_read = NOT ('UNREAD' = ANY(label_ids));
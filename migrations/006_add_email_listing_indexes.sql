@@ -0,0 +1,3 @@
+-- Индексы для постраничной выдачи писем, отсортированных по дате отправки
+CREATE INDEX idx_emails_user_sended_at ON emails (user_id, (COALESCE(sended_at, created_at)) DESC, id DESC);
+CREATE INDEX idx_emails_sended_at ON emails ((COALESCE(sended_at, created_at)) DESC, id DESC);
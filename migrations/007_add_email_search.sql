@@ -0,0 +1,16 @@
+-- Текст письма без HTML-разметки, заполняется при сохранении письма
+ALTER TABLE emails ADD COLUMN body_text TEXT NOT NULL DEFAULT '';
+
+-- Грубое заполнение для уже сохранённых писем
+UPDATE emails SET body_text = regexp_replace(
+        regexp_replace(body, '<(script|style)[^>]*>.*?</\1>|<[^>]+>', ' ', 'gi'),
+        '\s+', ' ', 'g');
+
+-- Конфигурация simple, так как в ящиках смешаны русский и английский
+ALTER TABLE emails ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce(subject, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(sender, '')), 'B') ||
+    setweight(to_tsvector('simple', coalesce(body_text, '')), 'C')
+) STORED;
+
+CREATE INDEX idx_emails_search_vector ON emails USING GIN (search_vector);
@@ -0,0 +1,25 @@
+-- Пользовательские фильтры: условия по отправителю, теме, тексту и вложениям и действия над письмом
+CREATE TABLE filters (
+                         id SERIAL PRIMARY KEY,
+                         user_id INT NOT NULL,
+                         name VARCHAR(255) NOT NULL,
+                         enabled BOOLEAN NOT NULL DEFAULT TRUE,
+                         priority INT NOT NULL DEFAULT 0,
+                         match_all BOOLEAN NOT NULL DEFAULT TRUE, -- AND или OR между условиями
+                         stop_processing BOOLEAN NOT NULL DEFAULT FALSE,
+                         conditions JSONB NOT NULL DEFAULT '[]',
+                         actions JSONB NOT NULL DEFAULT '[]',
+                         created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                         updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                         CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_filters_user_id ON filters (user_id, priority, id);
+
+CREATE TRIGGER update_timestamp
+    BEFORE UPDATE ON filters
+    FOR EACH ROW
+EXECUTE PROCEDURE update_timestamp();
+
+-- Метки, которые фильтры ставят письмам
+ALTER TABLE emails ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
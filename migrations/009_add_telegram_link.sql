@@ -0,0 +1,10 @@
+-- Чат Telegram, привязанный к пользователю
+ALTER TABLE users ADD COLUMN telegram_id VARCHAR(64) UNIQUE;
+
+-- Одноразовые коды для привязки чата командой /start <код>
+CREATE TABLE telegram_link_codes (
+                                     code VARCHAR(16) PRIMARY KEY,
+                                     user_id INT NOT NULL,
+                                     expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+                                     CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,15 @@
+-- Каналы Discord для уведомлений: вебхук или канал, куда пишет бот
+CREATE TABLE discord_channels (
+                                  id SERIAL PRIMARY KEY,
+                                  user_id INT NOT NULL,
+                                  name VARCHAR(255) NOT NULL,
+                                  webhook_id VARCHAR(64),
+                                  webhook_token TEXT,
+                                  channel_id VARCHAR(64),
+                                  all_emails BOOLEAN NOT NULL DEFAULT FALSE, -- все новые письма, а не только прошедшие фильтр
+                                  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                  CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+                                  CONSTRAINT discord_target CHECK ((webhook_id IS NOT NULL AND webhook_token IS NOT NULL) <> (channel_id IS NOT NULL))
+);
+
+CREATE INDEX idx_discord_channels_user_id ON discord_channels (user_id);
@@ -0,0 +1,3 @@
+-- Роль пользователя: user видит только свои данные, admin — данные всех пользователей
+ALTER TABLE users ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'admin'));
@@ -0,0 +1,18 @@
+-- Несколько сессий на пользователя: по строке на каждый выданный refresh-токен
+ALTER TABLE tokens DROP CONSTRAINT tokens_user_id_key;
+
+-- Старые refresh-токены не содержат jti и не могут быть обновлены
+DELETE FROM tokens;
+
+-- refresh_jti — идентификатор refresh-токена, family_id — цепочка токенов одного входа.
+-- Повторное использование уже потраченного токена (used_at) отзывает всю цепочку (revoked_at)
+ALTER TABLE tokens
+    ADD COLUMN refresh_jti VARCHAR(64) NOT NULL UNIQUE,
+    ADD COLUMN family_id VARCHAR(64) NOT NULL,
+    ADD COLUMN refresh_expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ADD COLUMN used_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN revoked_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX idx_tokens_family_id ON tokens (family_id);
+CREATE INDEX idx_tokens_user_id ON tokens (user_id);
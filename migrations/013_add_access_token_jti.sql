@@ -0,0 +1,7 @@
+-- Идентификатор access-токена (claim jti) для проверки отзыва сессии
+ALTER TABLE tokens ADD COLUMN access_jti VARCHAR(64);
+
+CREATE UNIQUE INDEX idx_tokens_access_jti ON tokens (access_jti);
+
+-- Срок действия сравнивается с NOW() при проверке отзыва
+ALTER TABLE tokens ALTER COLUMN expires_at TYPE TIMESTAMP WITH TIME ZONE;
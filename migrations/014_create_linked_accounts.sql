@@ -0,0 +1,45 @@
+-- Почтовые ящики, подключенные к пользователю: один вход, несколько ящиков Gmail
+CREATE TABLE linked_accounts (
+                                 id SERIAL PRIMARY KEY,
+                                 user_id INT NOT NULL,
+                                 provider VARCHAR(32) NOT NULL,
+                                 external_id VARCHAR(255) NOT NULL, -- sub аккаунта Google
+                                 address VARCHAR(255) NOT NULL,
+                                 access_token TEXT NOT NULL DEFAULT '',
+                                 refresh_token TEXT NOT NULL DEFAULT '',
+                                 expires_at TIMESTAMP WITH TIME ZONE,
+                                 history_id BIGINT, -- последний обработанный historyId Gmail
+                                 synced_at TIMESTAMP WITH TIME ZONE,
+                                 created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                 updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                                 CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+                                 UNIQUE (provider, external_id)
+);
+
+CREATE INDEX idx_linked_accounts_user_id ON linked_accounts (user_id);
+
+CREATE TRIGGER update_timestamp
+    BEFORE UPDATE ON linked_accounts
+    FOR EACH ROW
+EXECUTE PROCEDURE update_timestamp();
+
+-- Перенос ящика, с которым пользователь входил, вместе с токенами и состоянием синхронизации
+INSERT INTO linked_accounts (user_id, provider, external_id, address, access_token, refresh_token, expires_at, history_id, synced_at)
+SELECT u.id, 'gmail', u.google_id, u.email,
+       COALESCE(t.access_token, ''), COALESCE(t.refresh_token, ''), t.expires_at,
+       s.history_id, s.synced_at
+FROM users u
+         LEFT JOIN google_tokens t ON t.user_id = u.id
+         LEFT JOIN gmail_sync_state s ON s.user_id = u.id;
+
+DROP TABLE gmail_sync_state;
+DROP TABLE google_tokens;
+
+-- Ящик, из которого пришло письмо; идентификаторы Gmail уникальны только в пределах ящика
+ALTER TABLE emails ADD COLUMN account_id INT;
+UPDATE emails e SET account_id = a.id FROM linked_accounts a WHERE a.user_id = e.user_id;
+ALTER TABLE emails ALTER COLUMN account_id SET NOT NULL;
+ALTER TABLE emails ADD CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES linked_accounts(id) ON DELETE CASCADE;
+
+ALTER TABLE emails DROP CONSTRAINT emails_email_id_key;
+CREATE UNIQUE INDEX idx_emails_account_email_id ON emails (account_id, email_id);
@@ -0,0 +1,12 @@
+-- Ящики IMAP: параметры подключения вместо токенов OAuth
+ALTER TABLE linked_accounts
+    ADD COLUMN imap_host VARCHAR(255),
+    ADD COLUMN imap_port INT,
+    ADD COLUMN imap_tls BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN imap_username VARCHAR(255),
+    ADD COLUMN imap_password TEXT;
+
+-- Курсор синхронизации зависит от источника: historyId Gmail или UIDVALIDITY.UID для IMAP
+ALTER TABLE linked_accounts ADD COLUMN sync_cursor TEXT;
+UPDATE linked_accounts SET sync_cursor = history_id::TEXT WHERE history_id IS NOT NULL;
+ALTER TABLE linked_accounts DROP COLUMN history_id;
@@ -0,0 +1,2 @@
+-- Срок действия подписки users.watch на push-уведомления Gmail
+ALTER TABLE linked_accounts ADD COLUMN watch_expires_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,9 @@
+-- Содержимое вложений хранится в blob-хранилище под SHA-256, в attachments остаются только метаданные.
+-- Старые значения body переносятся в хранилище при запуске приложения и затем обнуляются
+ALTER TABLE attachments ADD COLUMN sha256 TEXT;
+ALTER TABLE attachments ADD COLUMN size BIGINT;
+
+CREATE INDEX idx_attachments_sha256 ON attachments (sha256);
+
+-- Идентификаторы вложений уникальны только в пределах письма (у IMAP это номер части)
+ALTER TABLE attachments DROP CONSTRAINT IF EXISTS attachments_attachment_id_key;
@@ -0,0 +1,5 @@
+-- Содержимое вложений скачивается при первом запросе или фоновой предзагрузкой.
+-- Вложения без sha256 ещё не скачаны, attachment_id указывает на них в почтовом ящике
+ALTER TABLE attachments ADD COLUMN fetch_attempts INT NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_attachments_pending ON attachments (id) WHERE sha256 IS NULL;
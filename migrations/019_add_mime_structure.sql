@@ -0,0 +1,12 @@
+-- Текстовая альтернатива письма и дерево его MIME-частей
+ALTER TABLE emails ADD COLUMN body_plain TEXT NOT NULL DEFAULT '';
+ALTER TABLE emails ADD COLUMN mime_structure JSONB;
+
+-- Вложения привязаны к MIME-части; встроенные изображения хранят Content-ID для ссылок cid:
+ALTER TABLE attachments ADD COLUMN part_id TEXT;
+ALTER TABLE attachments ADD COLUMN content_id TEXT;
+ALTER TABLE attachments ADD COLUMN inline BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Встроенные изображения часто не имеют имени файла, поэтому уникальность определяется номером части
+DROP INDEX IF EXISTS unique_attachment;
+CREATE UNIQUE INDEX unique_attachment_part ON attachments (email_id, part_id);
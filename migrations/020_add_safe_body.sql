@@ -0,0 +1,6 @@
+-- Очищенный HTML, который клиенты показывают вместо исходного тела письма, и короткий текстовый фрагмент
+ALTER TABLE emails ADD COLUMN body_safe TEXT;
+ALTER TABLE emails ADD COLUMN snippet TEXT NOT NULL DEFAULT '';
+
+-- Письма, сохранённые до появления очистки, обрабатываются фоновой задачей
+CREATE INDEX IF NOT EXISTS emails_body_safe_pending_idx ON emails (id) WHERE body_safe IS NULL;
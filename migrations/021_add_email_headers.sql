@@ -0,0 +1,6 @@
+-- Получатели, адрес для ответа и идентификаторы письма из его заголовков
+ALTER TABLE emails ADD COLUMN to_addresses TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE emails ADD COLUMN cc_addresses TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE emails ADD COLUMN reply_to TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE emails ADD COLUMN message_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE emails ADD COLUMN in_reply_to TEXT NOT NULL DEFAULT '';
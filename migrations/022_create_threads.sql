@@ -0,0 +1,21 @@
+-- Цепочки писем: ключ цепочки — threadId Gmail или корневой Message-ID для остальных источников
+CREATE TABLE threads (
+                         id SERIAL PRIMARY KEY,
+                         user_id INT NOT NULL,
+                         account_id INT NOT NULL,
+                         thread_key TEXT NOT NULL,
+                         created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                         CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+                         CONSTRAINT fk_account FOREIGN KEY (account_id) REFERENCES linked_accounts(id) ON DELETE CASCADE,
+                         UNIQUE (account_id, thread_key)
+);
+
+CREATE INDEX idx_threads_user_id ON threads (user_id);
+
+-- Цепочка письма и идентификаторы из заголовка References
+ALTER TABLE emails ADD COLUMN thread_id INT REFERENCES threads(id) ON DELETE SET NULL;
+ALTER TABLE emails ADD COLUMN message_references TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_emails_thread_id ON emails (thread_id, sended_at);
+-- Поиск письма, на которое отвечают, по его Message-ID
+CREATE INDEX idx_emails_message_id ON emails (account_id, message_id) WHERE message_id <> '';
@@ -0,0 +1,2 @@
+-- Ссылки на проксируемые изображения подписаны прежним ключом; такие тела очищаются заново фоновой задачей
+UPDATE emails SET body_safe = NULL WHERE body_safe LIKE '%/api/images/proxy?%';
@@ -0,0 +1,3 @@
+-- Фильтр без условий совпадает с любым письмом; такие фильтры с удалением отключаются
+UPDATE filters SET enabled = FALSE
+WHERE enabled AND conditions = '[]'::jsonb AND actions @> '[{"type": "delete"}]'::jsonb;
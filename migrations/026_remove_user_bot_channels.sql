@@ -0,0 +1,3 @@
+-- Канал бота по ID не доказывает, что пользователь им управляет; такие каналы теперь регистрируют только администраторы
+DELETE FROM discord_channels
+WHERE channel_id IS NOT NULL AND user_id IN (SELECT id FROM users WHERE role <> 'admin');
@@ -0,0 +1,4 @@
+-- created_at хранит время получения письма и используется в сортировке и курсорах списка,
+-- поэтому его больше нельзя перезаписывать при каждом UPDATE (пометка прочитанным, теги, тред)
+DROP TRIGGER IF EXISTS trg_update_email_timestamp ON emails;
+DROP FUNCTION IF EXISTS update_email_timestamp();